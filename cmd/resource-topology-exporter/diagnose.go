@@ -0,0 +1,168 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/podrescli"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/diagnose"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/k8shelpers"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/logging"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/nrtupdater"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/podrescompat"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/resourcetopologyexporter"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/stalepods"
+)
+
+const (
+	diagnoseCommand = "diagnose"
+
+	diagnoseFormatText = "text"
+	diagnoseFormatJSON = "json"
+)
+
+type diagnoseArgs struct {
+	Output string
+}
+
+func parseDiagnoseArgs(args ...string) (ProgArgs, diagnoseArgs, error) {
+	dArgs := diagnoseArgs{}
+	pArgs, err := parseCommandArgs(diagnoseCommand, func(flags *flag.FlagSet) {
+		flags.StringVar(&dArgs.Output, "output", diagnoseFormatText, "Format of the report. One of: text, json.")
+	}, args...)
+	if err != nil {
+		return pArgs, dArgs, err
+	}
+	switch dArgs.Output {
+	case diagnoseFormatText, diagnoseFormatJSON:
+	default:
+		return pArgs, dArgs, fmt.Errorf("unsupported output format: %q", dArgs.Output)
+	}
+	return pArgs, dArgs, nil
+}
+
+// runDiagnose checks the prerequisites of the exporter configured by the same flags.
+// It fails only if a check fails, the warnings are reported but tolerated.
+func runDiagnose(args ...string) int {
+	pArgs, dArgs, err := parseDiagnoseArgs(args...)
+	if err != nil {
+		klog.Errorf("failed to parse args: %v", err)
+		return 1
+	}
+	if err := logging.Setup(pArgs.LocalArgs.Logging, pArgs.NRTupdater.Hostname); err != nil {
+		klog.Errorf("failed to set up the logging: %v", err)
+		return 1
+	}
+
+	rep := diagnose.Run(context.Background(), newDiagnoseChecks(pArgs))
+	if dArgs.Output == diagnoseFormatJSON {
+		err = rep.WriteJSON(os.Stdout)
+	} else {
+		err = rep.WriteText(os.Stdout)
+	}
+	if err != nil {
+		klog.Errorf("failed to write the report: %v", err)
+		return 1
+	}
+	if rep.Status == diagnose.StatusFail {
+		return 1
+	}
+	return 0
+}
+
+func newDiagnoseChecks(pArgs ProgArgs) []diagnose.Check {
+	checks := []diagnose.Check{}
+
+	cli, err := podrescompat.NewCompatClient(pArgs.RTE.PodResourcesSocketPath)
+	if err != nil {
+		checks = append(checks, diagnose.Unavailable("podresources-socket", err, "check --podresources-socket"))
+	} else {
+		checks = append(checks,
+			diagnose.CheckPodResources(cli, pArgs.RTE.PodResourcesSocketPath),
+			diagnose.CheckReferenceContainer(cli, pArgs.RTE.ReferenceContainer),
+		)
+	}
+
+	topoInfo, topoErr := resourcetopologyexporter.GetTopologyInfo(pArgs.RTE)
+	checks = append(checks,
+		diagnose.CheckKubeletConfig(topoInfo, topoErr),
+		diagnose.CheckSysfs(pArgs.Resourcemonitor.SysfsRoot),
+		diagnose.CheckConfigFile(pArgs.RTE.ConfigFile),
+	)
+
+	// without the api sink the exporter does not talk to the apiserver
+	if pArgs.NRTupdater.NoPublish {
+		return checks
+	}
+	checks = append(checks, diagnose.CheckCRD(nrtupdater.DiscoverServedVersions, pArgs.NRTupdater.APIVersion))
+	cs, err := k8shelpers.GetK8sClient("")
+	if err != nil {
+		checks = append(checks, diagnose.Unavailable("api-permissions", err, "run in the exporter pod, or check the service account token mount"))
+	} else {
+		checks = append(checks, diagnose.CheckPermissions(diagnose.NewSelfSubjectAccessReviewer(cs), requiredPermissions(pArgs, podrescli.ContainerIdentFromEnv().Namespace)))
+	}
+	return checks
+}
+
+// requiredPermissions lists the actions the enabled features perform, matching the ClusterRole in the manifests
+func requiredPermissions(pArgs ProgArgs, podNamespace string) []authorizationv1.ResourceAttributes {
+	nrt := func(verb string) authorizationv1.ResourceAttributes {
+		return authorizationv1.ResourceAttributes{Verb: verb, Group: nrtupdater.TopologyGroup, Resource: "noderesourcetopologies"}
+	}
+	core := func(verb, resource, subresource, namespace string) authorizationv1.ResourceAttributes {
+		return authorizationv1.ResourceAttributes{Verb: verb, Resource: resource, Subresource: subresource, Namespace: namespace}
+	}
+
+	attrs := []authorizationv1.ResourceAttributes{
+		nrt("get"),
+		nrt("create"),
+		nrt("patch"),
+		core("get", "nodes", "", ""),
+	}
+	if pArgs.NRTupdater.RepairInterval > 0 {
+		attrs = append(attrs, nrt("list"), nrt("watch"))
+	}
+	if pArgs.NRTupdater.ShutdownAction == nrtupdater.ShutdownDelete {
+		attrs = append(attrs, nrt("delete"))
+	}
+	if pArgs.RTE.PodReadinessEnable {
+		attrs = append(attrs, core("get", "pods", "", podNamespace), core("update", "pods", "status", podNamespace))
+	}
+	if pArgs.LocalArgs.StalePodsSource == stalepods.SourceAPIServer || (pArgs.LocalArgs.CPUAudit.Interval > 0 && pArgs.LocalArgs.StalePodsSource != stalepods.SourceKubelet) {
+		attrs = append(attrs, core("list", "pods", "", ""), core("watch", "pods", "", ""))
+	}
+	if pArgs.LocalArgs.Placement.Annotate {
+		attrs = append(attrs, core("patch", "pods", "", ""))
+	}
+	if pArgs.LocalArgs.Events {
+		attrs = append(attrs, core("create", "events", "", ""), core("patch", "events", "", ""))
+	}
+	if pArgs.LocalArgs.Freshness.Enabled {
+		attrs = append(attrs, core("patch", "nodes", "status", ""))
+	}
+	if pArgs.NRTupdater.CRDPolicy == nrtupdater.CRDPolicyInstall {
+		crd := nrtupdater.CustomResourceDefinitionResource
+		attrs = append(attrs, authorizationv1.ResourceAttributes{Verb: "create", Group: crd.Group, Resource: crd.Resource})
+	}
+	return attrs
+}
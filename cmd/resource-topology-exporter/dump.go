@@ -0,0 +1,290 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"google.golang.org/grpc"
+	"k8s.io/klog/v2"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+	"sigs.k8s.io/yaml"
+
+	"github.com/k8stopologyawareschedwg/noderesourcetopology-api/pkg/apis/topology/v1alpha1"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/logging"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/podrescompat"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/resourcetopologyexporter"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/sinks"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/sysinfo"
+)
+
+const (
+	dumpCommand = "dump"
+
+	dumpFormatTable = "table"
+)
+
+type dumpArgs struct {
+	Output string
+	Raw    bool
+}
+
+// rawPodResources holds the last podresources responses of the kubelet, before any filtering
+type rawPodResources struct {
+	Allocatable *podresourcesapi.AllocatableResourcesResponse `json:"allocatable,omitempty"`
+	List        *podresourcesapi.ListPodResourcesResponse     `json:"list,omitempty"`
+}
+
+type dumpOutput struct {
+	Zones        v1alpha1.ZoneList `json:"zones"`
+	PodResources *rawPodResources  `json:"podResources,omitempty"`
+}
+
+func parseDumpArgs(args ...string) (ProgArgs, dumpArgs, error) {
+	dArgs := dumpArgs{}
+	pArgs, err := parseCommandArgs(dumpCommand, func(flags *flag.FlagSet) {
+		flags.StringVar(&dArgs.Output, "output", dumpFormatTable, "Format of the dump. One of: table, json, yaml.")
+		flags.BoolVar(&dArgs.Raw, "raw", false, "Also dump the podresources responses of the kubelet.")
+	}, args...)
+	if err != nil {
+		return pArgs, dArgs, err
+	}
+	switch dArgs.Output {
+	case dumpFormatTable, sinks.FormatJSON, sinks.FormatYAML:
+	default:
+		return pArgs, dArgs, fmt.Errorf("unsupported output format: %q", dArgs.Output)
+	}
+	// the dump needs no cluster
+	pArgs.RTE.PodReadinessEnable = false
+	return pArgs, dArgs, nil
+}
+
+// runDump scans once through the same podresources client chain as the exporter and prints the zones
+func runDump(args ...string) int {
+	pArgs, dArgs, err := parseDumpArgs(args...)
+	if err != nil {
+		klog.Errorf("failed to parse args: %v", err)
+		return 1
+	}
+	if err := logging.Setup(pArgs.LocalArgs.Logging, pArgs.NRTupdater.Hostname); err != nil {
+		klog.Errorf("failed to set up the logging: %v", err)
+		return 1
+	}
+
+	out, err := dump(pArgs, dArgs)
+	if err != nil {
+		klog.Errorf("failed to dump the topology: %v", err)
+		return 1
+	}
+	if err := writeDump(os.Stdout, out, dArgs.Output); err != nil {
+		klog.Errorf("failed to write the dump: %v", err)
+		return 1
+	}
+	return 0
+}
+
+func dump(pArgs ProgArgs, dArgs dumpArgs) (dumpOutput, error) {
+	sysInfo, err := sysinfo.NewSysinfo(pArgs.LocalArgs.SysConf)
+	if err != nil {
+		return dumpOutput{}, fmt.Errorf("failed to query system info: %w", err)
+	}
+
+	k8sCli, err := podrescompat.NewCompatClient(pArgs.RTE.PodResourcesSocketPath)
+	if err != nil {
+		return dumpOutput{}, fmt.Errorf("failed to create podresources client: %w", err)
+	}
+	if pArgs.LocalArgs.SysConf.DynamicResources {
+		k8sCli.EnableDynamicResources(podrescompat.NewSysinfoDynamicResourceResolver(sysInfo))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	podSrc, err := newPodSource(ctx, pArgs.LocalArgs, pArgs.NRTupdater.Hostname)
+	if err != nil {
+		return dumpOutput{}, fmt.Errorf("failed to create the pod source: %w", err)
+	}
+
+	rawCli := &recordingClient{cli: k8sCli}
+	cli, err := newPodResourcesClient(rawCli, podSrc, nil, pArgs, nil)
+	if err != nil {
+		return dumpOutput{}, err
+	}
+
+	resObs, err := resourcetopologyexporter.NewResourceObserver(cli, pArgs.Resourcemonitor)
+	if err != nil {
+		return dumpOutput{}, err
+	}
+	monInfo, err := resObs.Scan(false)
+	if err != nil {
+		return dumpOutput{}, fmt.Errorf("failed to scan pod resources: %w", err)
+	}
+
+	out := dumpOutput{
+		Zones: monInfo.Zones,
+	}
+	if dArgs.Raw {
+		out.PodResources = rawCli.Last()
+	}
+	return out, nil
+}
+
+func writeDump(w io.Writer, out dumpOutput, format string) error {
+	switch format {
+	case sinks.FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	case sinks.FormatYAML:
+		data, err := yaml.Marshal(out)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	default:
+		return writeDumpTable(w, out)
+	}
+}
+
+// writeDumpTable prints a row per resource of each zone, then the raw responses if any
+func writeDumpTable(w io.Writer, out dumpOutput) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ZONE\tTYPE\tRESOURCE\tCAPACITY\tALLOCATABLE\tAVAILABLE")
+	for _, zone := range out.Zones {
+		for _, res := range zone.Resources {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", zone.Name, zone.Type, res.Name, res.Capacity.String(), res.Allocatable.String(), res.Available.String())
+		}
+	}
+
+	if out.PodResources != nil {
+		if alloc := out.PodResources.Allocatable; alloc != nil {
+			fmt.Fprintln(tw, "\nRESOURCE\tNUMA\tALLOCATABLE")
+			for _, row := range resourceRows(alloc.CpuIds, alloc.Devices, alloc.Memory) {
+				fmt.Fprintf(tw, "%s\n", strings.Join(row, "\t"))
+			}
+		}
+		if list := out.PodResources.List; list != nil {
+			fmt.Fprintln(tw, "\nNAMESPACE\tPOD\tCONTAINER\tRESOURCE\tNUMA\tALLOCATED")
+			for _, pod := range list.PodResources {
+				for _, cnt := range pod.Containers {
+					for _, row := range resourceRows(cnt.CpuIds, cnt.Devices, cnt.Memory) {
+						fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", pod.Namespace, pod.Name, cnt.Name, strings.Join(row, "\t"))
+					}
+				}
+			}
+		}
+	}
+	return tw.Flush()
+}
+
+// resourceRows returns the resource name, the NUMA nodes and the allocation of each resource
+func resourceRows(cpuIDs []int64, devs []*podresourcesapi.ContainerDevices, mems []*podresourcesapi.ContainerMemory) [][]string {
+	rows := [][]string{}
+	if len(cpuIDs) > 0 {
+		cpus := make([]int, 0, len(cpuIDs))
+		for _, id := range cpuIDs {
+			cpus = append(cpus, int(id))
+		}
+		rows = append(rows, []string{"cpu", "-", cpuset.NewCPUSet(cpus...).String()})
+	}
+	for _, dev := range devs {
+		rows = append(rows, []string{dev.ResourceName, numaNodes(dev.Topology), strings.Join(dev.DeviceIds, ",")})
+	}
+	for _, mem := range mems {
+		rows = append(rows, []string{mem.MemoryType, numaNodes(mem.Topology), strconv.FormatUint(mem.Size_, 10)})
+	}
+	return rows
+}
+
+func numaNodes(topo *podresourcesapi.TopologyInfo) string {
+	if topo == nil || len(topo.Nodes) == 0 {
+		return "-"
+	}
+	ids := make([]string, 0, len(topo.Nodes))
+	for _, node := range topo.Nodes {
+		ids = append(ids, strconv.FormatInt(node.ID, 10))
+	}
+	return strings.Join(ids, ",")
+}
+
+// recordingClient keeps a copy of the last responses of the wrapped client,
+// because the clients down the chain modify them in place
+type recordingClient struct {
+	cli podresourcesapi.PodResourcesListerClient
+
+	lock sync.Mutex
+	last rawPodResources
+}
+
+func (rc *recordingClient) List(ctx context.Context, in *podresourcesapi.ListPodResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.ListPodResourcesResponse, error) {
+	resp, err := rc.cli.List(ctx, in, opts...)
+	if err != nil {
+		return resp, err
+	}
+	last := &podresourcesapi.ListPodResourcesResponse{}
+	if err := cloneMessage(resp, last); err != nil {
+		return resp, err
+	}
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	rc.last.List = last
+	return resp, nil
+}
+
+func (rc *recordingClient) GetAllocatableResources(ctx context.Context, in *podresourcesapi.AllocatableResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.AllocatableResourcesResponse, error) {
+	resp, err := rc.cli.GetAllocatableResources(ctx, in, opts...)
+	if err != nil {
+		return resp, err
+	}
+	last := &podresourcesapi.AllocatableResourcesResponse{}
+	if err := cloneMessage(resp, last); err != nil {
+		return resp, err
+	}
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	rc.last.Allocatable = last
+	return resp, nil
+}
+
+func (rc *recordingClient) Last() *rawPodResources {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	last := rc.last
+	return &last
+}
+
+type message interface {
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+}
+
+func cloneMessage(src, dst message) error {
+	data, err := src.Marshal()
+	if err != nil {
+		return fmt.Errorf("cannot copy the podresources response: %w", err)
+	}
+	return dst.Unmarshal(data)
+}
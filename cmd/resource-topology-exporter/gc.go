@@ -0,0 +1,65 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"k8s.io/klog/v2"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/nrtupdater"
+)
+
+const gcCommand = "gc"
+
+func parseGCArgs(args ...string) (nrtupdater.GCArgs, error) {
+	gcArgs := nrtupdater.GCArgs{}
+
+	flags := flag.NewFlagSet(gcCommand, flag.ExitOnError)
+	klog.InitFlags(flags)
+
+	flags.StringVar(&gcArgs.APIVersion, "nrt-api-version", nrtupdater.APIVersionAuto, "NodeResourceTopology API version to use. One of: v1alpha1, v1alpha2, auto.")
+	flags.BoolVar(&gcArgs.DryRun, "dry-run", false, "Only report the objects to delete.")
+
+	err := flags.Parse(args)
+	return gcArgs, err
+}
+
+// runGC removes the NodeResourceTopology objects of nodes which no longer exist
+func runGC(args ...string) int {
+	gcArgs, err := parseGCArgs(args...)
+	if err != nil {
+		klog.Errorf("failed to parse args: %v", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	removed, err := nrtupdater.GarbageCollect(ctx, gcArgs)
+	for _, name := range removed {
+		fmt.Fprintln(os.Stdout, name)
+	}
+	if err != nil {
+		klog.Errorf("failed to collect the orphaned objects: %v", err)
+		return 1
+	}
+	return 0
+}
@@ -15,29 +15,57 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"net"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/klog/v2"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
 
-	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/nrtupdater"
+	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/podreadiness"
 	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/podrescli"
-	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/prometheus"
 	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/resourcemonitor"
-	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/resourcetopologyexporter"
 	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/version"
 
 	"github.com/openshift-kni/resource-topology-exporter/pkg/config"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/cpuaudit"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/events"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/freshness"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/health"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/k8shelpers"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/logging"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/metrics"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/nrtupdater"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/placement"
 	"github.com/openshift-kni/resource-topology-exporter/pkg/podrescompat"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/resourcetopologyexporter"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/sharedpool"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/sinks"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/stalepods"
 	"github.com/openshift-kni/resource-topology-exporter/pkg/sysinfo"
 )
 
 type localArgs struct {
-	SysConf sysinfo.Config
+	SysConf            sysinfo.Config
+	StalePodsSource    string
+	StalePods          stalepods.Args
+	KubeletReadOnlyURL string
+	CPUAudit           cpuaudit.Args
+	SharedPool         sharedpool.Args
+	Placement          placement.Args
+	Events             bool
+	Freshness          freshness.Args
+	Health             health.Args
+	Logging            logging.Args
 }
 
 type ProgArgs struct {
@@ -46,6 +74,10 @@ type ProgArgs struct {
 	RTE             resourcetopologyexporter.Args
 	Version         bool
 	LocalArgs       localArgs
+	Sinks           sinks.Args
+	// PrintEffectiveConfig prints the flags merged from all the sources, and exits
+	PrintEffectiveConfig bool
+	effective            []flagSetting
 }
 
 func (pa *ProgArgs) ToJson() ([]byte, error) {
@@ -53,6 +85,23 @@ func (pa *ProgArgs) ToJson() ([]byte, error) {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case gcCommand:
+			os.Exit(runGC(os.Args[2:]...))
+		case taintControllerCommand:
+			os.Exit(runTaintController(os.Args[2:]...))
+		case dumpCommand:
+			os.Exit(runDump(os.Args[2:]...))
+		case diagnoseCommand:
+			os.Exit(runDiagnose(os.Args[2:]...))
+		case mustGatherCommand:
+			os.Exit(runMustGather(os.Args[2:]...))
+		case renderCommand:
+			os.Exit(runRender(os.Args[2:]...))
+		}
+	}
+
 	parsedArgs, err := parseArgs(os.Args[1:]...)
 	if err != nil {
 		klog.Fatalf("failed to parse args: %v", err)
@@ -63,6 +112,21 @@ func main() {
 		os.Exit(0)
 	}
 
+	if parsedArgs.PrintEffectiveConfig {
+		if err := writeEffectiveConfig(os.Stdout, parsedArgs.effective); err != nil {
+			klog.Fatalf("failed to print the effective configuration: %v", err)
+		}
+		os.Exit(0)
+	}
+
+	if err := logging.Setup(parsedArgs.LocalArgs.Logging, parsedArgs.NRTupdater.Hostname); err != nil {
+		klog.Fatalf("failed to set up the logging: %v", err)
+	}
+
+	// the pipeline stops on termination, then the shutdown action is applied
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
 	// only for debug purposes
 	// printing the header so early includes any debug message from the sysinfo package
 	klog.Infof("=== System information ===\n")
@@ -73,59 +137,186 @@ func main() {
 	klog.Infof("%s", sysInfo)
 	klog.Infof("==========================\n")
 
-	k8sCli, err := podrescli.NewK8SClient(parsedArgs.RTE.PodResourcesSocketPath)
+	k8sCli, err := podrescompat.NewCompatClient(parsedArgs.RTE.PodResourcesSocketPath)
 	if err != nil {
-		klog.Fatalf("failed to start prometheus server: %v", err)
+		klog.Fatalf("failed to create podresources client: %v", err)
 	}
 
-	sysCli := k8sCli
-	if !parsedArgs.LocalArgs.SysConf.IsEmpty() {
-		sysCli = podrescompat.NewSysinfoClientFromLister(k8sCli, parsedArgs.LocalArgs.SysConf)
+	if parsedArgs.LocalArgs.SysConf.DynamicResources {
+		k8sCli.EnableDynamicResources(podrescompat.NewSysinfoDynamicResourceResolver(sysInfo))
 	}
 
-	cli, err := podrescli.NewFilteringClientFromLister(sysCli, parsedArgs.RTE.Debug, parsedArgs.RTE.ReferenceContainer)
+	var rec *events.Recorder
+	if parsedArgs.LocalArgs.Events {
+		rec, err = newEventRecorder(ctx, parsedArgs.NRTupdater.Hostname)
+		if err != nil {
+			klog.Fatalf("failed to create the event recorder: %v", err)
+		}
+	}
+
+	podSrc, err := newPodSource(ctx, parsedArgs.LocalArgs, parsedArgs.NRTupdater.Hostname)
 	if err != nil {
-		klog.Fatalf("failed to get podresources filtering client: %v", err)
+		klog.Fatalf("failed to create the pod source: %v", err)
 	}
 
-	err = prometheus.InitPrometheus()
+	condChan := newConditionChannel(parsedArgs.RTE)
+	cli, err := newPodResourcesClient(k8sCli, podSrc, condChan, parsedArgs, rec)
 	if err != nil {
-		klog.Fatalf("failed to start prometheus server: %v", err)
+		klog.Fatalf("%v", err)
+	}
+
+	// created early, so the debug endpoints can be served along with the health checks
+	var tracker *health.Tracker
+	var srv *health.Server
+	if parsedArgs.LocalArgs.Health.Address != "" {
+		tracker = health.NewTracker(parsedArgs.RTE.SleepInterval, parsedArgs.LocalArgs.Health.Intervals)
+		srv = health.NewServer(parsedArgs.LocalArgs.Health, tracker)
+		srv.HandleJSON("/debug/sysinfo", sysInfo)
+		srv.HandleJSON("/debug/config", parsedArgs)
+	}
+
+	if parsedArgs.LocalArgs.Placement.Enabled() {
+		placementCli, err := newPlacementTrackingClient(ctx, cli, parsedArgs.LocalArgs.Placement, parsedArgs.Resourcemonitor.SysfsRoot)
+		if err != nil {
+			klog.Fatalf("failed to get podresources placement tracking client: %v", err)
+		}
+		if srv != nil {
+			srv.Handle("/debug/placement", placementCli)
+		}
+		cli = placementCli
+	}
+
+	// the upstream callers do not take a context
+	cli = podrescompat.NewContextClientFromLister(ctx, cli)
+
+	metrics.Setup(parsedArgs.NRTupdater.Hostname)
+
+	if parsedArgs.LocalArgs.CPUAudit.Interval > 0 {
+		auditor, err := cpuaudit.NewAuditor(cli, podSrc, parsedArgs.LocalArgs.CPUAudit)
+		if err != nil {
+			klog.Fatalf("failed to create the cpuset auditor: %v", err)
+		}
+		if srv != nil {
+			srv.Handle("/debug/cpuaudit", auditor)
+		}
+		auditor.Run(ctx.Done())
 	}
 
-	err = resourcetopologyexporter.Execute(cli, parsedArgs.NRTupdater, parsedArgs.Resourcemonitor, parsedArgs.RTE)
+	go func() {
+		if err := metrics.Serve(ctx, net.JoinHostPort(os.Getenv("METRICS_HOST"), metricsPort())); err != nil {
+			klog.Fatalf("failed to serve the metrics: %v", err)
+		}
+	}()
+
+	var freshRep *freshness.Reporter
+	if parsedArgs.LocalArgs.Freshness.Enabled {
+		cs, err := k8shelpers.GetK8sClient("")
+		if err != nil {
+			klog.Fatalf("failed to create the node condition reporter: %v", err)
+		}
+		freshRep = freshness.NewReporter(freshness.NewClientsetNodeClient(cs), parsedArgs.NRTupdater.Hostname, parsedArgs.LocalArgs.Freshness)
+	}
+
+	if srv != nil {
+		go func() {
+			if err := srv.Serve(ctx); err != nil {
+				klog.Fatalf("failed to serve the health checks: %v", err)
+			}
+		}()
+	}
+
+	obs := resourcetopologyexporter.Observers{
+		Events:     rec,
+		Freshness:  freshRep,
+		Health:     tracker,
+		Conditions: condChan,
+	}
+	err = resourcetopologyexporter.Execute(ctx, cli, parsedArgs.NRTupdater, parsedArgs.Resourcemonitor, parsedArgs.RTE, parsedArgs.Sinks, obs)
+	if parsedArgs.NRTupdater.Oneshot {
+		code := oneshotExitCode(err)
+		klog.Flush()
+		os.Exit(code)
+	}
 	if err != nil {
 		klog.Fatalf("failed to execute: %v", err)
 	}
+	klog.Infof("shutdown complete")
+	klog.Flush()
+}
+
+// https://kubernetes.io/docs/tasks/administer-cluster/topology-manager/#topology-manager-scopes
+const defaultTopologyManagerScope = "container"
+
+const (
+	exitCodeSuccess       = 0
+	exitCodeFailure       = 1
+	exitCodeScanFailed    = 2
+	exitCodePublishFailed = 3
+)
+
+// oneshotExitCode lets the jobs and the scripts tell why the update failed
+func oneshotExitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitCodeSuccess
+	case errors.Is(err, resourcetopologyexporter.ErrScan):
+		klog.Errorf("oneshot update failed: %v", err)
+		return exitCodeScanFailed
+	case errors.Is(err, resourcetopologyexporter.ErrPublish):
+		klog.Errorf("oneshot update failed: %v", err)
+		return exitCodePublishFailed
+	default:
+		klog.Errorf("failed to execute: %v", err)
+		return exitCodeFailure
+	}
 }
 
 // The args is passed only for testing purposes.
 func parseArgs(args ...string) (ProgArgs, error) {
+	return parseCommandArgs(version.ProgramName, nil, args...)
+}
+
+// parseCommandArgs lets the subcommands accept the exporter flags on top of their own, registered by addFlags
+func parseCommandArgs(name string, addFlags func(flags *flag.FlagSet), args ...string) (ProgArgs, error) {
+	return parseCommandArgsFromEnv(name, addFlags, os.LookupEnv, args...)
+}
+
+// parseCommandArgsFromEnv takes the RTE_ prefixed environment variables from lookupEnv
+func parseCommandArgsFromEnv(name string, addFlags func(flags *flag.FlagSet), lookupEnv func(key string) (string, bool), args ...string) (ProgArgs, error) {
 	pArgs := ProgArgs{
 		nrtupdater.Args{},
 		resourcemonitor.Args{},
 		resourcetopologyexporter.Args{},
 		false,
 		localArgs{},
+		sinks.Args{},
+		false,
+		nil,
 	}
 
 	var configPath string
-	flags := flag.NewFlagSet(version.ProgramName, flag.ExitOnError)
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
 
 	klog.InitFlags(flags)
 
 	flags.BoolVar(&pArgs.NRTupdater.NoPublish, "no-publish", false, "Do not publish discovered features to the cluster-local Kubernetes API server.")
-	flags.BoolVar(&pArgs.NRTupdater.Oneshot, "oneshot", false, "Update once and exit.")
+	flags.BoolVar(&pArgs.NRTupdater.Oneshot, "oneshot", false, "Scan and update the sinks once, then exit.\n Exit codes: 0 on success, 2 if the scan failed, 3 if the update failed, 1 on any other error.")
+	flags.StringVar(&pArgs.NRTupdater.APIVersion, "nrt-api-version", nrtupdater.APIVersionV1alpha1, "NodeResourceTopology API version to publish. One of: v1alpha1, v1alpha2, auto.\n auto picks the newest version served by the apiserver.")
+	flags.StringVar(&pArgs.NRTupdater.ShutdownAction, "nrt-on-shutdown", nrtupdater.ShutdownMarkStale, "What to do with the NodeResourceTopology object on termination. One of: keep, mark-stale, delete.")
+	flags.DurationVar(&pArgs.NRTupdater.HeartbeatInterval, "nrt-heartbeat-interval", 10*time.Minute, "Maximum time between NodeResourceTopology writes when nothing changes. 0 writes on every poll.")
+	flags.DurationVar(&pArgs.NRTupdater.RepairInterval, "nrt-repair-interval", 5*time.Second, "Minimum time between repairs of the NodeResourceTopology object deleted or modified by someone else. 0 disables the repairs.")
+	flags.StringVar(&pArgs.NRTupdater.CRDPolicy, "nrt-crd-policy", nrtupdater.CRDPolicyIgnore, "What to do at startup if the NodeResourceTopology CRD is not served. One of: ignore, wait, install.\n wait retries with backoff, install creates the embedded CRD, which serves only v1alpha1, if permitted and then waits.")
+	flags.DurationVar(&pArgs.NRTupdater.CRDTimeout, "nrt-crd-timeout", 0, "Maximum time to wait for the NodeResourceTopology CRD. 0 waits forever.")
 	flags.StringVar(&pArgs.NRTupdater.Hostname, "hostname", defaultHostName(), "Override the node hostname.")
 
 	flags.StringVar(&pArgs.Resourcemonitor.Namespace, "watch-namespace", "", "Namespace to watch pods for. Use \"\" for all namespaces.")
 	flags.StringVar(&pArgs.Resourcemonitor.SysfsRoot, "sysfs", "/sys", "Top-level component path of sysfs.")
 
-	flags.StringVar(&configPath, "config", "/etc/resource-topology-exporter/config.yaml", "Configuration file path. Use this to set the exclude list.")
+	flags.StringVar(&configPath, "config", "/etc/resource-topology-exporter/config.yaml", "Configuration file path. Use this to set the exclude list.\n Any flag can be set in its flags section, and from the RTE_ prefixed environment variable, like RTE_SLEEP_INTERVAL.\n The command line has the precedence, then the environment, then the configuration file.\n The sinks, topologymanagerpolicy and topologymanagerscope keys of the file count as its flags section.")
 
 	flags.BoolVar(&pArgs.RTE.Debug, "debug", false, " Enable debug output.")
-	flags.StringVar(&pArgs.RTE.TopologyManagerPolicy, "topology-manager-policy", defaultTopologyManagerPolicy(), "Explicitly set the topology manager policy instead of reading from the kubelet.")
-	flags.StringVar(&pArgs.RTE.TopologyManagerScope, "topology-manager-scope", defaultTopologyManagerScope(), "Explicitly set the topology manager scope instead of reading from the kubelet.")
+	flags.StringVar(&pArgs.RTE.TopologyManagerPolicy, "topology-manager-policy", "", "Explicitly set the topology manager policy instead of reading from the kubelet.")
+	flags.StringVar(&pArgs.RTE.TopologyManagerScope, "topology-manager-scope", defaultTopologyManagerScope, "Explicitly set the topology manager scope instead of reading from the kubelet.")
 	flags.DurationVar(&pArgs.RTE.SleepInterval, "sleep-interval", 60*time.Second, "Time to sleep between podresources API polls.")
 	flags.StringVar(&pArgs.RTE.KubeletConfigFile, "kubelet-config-file", "/podresources/config.yaml", "Kubelet config file path.")
 	flags.StringVar(&pArgs.RTE.PodResourcesSocketPath, "podresources-socket", "unix:///podresources/kubelet.sock", "Pod Resource Socket path to use.")
@@ -135,18 +326,118 @@ func parseArgs(args ...string) (ProgArgs, error) {
 	refCnt := flags.String("reference-container", "", "Reference container, used to learn about the shared cpu pool\n See: https://github.com/kubernetes/kubernetes/issues/102190\n format of spec is namespace/podname/containername.\n Alternatively, you can use the env vars REFERENCE_NAMESPACE, REFERENCE_POD_NAME, REFERENCE_CONTAINER_NAME.")
 
 	flags.StringVar(&pArgs.RTE.NotifyFilePath, "notify-file", "", "Notification file path.")
+	flags.DurationVar(&pArgs.RTE.ShutdownTimeout, "shutdown-timeout", 10*time.Second, "On termination, maximum time to wait for the update in flight, and then for the --nrt-on-shutdown action.")
+
+	flags.StringVar(&pArgs.LocalArgs.StalePodsSource, "stale-pods-source", stalepods.SourceNone, "Where to learn about the pods running on the node, to detect stale podresources allocations. One of: none, apiserver, kubelet.")
+	flags.BoolVar(&pArgs.LocalArgs.StalePods.Ignore, "stale-pods-ignore", false, "Report the resources held by stale podresources allocations as available.")
+	flags.StringVar(&pArgs.LocalArgs.KubeletReadOnlyURL, "kubelet-read-only-url", "http://127.0.0.1:10255", "Kubelet read-only endpoint, used with --stale-pods-source=kubelet.")
+
+	flags.DurationVar(&pArgs.LocalArgs.CPUAudit.Interval, "cpuset-audit-interval", 0, "Time between the checks of the exclusive cpus against the container cpusets. 0 disables the audit.")
+	flags.StringVar(&pArgs.LocalArgs.CPUAudit.CgroupRoot, "cgroup-root", "/sys/fs/cgroup", "Cgroup filesystem mount point, used by the cpuset audit and by --shared-pool-source=cgroup.")
+	flags.StringVar(&pArgs.LocalArgs.SharedPool.Source, "shared-pool-source", sharedpool.SourceReferenceContainer, "Where to learn about the shared cpu pool. One of: reference-container, cgroup, cpu-manager-state.\n If a reference container is also set, it is used to validate the other sources.")
+	flags.StringVar(&pArgs.LocalArgs.SharedPool.CPUManagerStateFile, "cpu-manager-state-file", "/var/lib/kubelet/cpu_manager_state", "Kubelet cpu manager state file, used with --shared-pool-source=cgroup and cpu-manager-state.")
+
+	sinkNames := flags.String("sinks", "", "Comma separated list of the destinations of the zone data. Any of: api, file, stdout, http, nfd, grpc.\n Defaults to api.")
+	flags.StringVar(&pArgs.Sinks.Format, "sink-format", sinks.FormatJSON, "Format of the file and stdout sinks. One of: json, yaml.")
+	flags.StringVar(&pArgs.Sinks.FilePath, "sink-file", "", "File kept updated by the file sink.")
+	flags.StringVar(&pArgs.Sinks.GRPCSocket, "grpc-socket", "/run/rte/rte.sock", "Unix socket the grpc sink serves the node topology API on.")
+	flags.StringVar(&pArgs.Sinks.NFDFeatureFile, "nfd-feature-file", sinks.DefaultNFDFeatureFile, "node-feature-discovery local feature file written by the nfd sink.")
+
+	placementNamespaces := flags.String("placement-namespaces", "", "Comma separated list of the namespaces whose pods NUMA placement is exported on /debug/placement, with --health-address. Use * for all the namespaces.\n Empty disables the export.")
+	flags.BoolVar(&pArgs.LocalArgs.Placement.Annotate, "placement-annotate", false, "Also annotate the pods with their NUMA placement, with --placement-namespaces.")
+
+	flags.BoolVar(&pArgs.LocalArgs.Events, "events", false, "Record Kubernetes Events about the zone capacity, the sysinfo fallback, the publish failures and the configuration reloads.\n Needs the api sink.")
+
+	flags.BoolVar(&pArgs.LocalArgs.Freshness.Enabled, "node-condition", false, "Maintain the TopologyInfoFresh node condition, used by the taint-controller subcommand. Needs the api sink.")
+	flags.DurationVar(&pArgs.LocalArgs.Freshness.HeartbeatInterval, "node-condition-heartbeat", time.Minute, "Maximum time between the node condition writes when nothing changes.")
+
+	flags.StringVar(&pArgs.LocalArgs.Health.Address, "health-address", "", "Address to serve /healthz, /readyz and the /debug/sysinfo, /debug/config, /debug/zones endpoints on, like :8081.\n /debug/placement and /debug/cpuaudit are served there too, if enabled. Empty disables the endpoints.")
+	flags.IntVar(&pArgs.LocalArgs.Health.Intervals, "health-intervals", 3, "Number of --sleep-interval periods without update triggers before /healthz fails,\n and without a successful scan and publish before /readyz fails.")
+	flags.BoolVar(&pArgs.LocalArgs.Health.PProf, "health-pprof", false, "Also serve the runtime profiles on /debug/pprof/, with --health-address.")
+
+	flags.StringVar(&pArgs.LocalArgs.Logging.Format, "log-format", logging.FormatText, "Format of the log lines on stderr. One of: text, json.")
+	logVerbosity := flags.String("log-verbosity", "", "Comma separated list of per component verbosity, overriding -v, like sysinfo=4,podrescompat=2.\n Components: "+strings.Join(logging.KnownComponents(), ", ")+".")
 
 	flags.BoolVar(&pArgs.Version, "version", false, "Output version and exit")
+	flags.BoolVar(&pArgs.PrintEffectiveConfig, "print-effective-config", false, "Print the flag values merged from the command line, the environment and the configuration file, then exit.")
+
+	if addFlags != nil {
+		addFlags(flags)
+	}
 
 	err := flags.Parse(args)
 	if err != nil {
 		return pArgs, err
 	}
 
+	sources := newFlagSources(flags)
+	if err := sources.applyEnv(flags, lookupEnv); err != nil {
+		return pArgs, err
+	}
+
 	if pArgs.Version {
 		return pArgs, err
 	}
 
+	pArgs.RTE.ConfigFile = configPath
+	conf, err := config.ReadConfig(configPath)
+	if err != nil {
+		return pArgs, fmt.Errorf("error getting exclude list from the configuration: %v", err)
+	}
+	confFlags, err := configFlagValues(conf)
+	if err != nil {
+		return pArgs, fmt.Errorf("invalid configuration file %q: %w", configPath, err)
+	}
+	if err := sources.applyConfig(flags, confFlags, configPath); err != nil {
+		return pArgs, err
+	}
+	pArgs.effective = sources.settings(flags)
+
+	switch pArgs.LocalArgs.StalePodsSource {
+	case stalepods.SourceNone, stalepods.SourceAPIServer, stalepods.SourceKubelet:
+	default:
+		return pArgs, fmt.Errorf("unsupported stale pods source: %q", pArgs.LocalArgs.StalePodsSource)
+	}
+
+	switch pArgs.NRTupdater.APIVersion {
+	case nrtupdater.APIVersionV1alpha1, nrtupdater.APIVersionV1alpha2, nrtupdater.APIVersionAuto:
+	default:
+		return pArgs, fmt.Errorf("unsupported NodeResourceTopology API version: %q", pArgs.NRTupdater.APIVersion)
+	}
+
+	switch pArgs.NRTupdater.ShutdownAction {
+	case nrtupdater.ShutdownKeep, nrtupdater.ShutdownMarkStale, nrtupdater.ShutdownDelete:
+	default:
+		return pArgs, fmt.Errorf("unsupported shutdown action: %q", pArgs.NRTupdater.ShutdownAction)
+	}
+
+	switch pArgs.NRTupdater.CRDPolicy {
+	case nrtupdater.CRDPolicyIgnore, nrtupdater.CRDPolicyWait, nrtupdater.CRDPolicyInstall:
+	default:
+		return pArgs, fmt.Errorf("unsupported CRD policy: %q", pArgs.NRTupdater.CRDPolicy)
+	}
+	// the embedded CRD serves only v1alpha1, the exporter would wait forever for v1alpha2
+	if pArgs.NRTupdater.CRDPolicy == nrtupdater.CRDPolicyInstall && pArgs.NRTupdater.APIVersion == nrtupdater.APIVersionV1alpha2 {
+		return pArgs, fmt.Errorf("the %s CRD policy cannot publish %s: the embedded CRD serves only %s", nrtupdater.CRDPolicyInstall, nrtupdater.APIVersionV1alpha2, nrtupdater.APIVersionV1alpha1)
+	}
+
+	switch pArgs.LocalArgs.SharedPool.Source {
+	case sharedpool.SourceReferenceContainer, sharedpool.SourceCgroup, sharedpool.SourceCPUManagerState:
+	default:
+		return pArgs, fmt.Errorf("unsupported shared pool source: %q", pArgs.LocalArgs.SharedPool.Source)
+	}
+	pArgs.LocalArgs.SharedPool.CgroupRoot = pArgs.LocalArgs.CPUAudit.CgroupRoot
+
+	pArgs.LocalArgs.Placement.Namespaces = setPlacementNamespaces(*placementNamespaces)
+
+	pArgs.LocalArgs.Logging.Verbosity, err = logging.ParseVerbosity(*logVerbosity)
+	if err != nil {
+		return pArgs, err
+	}
+	if err := pArgs.LocalArgs.Logging.Validate(); err != nil {
+		return pArgs, err
+	}
+
 	pArgs.RTE.KubeletStateDirs, err = setKubeletStateDirs(*kubeletStateDirs)
 	if err != nil {
 		return pArgs, err
@@ -160,24 +451,58 @@ func parseArgs(args ...string) (ProgArgs, error) {
 		pArgs.RTE.ReferenceContainer = podrescli.ContainerIdentFromEnv()
 	}
 
-	conf, err := config.ReadConfig(configPath)
-	if err != nil {
-		return pArgs, fmt.Errorf("error getting exclude list from the configuration: %v", err)
-	}
 	if len(conf.ExcludeList) != 0 {
 		pArgs.Resourcemonitor.ExcludeList.ExcludeList = conf.ExcludeList
 		klog.V(2).Infof("using exclude list:\n%s", pArgs.Resourcemonitor.ExcludeList.String())
 	}
 	pArgs.LocalArgs.SysConf = conf.Resources
-
-	// do not overwrite with empty an existing value (e.g. from opts)
-	if pArgs.RTE.TopologyManagerPolicy == "" {
-		pArgs.RTE.TopologyManagerPolicy = conf.TopologyManagerPolicy
+	pArgs.Sinks.Sinks, err = resolveSinks(*sinkNames)
+	if err != nil {
+		return pArgs, err
+	}
+	switch pArgs.Sinks.Format {
+	case sinks.FormatJSON, sinks.FormatYAML:
+	default:
+		return pArgs, fmt.Errorf("unsupported sink format: %q", pArgs.Sinks.Format)
+	}
+	if pArgs.Sinks.Has(sinks.SinkFile) && pArgs.Sinks.FilePath == "" {
+		return pArgs, fmt.Errorf("the file sink needs --sink-file")
+	}
+	if pArgs.LocalArgs.Health.Intervals < 1 {
+		return pArgs, fmt.Errorf("--health-intervals must be at least 1")
 	}
+	if pArgs.LocalArgs.Freshness.Enabled && !pArgs.Sinks.Has(sinks.SinkAPI) {
+		return pArgs, fmt.Errorf("the node condition needs the api sink")
+	}
+	// without the api sink the apiserver is not needed at all
+	if !pArgs.Sinks.Has(sinks.SinkAPI) {
+		pArgs.NRTupdater.NoPublish = true
+		pArgs.LocalArgs.Events = false
+	}
+	pArgs.LocalArgs.CPUAudit.ReservedCPUs = conf.Resources.ReservedCPUs
+	pArgs.LocalArgs.SharedPool.ReservedCPUs = conf.Resources.ReservedCPUs
 
 	return pArgs, nil
 }
 
+// resolveSinks defaults to the api sink
+func resolveSinks(flagValue string) ([]string, error) {
+	if flagValue != "" {
+		return sinks.Parse(flagValue)
+	}
+	return []string{sinks.SinkAPI}, nil
+}
+
+// metricsPort is the port the metrics server listens on, configured like the upstream exporter.
+// METRICS_HOST restricts the address it listens on, like 127.0.0.1 behind a proxy.
+func metricsPort() string {
+	port, ok := os.LookupEnv("METRICS_PORT")
+	if !ok {
+		port = "2112"
+	}
+	return port
+}
+
 func defaultHostName() string {
 	var err error
 
@@ -191,22 +516,6 @@ func defaultHostName() string {
 	return val
 }
 
-func defaultTopologyManagerPolicy() string {
-	if val, ok := os.LookupEnv("TOPOLOGY_MANAGER_POLICY"); ok {
-		return val
-	}
-	// empty string is a valid value here, so just keep going
-	return ""
-}
-
-func defaultTopologyManagerScope() string {
-	if val, ok := os.LookupEnv("TOPOLOGY_MANAGER_SCOPE"); ok {
-		return val
-	}
-	//https://kubernetes.io/docs/tasks/administer-cluster/topology-manager/#topology-manager-scopes
-	return "container"
-}
-
 func setKubeletStateDirs(value string) ([]string, error) {
 	ksd := make([]string, 0)
 	for _, s := range strings.Split(value, " ") {
@@ -215,6 +524,17 @@ func setKubeletStateDirs(value string) ([]string, error) {
 	return ksd, nil
 }
 
+func setPlacementNamespaces(value string) []string {
+	namespaces := []string{}
+	for _, ns := range strings.Split(value, ",") {
+		ns = strings.TrimSpace(ns)
+		if ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
+
 func setContainerIdent(value string) (*podrescli.ContainerIdent, error) {
 	ci, err := podrescli.ContainerIdentFromString(value)
 	if err != nil {
@@ -227,3 +547,83 @@ func setContainerIdent(value string) (*podrescli.ContainerIdent, error) {
 
 	return ci, nil
 }
+
+// newPodResourcesClient wraps the kubelet client with the sysinfo fallback, the shared pool filtering
+// and the stale allocations checking, as configured
+func newPodResourcesClient(kubeletCli podresourcesapi.PodResourcesListerClient, podSrc stalepods.PodSource, condChan chan<- corev1.PodCondition, pArgs ProgArgs, rec *events.Recorder) (podresourcesapi.PodResourcesListerClient, error) {
+	sysCli := kubeletCli
+	if !pArgs.LocalArgs.SysConf.IsEmpty() {
+		sysCli = podrescompat.NewSysinfoClientFromLister(kubeletCli, pArgs.LocalArgs.SysConf, rec)
+	}
+
+	detector, err := sharedpool.NewDetector(pArgs.LocalArgs.SharedPool, pArgs.RTE.ReferenceContainer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the shared pool detector: %w", err)
+	}
+	cli := sharedpool.NewFilteringClientFromLister(sysCli, pArgs.RTE.Debug, detector, pArgs.RTE.ReferenceContainer, condChan)
+
+	if pArgs.LocalArgs.StalePodsSource != stalepods.SourceNone {
+		cli = stalepods.NewCheckingClientFromLister(cli, podSrc, pArgs.LocalArgs.StalePods, rec)
+	}
+	return cli, nil
+}
+
+func newPlacementTrackingClient(ctx context.Context, cli podresourcesapi.PodResourcesListerClient, args placement.Args, sysfsRoot string) (*placement.TrackingClient, error) {
+	cpuToNUMA, err := placement.CPUToNUMA(sysfsRoot)
+	if err != nil {
+		return nil, err
+	}
+	var annotator *placement.Annotator
+	if args.Annotate {
+		cs, err := k8shelpers.GetK8sClient("")
+		if err != nil {
+			return nil, err
+		}
+		annotator = placement.NewAnnotator(placement.NewClientsetPatcher(cs))
+		annotator.Run(ctx.Done())
+	}
+	return placement.NewTrackingClient(cli, cpuToNUMA, args, annotator), nil
+}
+
+// newEventRecorder records the events also against the exporter pod, which is found like podreadiness does
+func newEventRecorder(ctx context.Context, nodeName string) (*events.Recorder, error) {
+	cs, err := k8shelpers.GetK8sClient("")
+	if err != nil {
+		return nil, err
+	}
+	self := podrescli.ContainerIdentFromEnv()
+	return events.NewRecorder(ctx, cs, nodeName, self.Namespace, self.PodName)
+}
+
+// newConditionChannel reports the local pod conditions, if the pod readiness is enabled. The update loop
+// and the podresources clients share it.
+func newConditionChannel(rteArgs resourcetopologyexporter.Args) chan corev1.PodCondition {
+	if !rteArgs.PodReadinessEnable {
+		return nil
+	}
+	condIn, err := podreadiness.NewConditionInjector()
+	if err != nil {
+		klog.Warningf("cannot report the pod conditions: %v", err)
+		return nil
+	}
+	condChan := make(chan corev1.PodCondition)
+	condIn.Run(condChan)
+	return condChan
+}
+
+// newPodSource learns the pods bound to the node, for the stale allocations checking and the cpuset audit
+// which share it. It prefers the kubelet read-only endpoint only if explicitly requested, otherwise it
+// watches the apiserver until ctx is done. Returns nil if nothing needs the pods.
+func newPodSource(ctx context.Context, lArgs localArgs, nodeName string) (stalepods.PodSource, error) {
+	if lArgs.StalePodsSource == stalepods.SourceNone && lArgs.CPUAudit.Interval <= 0 {
+		return nil, nil
+	}
+	if lArgs.StalePodsSource == stalepods.SourceKubelet {
+		return stalepods.NewKubeletPodSource(lArgs.KubeletReadOnlyURL), nil
+	}
+	cs, err := k8shelpers.GetK8sClient("")
+	if err != nil {
+		return nil, err
+	}
+	return stalepods.NewAPIServerPodSource(cs, nodeName, ctx.Done()), nil
+}
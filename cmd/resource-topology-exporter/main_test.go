@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -9,11 +11,22 @@ import (
 	"runtime"
 	"strings"
 	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
 
 	. "github.com/smartystreets/goconvey/convey"
 	. "github.com/stretchr/testify/suite"
 
+	"github.com/k8stopologyawareschedwg/noderesourcetopology-api/pkg/apis/topology/v1alpha1"
 	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/podrescli"
+	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/version"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/bundle"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/logging"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/nrtupdater"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/render"
 )
 
 const (
@@ -75,6 +88,194 @@ func (s *ArgsParseTestSuite) TestArgsParse() {
 			So(pArgs.RTE.ReferenceContainer, ShouldResemble, &podrescli.ContainerIdent{Namespace: "ns", PodName: "pod", ContainerName: "cont"})
 		})
 
+		Convey("must select the sinks", func() {
+			pArgs, err := parseArgs("--sinks=file, nfd", "--sink-file=/run/rte/topology.json")
+			So(err, ShouldBeNil)
+			So(pArgs.Sinks.Sinks, ShouldResemble, []string{"file", "nfd"})
+			So(pArgs.NRTupdater.NoPublish, ShouldBeTrue)
+
+			_, err = parseArgs("--sinks=api,carrier-pigeon")
+			So(err, ShouldNotBeNil)
+
+			_, err = parseArgs("--sinks=file")
+			So(err, ShouldNotBeNil)
+
+			_, err = parseArgs("--sinks=stdout", "--node-condition")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("must parse the dump flags on top of the exporter flags", func() {
+			pArgs, dArgs, err := parseDumpArgs("--output=yaml", "--raw", "--podreadiness")
+			So(err, ShouldBeNil)
+			So(dArgs, ShouldResemble, dumpArgs{Output: "yaml", Raw: true})
+			So(pArgs.RTE.PodReadinessEnable, ShouldBeFalse)
+
+			_, _, err = parseDumpArgs("--output=xml")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("must require the permissions of the enabled features", func() {
+			pArgs, dArgs, err := parseDiagnoseArgs("--output=json", "--node-condition", "--nrt-on-shutdown=delete")
+			So(err, ShouldBeNil)
+			So(dArgs.Output, ShouldEqual, "json")
+
+			required := []string{}
+			for _, attrs := range requiredPermissions(pArgs, "rte") {
+				required = append(required, attrs.Verb+" "+attrs.Resource+"/"+attrs.Subresource)
+			}
+			So(required, ShouldContain, "delete noderesourcetopologies/")
+			So(required, ShouldContain, "patch nodes/status")
+			So(required, ShouldContain, "update pods/status")
+
+			_, _, err = parseDiagnoseArgs("--output=yaml")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("must write a bundle even if the sources are unavailable", func() {
+			dir, err := ioutil.TempDir("", "must-gather")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+			configPath := filepath.Join(dir, "config.yaml")
+			err = ioutil.WriteFile(configPath, []byte("flags:\n  reference-container: rte/rte-pod/rte\n"), 0644)
+			So(err, ShouldBeNil)
+
+			pArgs, gArgs, err := parseMustGatherArgs("--config="+configPath, "--sinks=stdout", "--sysfs="+dir, "--kubelet-root-dir="+dir, "--podresources-socket=unix://"+dir+"/missing.sock", "--metrics-url=http://127.0.0.1:0/metrics")
+			So(err, ShouldBeNil)
+			So(gArgs.Redact, ShouldBeTrue)
+			So(gArgs.BundleFile, ShouldStartWith, "rte-must-gather-")
+
+			var buf bytes.Buffer
+			So(mustGather(context.Background(), &buf, pArgs, gArgs), ShouldBeNil)
+			bd, err := bundle.Read(&buf)
+			So(err, ShouldBeNil)
+			So(bd.Paths(), ShouldContain, bundle.PathArgs)
+			So(bd.Paths(), ShouldContain, bundle.PathConfig)
+			So(string(bd.Files[bundle.PathConfigFile]), ShouldEqual, "flags:\n  reference-container: "+bundle.Redacted+"\n")
+			So(bd.Paths(), ShouldNotContain, bundle.PathMetrics)
+
+			failed := []string{}
+			for _, entry := range bd.Manifest.Entries {
+				if entry.Error != "" {
+					failed = append(failed, entry.Path)
+				}
+			}
+			So(failed, ShouldContain, bundle.PathMetrics)
+			So(failed, ShouldContain, "kubelet/checkpoints/cpu_manager_state")
+		})
+
+		Convey("must take the render defaults from the profile", func() {
+			opts, err := parseRenderArgs("--profile", "vanilla", "--namespace=rte", "--notify-file=false")
+			So(err, ShouldBeNil)
+			So(opts.Profile, ShouldEqual, render.ProfileVanilla)
+			So(opts.ProxyImage, ShouldEqual, render.DefaultOptions(render.ProfileVanilla).ProxyImage)
+			So(opts.Namespace, ShouldEqual, "rte")
+			So(opts.NotifyFile, ShouldBeFalse)
+			So(opts.Config, ShouldBeEmpty)
+
+			opts, err = parseRenderArgs()
+			So(err, ShouldBeNil)
+			So(opts, ShouldResemble, render.DefaultOptions(render.ProfileOpenShift))
+		})
+
+		Convey("must merge the flags from the command line, the environment and the configuration file", func() {
+			dir, err := ioutil.TempDir("", "options")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+			configPath := filepath.Join(dir, "config.yaml")
+			err = ioutil.WriteFile(configPath, []byte("flags:\n  sleep-interval: 5s\n  notify-file: /run/rte/notify\n  podreadiness: false\n  health-intervals: 5\n"), 0644)
+			So(err, ShouldBeNil)
+
+			env := map[string]string{
+				"RTE_SLEEP_INTERVAL": "7s",
+				"RTE_NOTIFY_FILE":    "/run/env/notify",
+			}
+			lookupEnv := func(key string) (string, bool) {
+				val, ok := env[key]
+				return val, ok
+			}
+			parseArgsWithEnv := func(args ...string) (ProgArgs, error) {
+				return parseCommandArgsFromEnv(version.ProgramName, nil, lookupEnv, args...)
+			}
+
+			pArgs, err := parseArgsWithEnv("--config="+configPath, "--notify-file=/run/flag/notify")
+			So(err, ShouldBeNil)
+			So(pArgs.RTE.NotifyFilePath, ShouldEqual, "/run/flag/notify")
+			So(pArgs.RTE.SleepInterval, ShouldEqual, 7*time.Second)
+			So(pArgs.RTE.PodReadinessEnable, ShouldBeFalse)
+			So(pArgs.LocalArgs.Health.Intervals, ShouldEqual, 5)
+
+			var sb strings.Builder
+			So(writeEffectiveConfig(&sb, pArgs.effective), ShouldBeNil)
+			So(sb.String(), ShouldStartWith, "flags:\n")
+			So(sb.String(), ShouldContainSubstring, `  notify-file: "/run/flag/notify" # flag`)
+			So(sb.String(), ShouldContainSubstring, `  sleep-interval: "7s" # env RTE_SLEEP_INTERVAL`)
+			So(sb.String(), ShouldContainSubstring, `  podreadiness: "false" # config `+configPath)
+			So(sb.String(), ShouldContainSubstring, `  oneshot: "false" # default`)
+			So(sb.String(), ShouldNotContainSubstring, "print-effective-config")
+
+			err = ioutil.WriteFile(configPath, []byte("sinks: [stdout]\ntopologymanagerpolicy: restricted\n"), 0644)
+			So(err, ShouldBeNil)
+			pArgs, err = parseArgsWithEnv("--config=" + configPath)
+			So(err, ShouldBeNil)
+			So(pArgs.Sinks.Sinks, ShouldResemble, []string{"stdout"})
+			So(pArgs.RTE.TopologyManagerPolicy, ShouldEqual, "restricted")
+
+			env["RTE_SINKS"] = "file"
+			env["RTE_SINK_FILE"] = "/run/rte/topology.json"
+			pArgs, err = parseArgsWithEnv("--config=" + configPath)
+			So(err, ShouldBeNil)
+			So(pArgs.Sinks.Sinks, ShouldResemble, []string{"file"})
+			delete(env, "RTE_SINKS")
+
+			// the legacy environment still wins over the configuration file, but not over RTE_
+			env["TOPOLOGY_MANAGER_POLICY"] = "single-numa-node"
+			pArgs, err = parseArgsWithEnv("--config=" + configPath)
+			So(err, ShouldBeNil)
+			So(pArgs.RTE.TopologyManagerPolicy, ShouldEqual, "single-numa-node")
+			env["RTE_TOPOLOGY_MANAGER_POLICY"] = "best-effort"
+			pArgs, err = parseArgsWithEnv("--config=" + configPath)
+			So(err, ShouldBeNil)
+			So(pArgs.RTE.TopologyManagerPolicy, ShouldEqual, "best-effort")
+			delete(env, "TOPOLOGY_MANAGER_POLICY")
+			delete(env, "RTE_TOPOLOGY_MANAGER_POLICY")
+
+			err = ioutil.WriteFile(configPath, []byte("sinks: [stdout]\nflags:\n  sinks: file\n"), 0644)
+			So(err, ShouldBeNil)
+			_, err = parseArgsWithEnv("--config=" + configPath)
+			So(err, ShouldNotBeNil)
+
+			err = ioutil.WriteFile(configPath, []byte("flags:\n  sleep-intervall: 5s\n"), 0644)
+			So(err, ShouldBeNil)
+			_, err = parseArgsWithEnv("--config=" + configPath)
+			So(err, ShouldNotBeNil)
+
+			env["RTE_SLEEP_INTERVAL"] = "often"
+			_, err = parseArgsWithEnv()
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("must not install the CRD for an API version it does not serve", func() {
+			_, err := parseArgs("--nrt-crd-policy=install", "--nrt-api-version=v1alpha2")
+			So(err, ShouldNotBeNil)
+
+			pArgs, err := parseArgs("--nrt-crd-policy=install", "--nrt-api-version=auto")
+			So(err, ShouldBeNil)
+			So(pArgs.NRTupdater.CRDPolicy, ShouldEqual, nrtupdater.CRDPolicyInstall)
+		})
+
+		Convey("must validate the logging flags", func() {
+			pArgs, err := parseArgs("--log-format=json", "--log-verbosity=sysinfo=4,podrescompat=1")
+			So(err, ShouldBeNil)
+			So(pArgs.LocalArgs.Logging.Format, ShouldEqual, logging.FormatJSON)
+			So(pArgs.LocalArgs.Logging.Verbosity, ShouldResemble, map[string]int{"sysinfo": 4, "podrescompat": 1})
+
+			_, err = parseArgs("--log-format=xml")
+			So(err, ShouldNotBeNil)
+
+			_, err = parseArgs("--log-verbosity=nonexistent=2")
+			So(err, ShouldNotBeNil)
+		})
+
 		Convey("should have the following default values", func() {
 			pArgs, err := parseArgs()
 			So(err, ShouldBeNil)
@@ -96,3 +297,54 @@ func (s *ArgsParseTestSuite) TestArgsParse() {
 		})
 	})
 }
+
+func TestWriteDumpTable(t *testing.T) {
+	numa0 := &podresourcesapi.TopologyInfo{Nodes: []*podresourcesapi.NUMANode{{ID: 0}}}
+	out := dumpOutput{
+		Zones: v1alpha1.ZoneList{
+			{
+				Name: "node-0",
+				Type: "Node",
+				Resources: v1alpha1.ResourceInfoList{
+					{Name: "cpu", Capacity: resource.MustParse("8"), Allocatable: resource.MustParse("6"), Available: resource.MustParse("4")},
+				},
+			},
+		},
+		PodResources: &rawPodResources{
+			Allocatable: &podresourcesapi.AllocatableResourcesResponse{
+				CpuIds:  []int64{1, 2, 3, 5},
+				Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "example.com/nic", DeviceIds: []string{"a", "b"}, Topology: numa0}},
+			},
+			List: &podresourcesapi.ListPodResourcesResponse{
+				PodResources: []*podresourcesapi.PodResources{
+					{
+						Namespace: "ns",
+						Name:      "pod",
+						Containers: []*podresourcesapi.ContainerResources{
+							{Name: "cnt", CpuIds: []int64{1, 2}, Memory: []*podresourcesapi.ContainerMemory{{MemoryType: "memory", Size_: 1024, Topology: numa0}}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	var sb strings.Builder
+	if err := writeDumpTable(&sb, out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `ZONE    TYPE  RESOURCE  CAPACITY  ALLOCATABLE  AVAILABLE
+node-0  Node  cpu       8         6            4
+
+RESOURCE         NUMA  ALLOCATABLE
+cpu              -     1-3,5
+example.com/nic  0     a,b
+
+NAMESPACE  POD  CONTAINER  RESOURCE  NUMA  ALLOCATED
+ns         pod  cnt        cpu       -     1-2
+ns         pod  cnt        memory    0     1024
+`
+	if sb.String() != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", sb.String(), expected)
+	}
+}
@@ -0,0 +1,326 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"k8s.io/klog/v2"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+
+	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/version"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/bundle"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/config"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/logging"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/nrtupdater"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/podrescompat"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/sysinfo"
+)
+
+const (
+	mustGatherCommand = "must-gather"
+
+	mustGatherTimeout = 10 * time.Second
+)
+
+var (
+	// kubeletCheckpoints are relative to the kubelet root directory
+	kubeletCheckpoints = []string{
+		"cpu_manager_state",
+		"memory_manager_state",
+		"dra_manager_state",
+		"device-plugins/kubelet_internal_checkpoint",
+	}
+	// sysfsPatterns are relative to the sysfs root, and cover what sysinfo and the resource monitor read
+	sysfsPatterns = []string{
+		"devices/system/cpu/online",
+		"devices/system/node/online",
+		"devices/system/node/node*/cpulist",
+		"devices/system/node/node*/distance",
+		"devices/system/node/node*/meminfo",
+		"devices/system/node/node*/hugepages/hugepages-*/nr_hugepages",
+		"bus/pci/devices/*/class",
+		"bus/pci/devices/*/vendor",
+		"bus/pci/devices/*/device",
+		"bus/pci/devices/*/numa_node",
+	}
+)
+
+type mustGatherArgs struct {
+	BundleFile     string
+	Redact         bool
+	KubeletRootDir string
+	MetricsURL     string
+}
+
+func parseMustGatherArgs(args ...string) (ProgArgs, mustGatherArgs, error) {
+	gArgs := mustGatherArgs{}
+	pArgs, err := parseCommandArgs(mustGatherCommand, func(flags *flag.FlagSet) {
+		flags.StringVar(&gArgs.BundleFile, "bundle-file", "", "Path of the bundle tarball. Use - for stdout.\n Defaults to rte-must-gather-<hostname>-<timestamp>.tar.gz in the current directory.")
+		flags.BoolVar(&gArgs.Redact, "redact", true, "Replace the pod namespaces and names with pseudonyms, and drop the kubelet credentials, the device plugin allocations and the pod names in the configuration file.")
+		flags.StringVar(&gArgs.KubeletRootDir, "kubelet-root-dir", "/var/lib/kubelet", "Kubelet root directory, holding the resource managers checkpoints.")
+		flags.StringVar(&gArgs.MetricsURL, "metrics-url", defaultMetricsURL(), "URL of the metrics of the running exporter.")
+	}, args...)
+	if err != nil {
+		return pArgs, gArgs, err
+	}
+	if gArgs.BundleFile == "" {
+		gArgs.BundleFile = fmt.Sprintf("rte-must-gather-%s-%s.tar.gz", pArgs.NRTupdater.Hostname, time.Now().UTC().Format("20060102150405"))
+	}
+	return pArgs, gArgs, nil
+}
+
+// defaultMetricsURL follows the port the metrics server listens on
+func defaultMetricsURL() string {
+	return fmt.Sprintf("http://127.0.0.1:%s/metrics", metricsPort())
+}
+
+// runMustGather writes the support bundle. The data which cannot be collected is listed in the bundle manifest.
+func runMustGather(args ...string) int {
+	pArgs, gArgs, err := parseMustGatherArgs(args...)
+	if err != nil {
+		klog.Errorf("failed to parse args: %v", err)
+		return 1
+	}
+	if err := logging.Setup(pArgs.LocalArgs.Logging, pArgs.NRTupdater.Hostname); err != nil {
+		klog.Errorf("failed to set up the logging: %v", err)
+		return 1
+	}
+
+	var out io.Writer = os.Stdout
+	if gArgs.BundleFile != "-" {
+		f, err := os.Create(gArgs.BundleFile)
+		if err != nil {
+			klog.Errorf("failed to create the bundle: %v", err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if err := mustGather(context.Background(), out, pArgs, gArgs); err != nil {
+		klog.Errorf("failed to write the bundle: %v", err)
+		return 1
+	}
+	if gArgs.BundleFile != "-" {
+		klog.Infof("bundle written to %s", gArgs.BundleFile)
+	}
+	return 0
+}
+
+func mustGather(ctx context.Context, out io.Writer, pArgs ProgArgs, gArgs mustGatherArgs) error {
+	gt := gatherer{
+		pArgs: pArgs,
+		gArgs: gArgs,
+		rd:    bundle.NewRedactor(gArgs.Redact),
+		bw: bundle.NewWriter(out, bundle.Manifest{
+			NodeName:  pArgs.NRTupdater.Hostname,
+			Version:   version.Get(),
+			CreatedAt: time.Now().UTC(),
+			Redacted:  gArgs.Redact,
+		}),
+	}
+	for _, collect := range []func(ctx context.Context) error{
+		gt.addArgs,
+		gt.addConfig,
+		gt.addSysInfo,
+		gt.addPodResources,
+		gt.addKubeletFiles,
+		gt.addSysfs,
+		gt.addNodeResourceTopology,
+		gt.addMetrics,
+	} {
+		if err := collect(ctx); err != nil {
+			return err
+		}
+	}
+	return gt.bw.Close()
+}
+
+// gatherer collects the files of the bundle. Its methods fail only if the bundle cannot be written.
+type gatherer struct {
+	pArgs ProgArgs
+	gArgs mustGatherArgs
+	rd    bundle.Redactor
+	bw    *bundle.Writer
+}
+
+func (gt gatherer) addArgs(ctx context.Context) error {
+	pArgs := gt.pArgs
+	pArgs.RTE.ReferenceContainer = gt.rd.ContainerIdent(pArgs.RTE.ReferenceContainer)
+	data, err := pArgs.ToJson()
+	return gt.bw.Add(bundle.PathArgs, "", data, err)
+}
+
+// addConfig adds both the configuration file, redacted like the args, and the configuration merged with the flags
+func (gt gatherer) addConfig(ctx context.Context) error {
+	conf := config.Config{
+		ExcludeList:           gt.pArgs.Resourcemonitor.ExcludeList.ExcludeList,
+		Resources:             gt.pArgs.LocalArgs.SysConf,
+		TopologyManagerPolicy: gt.pArgs.RTE.TopologyManagerPolicy,
+		TopologyManagerScope:  gt.pArgs.RTE.TopologyManagerScope,
+		Sinks:                 gt.pArgs.Sinks.Sinks,
+	}
+	if err := gt.addJSON(bundle.PathConfig, "", conf, nil); err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(gt.pArgs.RTE.ConfigFile)
+	if err == nil {
+		data, err = gt.rd.YAML(data, bundle.ConfigFileSensitiveKeys)
+	}
+	return gt.add(bundle.PathConfigFile, gt.pArgs.RTE.ConfigFile, data, err)
+}
+
+func (gt gatherer) addSysInfo(ctx context.Context) error {
+	sysInfo, err := sysinfo.NewSysinfo(gt.pArgs.LocalArgs.SysConf)
+	return gt.addJSON(bundle.PathSysInfo, "", sysInfo, err)
+}
+
+// addPodResources adds the kubelet responses, before any filtering
+func (gt gatherer) addPodResources(ctx context.Context) error {
+	source := gt.pArgs.RTE.PodResourcesSocketPath
+	cli, err := podrescompat.NewCompatClient(source)
+	if err != nil {
+		if err := gt.add(bundle.PathAllocatableResources, source, nil, err); err != nil {
+			return err
+		}
+		return gt.add(bundle.PathListPodResources, source, nil, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mustGatherTimeout)
+	defer cancel()
+
+	allocResp, err := cli.GetAllocatableResources(ctx, &podresourcesapi.AllocatableResourcesRequest{})
+	if err := gt.addJSON(bundle.PathAllocatableResources, source, allocResp, err); err != nil {
+		return err
+	}
+	listResp, err := cli.List(ctx, &podresourcesapi.ListPodResourcesRequest{})
+	gt.rd.ListPodResources(listResp)
+	return gt.addJSON(bundle.PathListPodResources, source, listResp, err)
+}
+
+func (gt gatherer) addKubeletFiles(ctx context.Context) error {
+	if source := gt.pArgs.RTE.KubeletConfigFile; source != "" {
+		data, err := ioutil.ReadFile(source)
+		if err == nil {
+			data, err = gt.rd.YAML(data, bundle.KubeletConfigSensitiveKeys)
+		}
+		if err := gt.add(bundle.PathKubeletConfig, source, data, err); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range kubeletCheckpoints {
+		source := filepath.Join(gt.gArgs.KubeletRootDir, name)
+		data, err := ioutil.ReadFile(source)
+		if err == nil {
+			data, err = gt.rd.JSON(data, bundle.CheckpointSensitiveKeys)
+		}
+		if err := gt.add(filepath.ToSlash(filepath.Join(bundle.PathKubeletCheckpointsDir, name)), source, data, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addSysfs keeps the layout of sysfs, so the bundle can stand in for it
+func (gt gatherer) addSysfs(ctx context.Context) error {
+	root := gt.pArgs.Resourcemonitor.SysfsRoot
+	sources := []string{}
+	for _, pattern := range sysfsPatterns {
+		matches, err := filepath.Glob(filepath.Join(root, pattern))
+		if err != nil {
+			return err
+		}
+		sources = append(sources, matches...)
+	}
+	sort.Strings(sources)
+
+	for _, source := range sources {
+		rel, err := filepath.Rel(root, source)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(source)
+		if err := gt.add(filepath.ToSlash(filepath.Join(bundle.PathSysfsDir, rel)), source, data, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (gt gatherer) addNodeResourceTopology(ctx context.Context) error {
+	if gt.pArgs.NRTupdater.NoPublish {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, mustGatherTimeout)
+	defer cancel()
+
+	obj, err := nrtupdater.GetObject(ctx, gt.pArgs.NRTupdater)
+	if err != nil {
+		return gt.add(bundle.PathNodeResourceTopology, "", nil, err)
+	}
+	return gt.addJSON(bundle.PathNodeResourceTopology, "", obj.Object, nil)
+}
+
+func (gt gatherer) addMetrics(ctx context.Context) error {
+	source := gt.gArgs.MetricsURL
+	data, err := getURL(ctx, source)
+	return gt.add(bundle.PathMetrics, source, data, err)
+}
+
+// add logs the collection errors, which are also recorded in the bundle manifest
+func (gt gatherer) add(filePath, source string, data []byte, err error) error {
+	if err != nil {
+		klog.Warningf("cannot collect %s: %v", filePath, err)
+	}
+	return gt.bw.Add(filePath, source, data, err)
+}
+
+func (gt gatherer) addJSON(filePath, source string, v interface{}, err error) error {
+	if err != nil {
+		klog.Warningf("cannot collect %s: %v", filePath, err)
+	}
+	return gt.bw.AddJSON(filePath, source, v, err)
+}
+
+func getURL(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, mustGatherTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status from %q: %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
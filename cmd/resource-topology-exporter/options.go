@@ -0,0 +1,210 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/config"
+)
+
+// Every flag can also be set from an environment variable and from the flags section of the configuration file.
+// The precedence, from the highest:
+//  1. the command line
+//  2. the RTE_ prefixed environment variable: --sleep-interval is RTE_SLEEP_INTERVAL,
+//     then the legacy TOPOLOGY_MANAGER_POLICY and TOPOLOGY_MANAGER_SCOPE
+//  3. the flags section of the configuration file: sleep-interval: 10s
+//  4. the other legacy environment variables, like NODE_NAME, and the built-in default
+// The dedicated keys of the configuration file mirroring a flag, sinks, topologymanagerpolicy and topologymanagerscope,
+// count as the flags section, which cannot set the same flag again.
+
+const envVarPrefix = "RTE_"
+
+// legacyEnvVars are read when the RTE_ variable of the flag is not set. They always took precedence
+// over the dedicated keys of the configuration file, so they still do.
+var legacyEnvVars = map[string]string{
+	"topology-manager-policy": "TOPOLOGY_MANAGER_POLICY",
+	"topology-manager-scope":  "TOPOLOGY_MANAGER_SCOPE",
+}
+
+const (
+	sourceDefault = "default"
+	sourceFlag    = "flag"
+	sourceEnv     = "env"
+	sourceConfig  = "config"
+)
+
+// flagSetting is the effective value of a flag and where it comes from
+type flagSetting struct {
+	Name   string
+	Value  string
+	Source string
+}
+
+// flagSources tracks where each flag not left to the default was set from
+type flagSources map[string]string
+
+func newFlagSources(flags *flag.FlagSet) flagSources {
+	sources := flagSources{}
+	flags.Visit(func(f *flag.Flag) {
+		sources[f.Name] = sourceFlag
+	})
+	return sources
+}
+
+// envVarName maps the flag to its environment variable
+func envVarName(flagName string) string {
+	return envVarPrefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(flagName))
+}
+
+// applyEnv sets the flags not given on the command line from their environment variable
+func (sources flagSources) applyEnv(flags *flag.FlagSet, lookupEnv func(key string) (string, bool)) error {
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		if err != nil || sources[f.Name] != "" {
+			return
+		}
+		name := envVarName(f.Name)
+		val, ok := lookupEnv(name)
+		if !ok && legacyEnvVars[f.Name] != "" {
+			name = legacyEnvVars[f.Name]
+			val, ok = lookupEnv(name)
+		}
+		if !ok {
+			return
+		}
+		if setErr := flags.Set(f.Name, val); setErr != nil {
+			err = fmt.Errorf("invalid value %q of %s: %w", val, name, setErr)
+			return
+		}
+		sources[f.Name] = sourceEnv + " " + name
+	})
+	return err
+}
+
+// configFlagValues folds the dedicated keys of the configuration file into its flags section
+func configFlagValues(conf config.Config) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(conf.Flags))
+	for name, val := range conf.Flags {
+		values[name] = val
+	}
+	dedicated := map[string]interface{}{}
+	if conf.TopologyManagerPolicy != "" {
+		dedicated["topology-manager-policy"] = conf.TopologyManagerPolicy
+	}
+	if conf.TopologyManagerScope != "" {
+		dedicated["topology-manager-scope"] = conf.TopologyManagerScope
+	}
+	if len(conf.Sinks) > 0 {
+		dedicated["sinks"] = strings.Join(conf.Sinks, ",")
+	}
+	for name, val := range dedicated {
+		if _, ok := values[name]; ok {
+			return nil, fmt.Errorf("%q is set both by its dedicated key and in the flags section", name)
+		}
+		values[name] = val
+	}
+	return values, nil
+}
+
+// applyConfig sets the flags still unset from the flags section of the configuration file
+func (sources flagSources) applyConfig(flags *flag.FlagSet, values map[string]interface{}, configPath string) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if flags.Lookup(name) == nil {
+			return fmt.Errorf("unknown flag %q in the configuration file %q", name, configPath)
+		}
+		if name == "config" {
+			return fmt.Errorf("the configuration file %q cannot set its own path", configPath)
+		}
+		if sources[name] != "" {
+			continue
+		}
+		val, err := configFlagValue(values[name])
+		if err != nil {
+			return fmt.Errorf("invalid value of %q in the configuration file %q: %w", name, configPath, err)
+		}
+		if err := flags.Set(name, val); err != nil {
+			return fmt.Errorf("invalid value %q of %q in the configuration file %q: %w", val, name, configPath, err)
+		}
+		sources[name] = sourceConfig + " " + configPath
+	}
+	return nil
+}
+
+// configFlagValue takes the YAML scalars as they would be written on the command line
+func configFlagValue(v interface{}) (string, error) {
+	switch val := v.(type) {
+	case string:
+		return val, nil
+	case bool:
+		return strconv.FormatBool(val), nil
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), nil
+	case nil:
+		return "", nil
+	}
+	return "", fmt.Errorf("expected a scalar, got %T", v)
+}
+
+// settings lists the effective value of all the flags, sorted by name
+func (sources flagSources) settings(flags *flag.FlagSet) []flagSetting {
+	settings := []flagSetting{}
+	flags.VisitAll(func(f *flag.Flag) {
+		source := sources[f.Name]
+		if source == "" {
+			source = sourceDefault
+		}
+		settings = append(settings, flagSetting{
+			Name:   f.Name,
+			Value:  f.Value.String(),
+			Source: source,
+		})
+	})
+	return settings
+}
+
+// writeEffectiveConfig writes the settings as the flags section of a configuration file, commented with their source
+func writeEffectiveConfig(w io.Writer, settings []flagSetting) error {
+	if _, err := fmt.Fprintln(w, "flags:"); err != nil {
+		return err
+	}
+	for _, setting := range settings {
+		switch setting.Name {
+		case "config", "print-effective-config", "version":
+			continue
+		}
+		// a JSON string is a valid YAML double quoted scalar
+		val, err := json.Marshal(setting.Value)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "  %s: %s # %s\n", setting.Name, val, setting.Source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/render"
+)
+
+const renderCommand = "render"
+
+func parseRenderArgs(args ...string) (render.Options, error) {
+	// the profile drives the defaults of the other flags, so it must be known before they are registered
+	profile := render.ProfileOpenShift
+	for idx, arg := range args {
+		name := strings.TrimLeft(arg, "-")
+		if strings.HasPrefix(name, "profile=") {
+			profile = strings.TrimPrefix(name, "profile=")
+		} else if name == "profile" && idx+1 < len(args) {
+			profile = args[idx+1]
+		}
+	}
+	opts := render.DefaultOptions(profile)
+	var configFile string
+
+	flags := flag.NewFlagSet(renderCommand, flag.ExitOnError)
+	klog.InitFlags(flags)
+
+	flags.StringVar(&opts.Profile, "profile", opts.Profile, "Deployment profile. One of: openshift, vanilla.")
+	flags.StringVar(&opts.Namespace, "namespace", opts.Namespace, "Namespace to deploy the exporter in.")
+	flags.StringVar(&opts.Image, "image", opts.Image, "Exporter container image.")
+	flags.DurationVar(&opts.PollInterval, "poll-interval", opts.PollInterval, "Value of the exporter --sleep-interval flag.")
+	flags.IntVar(&opts.Verbosity, "verbosity", opts.Verbosity, "Log verbosity of the exporter.")
+	flags.IntVar(&opts.MetricsPort, "metrics-port", opts.MetricsPort, "Port the exporter serves the metrics on.")
+	flags.StringVar(&opts.TopologyManagerPolicy, "topology-manager-policy", opts.TopologyManagerPolicy, "Value of the exporter --topology-manager-policy flag. Empty to let the exporter detect it.")
+	flags.StringVar(&opts.TopologyManagerScope, "topology-manager-scope", opts.TopologyManagerScope, "Value of the exporter --topology-manager-scope flag. Empty to let the exporter detect it.")
+	flags.BoolVar(&opts.NotifyFile, "notify-file", opts.NotifyFile, "Mount the host notification directory and watch the notify file.")
+	flags.BoolVar(&opts.ReferenceContainer, "reference-container", opts.ReferenceContainer, "Add the reference container sidecar.")
+	flags.StringVar(&opts.ReferenceContainerImage, "reference-container-image", opts.ReferenceContainerImage, "Reference container sidecar image.")
+	flags.StringVar(&configFile, "config-file", "", "Exporter configuration file to ship in the config ConfigMap. Empty to skip the ConfigMap.")
+	flags.BoolVar(&opts.MetricsTLS, "metrics-tls", opts.MetricsTLS, "Serve the metrics through a kube-rbac-proxy sidecar over TLS.")
+	flags.StringVar(&opts.ProxyImage, "proxy-image", opts.ProxyImage, "kube-rbac-proxy sidecar image.")
+	flags.BoolVar(&opts.NodeCondition, "node-condition", opts.NodeCondition, "Let the exporter report its node condition.")
+	flags.BoolVar(&opts.CRD, "crd", opts.CRD, "Include the NodeResourceTopology CRD.")
+	flags.StringVar(&opts.CRDPolicy, "crd-policy", opts.CRDPolicy, "Value of the exporter --nrt-crd-policy flag. Empty to keep the exporter default. install also grants the creation of the CRD.")
+	flags.IntVar(&opts.HealthPort, "health-port", opts.HealthPort, "Port of the exporter health checks, probed by the kubelet, and debug endpoints. 0 disables them.")
+	flags.StringVar(&opts.PlacementNamespaces, "placement-namespaces", opts.PlacementNamespaces, "Value of the exporter --placement-namespaces flag, served on --health-port. Empty disables the placement.")
+	flags.BoolVar(&opts.PlacementAnnotate, "placement-annotate", opts.PlacementAnnotate, "Let the exporter annotate the pods with their placement, with --placement-namespaces.")
+
+	if err := flags.Parse(args); err != nil {
+		return opts, err
+	}
+	if configFile != "" {
+		data, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			return opts, err
+		}
+		opts.Config = string(data)
+	}
+	return opts, nil
+}
+
+// runRender writes the deployment manifests on stdout
+func runRender(args ...string) int {
+	opts, err := parseRenderArgs(args...)
+	if err != nil {
+		klog.Errorf("failed to parse args: %v", err)
+		return 1
+	}
+
+	mf, err := render.Render(opts)
+	if err != nil {
+		klog.Errorf("failed to render the manifests: %v", err)
+		return 1
+	}
+	if err := mf.WriteYAML(os.Stdout); err != nil {
+		klog.Errorf("failed to write the manifests: %v", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,80 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/freshness"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/k8shelpers"
+)
+
+const taintControllerCommand = "taint-controller"
+
+func parseTaintControllerArgs(args ...string) (freshness.ControllerArgs, error) {
+	ctrlArgs := freshness.ControllerArgs{}
+
+	flags := flag.NewFlagSet(taintControllerCommand, flag.ExitOnError)
+	klog.InitFlags(flags)
+
+	flags.DurationVar(&ctrlArgs.StalenessThreshold, "staleness-threshold", 5*time.Minute, "How long the TopologyInfoFresh node condition can be false or without heartbeats before tainting the node.\n Must be longer than the exporter --node-condition-heartbeat and --sleep-interval.")
+	flags.DurationVar(&ctrlArgs.ResyncInterval, "resync-interval", 30*time.Second, "Time between the checks of the nodes.")
+	flags.BoolVar(&ctrlArgs.DryRun, "dry-run", false, "Only report the taint changes.")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return ctrlArgs, err
+	}
+	if ctrlArgs.StalenessThreshold <= 0 || ctrlArgs.ResyncInterval <= 0 {
+		return ctrlArgs, fmt.Errorf("the staleness threshold and the resync interval must be positive")
+	}
+	return ctrlArgs, nil
+}
+
+// runTaintController taints with NoSchedule the nodes whose topology data is stale, until terminated.
+// It needs to get, list and update the nodes, so it is meant to run as a single replica deployment.
+func runTaintController(args ...string) int {
+	ctrlArgs, err := parseTaintControllerArgs(args...)
+	if err != nil {
+		klog.Errorf("failed to parse args: %v", err)
+		return 1
+	}
+
+	cs, err := k8shelpers.GetK8sClient("")
+	if err != nil {
+		klog.Errorf("failed to create the kubernetes client: %v", err)
+		return 1
+	}
+
+	stopCh := make(chan struct{})
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-sigCh
+		klog.Infof("received signal %v, shutting down", sig)
+		close(stopCh)
+	}()
+
+	klog.Infof("tainting the nodes with stale topology data after %v", ctrlArgs.StalenessThreshold)
+	freshness.NewController(freshness.NewClientsetNodeClient(cs), ctrlArgs).Run(stopCh)
+	return 0
+}
@@ -4,7 +4,16 @@ DIRNAME="$(dirname "$(readlink -f "$0")")"
 REPOOWNER=${REPOOWNER:-openshift-kni}
 IMAGENAME=${IMAGENAME:-resource-topology-exporter}
 IMAGETAG=${IMAGETAG:-4.9-snapshot}
-export RTE_CONTAINER_IMAGE=${RTE_CONTAINER_IMAGE:-quay.io/${REPOOWNER}/${IMAGENAME}:${IMAGETAG}}
-export RTE_POLL_INTERVAL="${RTE_POLL_INTERVAL:-10s}"
-export METRICS_PORT="${METRICS_PORT:-2112}"
-envsubst < "${DIRNAME}"/../manifests/openshift-resource-topology-exporter-ds.yaml
+RTE_CONTAINER_IMAGE=${RTE_CONTAINER_IMAGE:-quay.io/${REPOOWNER}/${IMAGENAME}:${IMAGETAG}}
+RTE_NAMESPACE="${RTE_NAMESPACE:-resource-topology-exporter}"
+RTE_POLL_INTERVAL="${RTE_POLL_INTERVAL:-10s}"
+METRICS_PORT="${METRICS_PORT:-2112}"
+cd "${DIRNAME}"/.. && go run ./cmd/resource-topology-exporter render \
+	--profile="${RTE_PROFILE:-openshift}" \
+	--namespace="${RTE_NAMESPACE}" \
+	--image="${RTE_CONTAINER_IMAGE}" \
+	--poll-interval="${RTE_POLL_INTERVAL}" \
+	--metrics-port="${METRICS_PORT}" \
+	--topology-manager-policy="${TOPOLOGY_MANAGER_POLICY}" \
+	--topology-manager-scope="${TOPOLOGY_MANAGER_SCOPE}" \
+	--verbosity=5
@@ -34,14 +34,10 @@ EOF
 RTE_CONTAINER_IMAGE=${RTE_CONTAINER_IMAGE} \
 RTE_POLL_INTERVAL=10s \
 RTE_NAMESPACE=${RTE_NAMESPACE} \
-RTE_CONFIG_FILE=/etc/resource-topology-exporter/config.yaml \
 TOPOLOGY_MANAGER_POLICY=single-numa-node \
 TOPOLOGY_MANAGER_SCOPE=container \
 make gen-manifests | tee rte.yaml
 
-echo "Create CRD"
-$OC_TOOL create -f manifests/crd.yaml
-
 echo "Deploy RTE"
 $OC_TOOL adm policy add-scc-to-user privileged system:serviceaccount:"$RTE_NAMESPACE":rte-account
 $OC_TOOL create -f rte.yaml
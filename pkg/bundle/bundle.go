@@ -0,0 +1,207 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"time"
+)
+
+const (
+	// FormatVersion changes when the layout of the bundle breaks the readers
+	FormatVersion = 1
+
+	ManifestPath = "manifest.json"
+)
+
+// Well known paths. The podresources responses use the same JSON as the dump subcommand.
+const (
+	PathArgs                  = "args.json"
+	PathConfig                = "config/effective.json"
+	PathConfigFile            = "config/config.yaml"
+	PathSysInfo               = "sysinfo.json"
+	PathAllocatableResources  = "podresources/allocatable.json"
+	PathListPodResources      = "podresources/list.json"
+	PathKubeletConfig         = "kubelet/config.yaml"
+	PathKubeletCheckpointsDir = "kubelet/checkpoints"
+	PathSysfsDir              = "sysfs"
+	PathNodeResourceTopology  = "noderesourcetopology.json"
+	PathMetrics               = "metrics.txt"
+)
+
+// Entry describes a file of the bundle, or why it is missing
+type Entry struct {
+	Path string `json:"path"`
+	// Source is where the content comes from, like a host path or an URL
+	Source string `json:"source,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Manifest struct {
+	FormatVersion int       `json:"formatVersion"`
+	NodeName      string    `json:"nodeName"`
+	Version       string    `json:"version"`
+	CreatedAt     time.Time `json:"createdAt"`
+	Redacted      bool      `json:"redacted"`
+	Entries       []Entry   `json:"entries"`
+}
+
+// Writer streams the files into a gzipped tarball. The manifest is the last file, written on Close.
+type Writer struct {
+	gzw      *gzip.Writer
+	tw       *tar.Writer
+	manifest Manifest
+}
+
+func NewWriter(w io.Writer, manifest Manifest) *Writer {
+	gzw := gzip.NewWriter(w)
+	manifest.FormatVersion = FormatVersion
+	return &Writer{
+		gzw:      gzw,
+		tw:       tar.NewWriter(gzw),
+		manifest: manifest,
+	}
+}
+
+// Add writes the data on the path. A failure to collect the data is recorded in the manifest with err.
+func (bw *Writer) Add(filePath, source string, data []byte, err error) error {
+	entry := Entry{
+		Path:   filePath,
+		Source: source,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+		bw.manifest.Entries = append(bw.manifest.Entries, entry)
+		return nil
+	}
+	if err := bw.write(filePath, data); err != nil {
+		return err
+	}
+	bw.manifest.Entries = append(bw.manifest.Entries, entry)
+	return nil
+}
+
+// AddJSON writes the indented JSON of the value on the path
+func (bw *Writer) AddJSON(filePath, source string, v interface{}, err error) error {
+	if err != nil {
+		return bw.Add(filePath, source, nil, err)
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return bw.Add(filePath, source, nil, fmt.Errorf("cannot encode: %w", err))
+	}
+	return bw.Add(filePath, source, append(data, '\n'), nil)
+}
+
+func (bw *Writer) Close() error {
+	data, err := json.MarshalIndent(bw.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := bw.write(ManifestPath, data); err != nil {
+		return err
+	}
+	if err := bw.tw.Close(); err != nil {
+		return err
+	}
+	return bw.gzw.Close()
+}
+
+func (bw *Writer) write(filePath string, data []byte) error {
+	hdr := &tar.Header{
+		Name:    filePath,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: bw.manifest.CreatedAt,
+	}
+	if err := bw.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := bw.tw.Write(data)
+	return err
+}
+
+// Bundle is the content of a bundle, for the tools consuming it
+type Bundle struct {
+	Manifest Manifest
+	Files    map[string][]byte
+}
+
+// Read loads a whole bundle, and rejects the ones with a newer format
+func Read(r io.Reader) (*Bundle, error) {
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gzr.Close()
+
+	bd := &Bundle{
+		Files: make(map[string][]byte),
+	}
+	tr := tar.NewReader(gzr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		bd.Files[path.Clean(hdr.Name)] = data
+	}
+
+	data, ok := bd.Files[ManifestPath]
+	if !ok {
+		return nil, fmt.Errorf("missing %s", ManifestPath)
+	}
+	if err := json.Unmarshal(data, &bd.Manifest); err != nil {
+		return nil, fmt.Errorf("cannot decode %s: %w", ManifestPath, err)
+	}
+	if bd.Manifest.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("unsupported bundle format version %d, up to %d is supported", bd.Manifest.FormatVersion, FormatVersion)
+	}
+	delete(bd.Files, ManifestPath)
+	return bd, nil
+}
+
+// Paths returns the sorted paths of the files in the bundle
+func (bd *Bundle) Paths() []string {
+	paths := make([]string, 0, len(bd.Files))
+	for filePath := range bd.Files {
+		paths = append(paths, filePath)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// DecodeJSON decodes the JSON file on the path into v
+func (bd *Bundle) DecodeJSON(filePath string, v interface{}) error {
+	data, ok := bd.Files[filePath]
+	if !ok {
+		return fmt.Errorf("missing %s", filePath)
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,132 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+
+	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/podrescli"
+)
+
+func TestWriteRead(t *testing.T) {
+	var buf bytes.Buffer
+	bw := NewWriter(&buf, Manifest{
+		NodeName:  "node",
+		CreatedAt: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err := bw.Add("sysfs/devices/system/cpu/online", "/sys/devices/system/cpu/online", []byte("0-7\n"), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := bw.AddJSON(PathListPodResources, "unix:///fake.sock", &podresourcesapi.ListPodResourcesResponse{
+		PodResources: []*podresourcesapi.PodResources{{Namespace: "ns", Name: "pod"}},
+	}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := bw.Add(PathMetrics, "http://127.0.0.1:2112/metrics", nil, fmt.Errorf("fake error")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := bw.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bd, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bd.Manifest.FormatVersion != FormatVersion || bd.Manifest.NodeName != "node" {
+		t.Errorf("unexpected manifest: %+v", bd.Manifest)
+	}
+	expectedEntries := []Entry{
+		{Path: "sysfs/devices/system/cpu/online", Source: "/sys/devices/system/cpu/online"},
+		{Path: PathListPodResources, Source: "unix:///fake.sock"},
+		{Path: PathMetrics, Source: "http://127.0.0.1:2112/metrics", Error: "fake error"},
+	}
+	if !reflect.DeepEqual(bd.Manifest.Entries, expectedEntries) {
+		t.Errorf("unexpected entries: %+v", bd.Manifest.Entries)
+	}
+	if !reflect.DeepEqual(bd.Paths(), []string{PathListPodResources, "sysfs/devices/system/cpu/online"}) {
+		t.Errorf("unexpected paths: %v", bd.Paths())
+	}
+
+	resp := podresourcesapi.ListPodResourcesResponse{}
+	if err := bd.DecodeJSON(PathListPodResources, &resp); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.PodResources) != 1 || resp.PodResources[0].Name != "pod" {
+		t.Errorf("unexpected podresources: %v", resp.PodResources)
+	}
+}
+
+func TestReadNewerFormat(t *testing.T) {
+	var buf bytes.Buffer
+	bw := NewWriter(&buf, Manifest{})
+	bw.manifest.FormatVersion = FormatVersion + 1
+	if err := bw.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := Read(&buf); err == nil || !strings.Contains(err.Error(), "unsupported bundle format") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	rd := NewRedactor(true)
+	if rd.Pseudonym("pod", "foo") != rd.Pseudonym("pod", "foo") || rd.Pseudonym("pod", "foo") == rd.Pseudonym("pod", "bar") {
+		t.Errorf("pseudonyms not stable")
+	}
+
+	resp := &podresourcesapi.ListPodResourcesResponse{
+		PodResources: []*podresourcesapi.PodResources{{Namespace: "ns", Name: "pod"}},
+	}
+	rd.ListPodResources(resp)
+	ci := rd.ContainerIdent(&podrescli.ContainerIdent{Namespace: "ns", PodName: "pod", ContainerName: "cnt"})
+	if resp.PodResources[0].Namespace != ci.Namespace || resp.PodResources[0].Name != ci.PodName || ci.ContainerName != "cnt" {
+		t.Errorf("pseudonyms do not match: %v %v", resp.PodResources[0], ci)
+	}
+	if strings.Contains(ci.String(), "pod/") {
+		t.Errorf("pod name not redacted: %v", ci)
+	}
+
+	kubeletConfig := "authentication:\n  x509:\n    clientCAFile: /etc/ca.crt\ncpuManagerPolicy: static\n"
+	data, err := rd.YAML([]byte(kubeletConfig), KubeletConfigSensitiveKeys)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "authentication: REDACTED\ncpuManagerPolicy: static\n"; string(data) != expected {
+		t.Errorf("got %q, want %q", data, expected)
+	}
+
+	checkpoint := `{"Data":{"PodDeviceEntries":[{"PodUID":"uid","AllocResp":"c2VjcmV0"}]},"Checksum":1}`
+	data, err = rd.JSON([]byte(checkpoint), CheckpointSensitiveKeys)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := `{"Checksum":1,"Data":{"PodDeviceEntries":[{"AllocResp":"REDACTED","PodUID":"uid"}]}}`; string(data) != expected {
+		t.Errorf("got %s, want %s", data, expected)
+	}
+
+	disabled := NewRedactor(false)
+	data, err = disabled.YAML([]byte(kubeletConfig), KubeletConfigSensitiveKeys)
+	if err != nil || string(data) != kubeletConfig {
+		t.Errorf("disabled redactor changed the data: %q %v", data, err)
+	}
+}
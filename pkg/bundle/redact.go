@@ -0,0 +1,132 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/podrescli"
+)
+
+const Redacted = "REDACTED"
+
+var (
+	// KubeletConfigSensitiveKeys hold credentials or the paths to them
+	KubeletConfigSensitiveKeys = []string{"authentication", "authorization", "tlsCertFile", "tlsPrivateKeyFile", "staticPodURLHeader", "providerID"}
+	// CheckpointSensitiveKeys hold the device plugin allocate responses, which can carry environment variables
+	CheckpointSensitiveKeys = []string{"AllocResp"}
+	// ConfigFileSensitiveKeys are the flags of the configuration file naming the pods and their namespaces
+	ConfigFileSensitiveKeys = []string{"reference-container", "placement-namespaces"}
+)
+
+// Redactor replaces the pod namespaces and names with stable pseudonyms, so the files of a bundle
+// still match each other, and drops the credentials. A disabled redactor changes nothing.
+type Redactor struct {
+	enabled bool
+}
+
+func NewRedactor(enabled bool) Redactor {
+	return Redactor{enabled: enabled}
+}
+
+func (rd Redactor) Enabled() bool {
+	return rd.enabled
+}
+
+// Pseudonym is like kind-1a2b3c4d, the same for the same value
+func (rd Redactor) Pseudonym(kind, value string) string {
+	if !rd.enabled || value == "" {
+		return value
+	}
+	sum := sha256.Sum256([]byte(value))
+	return kind + "-" + hex.EncodeToString(sum[:4])
+}
+
+// ListPodResources redacts the response in place
+func (rd Redactor) ListPodResources(resp *podresourcesapi.ListPodResourcesResponse) {
+	if !rd.enabled || resp == nil {
+		return
+	}
+	for _, podRes := range resp.PodResources {
+		podRes.Namespace = rd.Pseudonym("ns", podRes.Namespace)
+		podRes.Name = rd.Pseudonym("pod", podRes.Name)
+	}
+}
+
+func (rd Redactor) ContainerIdent(ci *podrescli.ContainerIdent) *podrescli.ContainerIdent {
+	if !rd.enabled || ci == nil {
+		return ci
+	}
+	return &podrescli.ContainerIdent{
+		Namespace:     rd.Pseudonym("ns", ci.Namespace),
+		PodName:       rd.Pseudonym("pod", ci.PodName),
+		ContainerName: ci.ContainerName,
+	}
+}
+
+// YAML replaces the values of the keys at any depth of the document
+func (rd Redactor) YAML(data []byte, keys []string) ([]byte, error) {
+	if !rd.enabled {
+		return data, nil
+	}
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	redacted, err := rd.JSON(jsonData, keys)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.JSONToYAML(redacted)
+}
+
+// JSON replaces the values of the keys at any depth of the document
+func (rd Redactor) JSON(data []byte, keys []string) ([]byte, error) {
+	if !rd.enabled {
+		return data, nil
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	sensitive := make(map[string]bool)
+	for _, key := range keys {
+		sensitive[key] = true
+	}
+	return json.Marshal(redactValue(doc, sensitive))
+}
+
+func redactValue(v interface{}, sensitive map[string]bool) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for key, item := range val {
+			if sensitive[key] {
+				val[key] = Redacted
+				continue
+			}
+			val[key] = redactValue(item, sensitive)
+		}
+	case []interface{}:
+		for idx, item := range val {
+			val[idx] = redactValue(item, sensitive)
+		}
+	}
+	return v
+}
@@ -0,0 +1,161 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cgroups
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+const (
+	V1 = "v1"
+	V2 = "v2"
+)
+
+// the kubelet names the pod cgroups after the pod UID. With the systemd driver
+// the dashes become underscores: kubepods-burstable-pod1234_5678.slice
+var podCgroupRegexp = regexp.MustCompile(`pod([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})`)
+
+// containers are either <id> (cgroupfs) or <runtime>-<id>.scope (systemd)
+var containerCgroupRegexp = regexp.MustCompile(`^(?:[a-z-]+-)?([0-9a-f]{64})(?:\.scope)?$`)
+
+// ContainerKey identifies a container cgroup
+type ContainerKey struct {
+	PodUID      string
+	ContainerID string
+}
+
+type Reader struct {
+	root    string
+	version string
+	base    string
+	cpusets []string
+}
+
+// NewReader detects the cgroup version mounted under root, usually /sys/fs/cgroup.
+func NewReader(root string) (*Reader, error) {
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		return &Reader{
+			root:    root,
+			version: V2,
+			base:    root,
+			cpusets: []string{"cpuset.cpus.effective", "cpuset.cpus"},
+		}, nil
+	}
+	base := filepath.Join(root, "cpuset")
+	if _, err := os.Stat(base); err != nil {
+		return nil, fmt.Errorf("cannot find the cpuset controller under %q: %w", root, err)
+	}
+	return &Reader{
+		root:    root,
+		version: V1,
+		base:    base,
+		cpusets: []string{"cpuset.effective_cpus", "cpuset.cpus"},
+	}, nil
+}
+
+func (cr *Reader) Version() string {
+	return cr.version
+}
+
+// KubepodsDir returns the top level cgroup of the pods, which depends on the cgroup driver.
+func (cr *Reader) KubepodsDir() (string, error) {
+	for _, name := range []string{"kubepods.slice", "kubepods"} {
+		dir := filepath.Join(cr.base, name)
+		if st, err := os.Stat(dir); err == nil && st.IsDir() {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("cannot find the kubepods cgroup under %q", cr.base)
+}
+
+// ContainerCPUSets walks the kubepods hierarchy and returns the effective cpuset of each container.
+func (cr *Reader) ContainerCPUSets() (map[ContainerKey]cpuset.CPUSet, error) {
+	kubepods, err := cr.KubepodsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[ContainerKey]cpuset.CPUSet)
+	err = filepath.Walk(kubepods, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// containers come and go while we walk
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		name := info.Name()
+		// the runtime monitor processes are not containers
+		if strings.Contains(name, "conmon") {
+			return filepath.SkipDir
+		}
+		match := containerCgroupRegexp.FindStringSubmatch(name)
+		if match == nil {
+			return nil
+		}
+		podMatch := podCgroupRegexp.FindStringSubmatch(filepath.Base(filepath.Dir(path)))
+		if podMatch == nil {
+			return nil
+		}
+		cpus, err := cr.ReadCPUSet(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		key := ContainerKey{
+			PodUID:      strings.ReplaceAll(podMatch[1], "_", "-"),
+			ContainerID: match[1],
+		}
+		ret[key] = cpus
+		return filepath.SkipDir
+	})
+	return ret, err
+}
+
+func (cr *Reader) ReadCPUSet(dir string) (cpuset.CPUSet, error) {
+	var err error
+	for _, name := range cr.cpusets {
+		var data []byte
+		data, err = ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		return cpuset.Parse(strings.TrimSpace(string(data)))
+	}
+	return cpuset.CPUSet{}, err
+}
+
+// PodsCPUSet returns the cpus of the top level cgroup of the pods. The cpu manager narrows the container
+// cgroups only, so these are all the cpus the pods can run on, exclusive ones included.
+func (cr *Reader) PodsCPUSet() (cpuset.CPUSet, error) {
+	kubepods, err := cr.KubepodsDir()
+	if err != nil {
+		return cpuset.CPUSet{}, err
+	}
+	return cr.ReadCPUSet(kubepods)
+}
@@ -0,0 +1,118 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+const (
+	podUID = "0c1b4a4c-7e1d-4c5e-9a10-3f0e3c1c2b5d"
+	cntID1 = "1111111111111111111111111111111111111111111111111111111111111111"
+	cntID2 = "2222222222222222222222222222222222222222222222222222222222222222"
+)
+
+func writeCgroup(t *testing.T, dir, file, cpus string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("cannot create %q: %v", dir, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(cpus+"\n"), 0644); err != nil {
+		t.Fatalf("cannot write %q: %v", dir, err)
+	}
+}
+
+func TestContainerCPUSetsV1Cgroupfs(t *testing.T) {
+	root := t.TempDir()
+	podDir := filepath.Join(root, "cpuset", "kubepods", "pod"+podUID)
+	writeCgroup(t, filepath.Join(podDir, cntID1), "cpuset.effective_cpus", "2-3")
+	writeCgroup(t, filepath.Join(podDir, cntID2), "cpuset.cpus", "0-1,4-7")
+
+	cr, err := NewReader(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cr.Version() != V1 {
+		t.Errorf("detected cgroup %s, expected %s", cr.Version(), V1)
+	}
+	got, err := cr.ContainerCPUSets()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[ContainerKey]cpuset.CPUSet{
+		{PodUID: podUID, ContainerID: cntID1}: cpuset.NewCPUSet(2, 3),
+		{PodUID: podUID, ContainerID: cntID2}: cpuset.NewCPUSet(0, 1, 4, 5, 6, 7),
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, want %v", got, expected)
+	}
+}
+
+func TestContainerCPUSetsV2Systemd(t *testing.T) {
+	root := t.TempDir()
+	writeCgroup(t, root, "cgroup.controllers", "cpuset cpu memory")
+	podDir := filepath.Join(root, "kubepods.slice", "kubepods-pod"+strings.ReplaceAll(podUID, "-", "_")+".slice")
+	writeCgroup(t, filepath.Join(podDir, "crio-"+cntID1+".scope"), "cpuset.cpus.effective", "2-3")
+	writeCgroup(t, filepath.Join(podDir, "crio-conmon-"+cntID1+".scope"), "cpuset.cpus.effective", "0-7")
+
+	cr, err := NewReader(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cr.Version() != V2 {
+		t.Errorf("detected cgroup %s, expected %s", cr.Version(), V2)
+	}
+	got, err := cr.ContainerCPUSets()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[ContainerKey]cpuset.CPUSet{
+		{PodUID: podUID, ContainerID: cntID1}: cpuset.NewCPUSet(2, 3),
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, want %v", got, expected)
+	}
+}
+
+func TestPodsCPUSet(t *testing.T) {
+	root := t.TempDir()
+	writeCgroup(t, root, "cgroup.controllers", "cpuset cpu memory")
+	writeCgroup(t, filepath.Join(root, "kubepods.slice"), "cpuset.cpus.effective", "0-7")
+	// the QoS cgroups are not narrowed by the cpu manager, and are not looked at
+	writeCgroup(t, filepath.Join(root, "kubepods.slice", "kubepods-burstable.slice"), "cpuset.cpus.effective", "0-7")
+
+	cr, err := NewReader(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := cr.PodsCPUSet()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := cpuset.NewCPUSet(0, 1, 2, 3, 4, 5, 6, 7); !got.Equals(expected) {
+		t.Errorf("got %q, want %q", got.String(), expected.String())
+	}
+
+	if _, err := NewReader(t.TempDir()); err == nil {
+		t.Errorf("expected error on a missing cpuset controller")
+	}
+}
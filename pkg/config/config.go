@@ -17,19 +17,25 @@ package config
 import (
 	"errors"
 	"io/ioutil"
-	"log"
 	"os"
 
 	"sigs.k8s.io/yaml"
 
+	"github.com/openshift-kni/resource-topology-exporter/pkg/logging"
 	"github.com/openshift-kni/resource-topology-exporter/pkg/sysinfo"
 )
 
+var logger = logging.Component("config")
+
 type Config struct {
-	ExcludeList           map[string][]string
-	Resources             sysinfo.Config
+	ExcludeList map[string][]string
+	Resources   sysinfo.Config
+	// TopologyManagerPolicy, TopologyManagerScope and Sinks set their flag like the Flags entries do
 	TopologyManagerPolicy string
 	TopologyManagerScope  string
+	Sinks                 []string
+	// Flags set the command line flags by name, unless given on the command line or in the environment
+	Flags map[string]interface{}
 }
 
 func ReadConfig(configPath string) (Config, error) {
@@ -39,7 +45,7 @@ func ReadConfig(configPath string) (Config, error) {
 	if err != nil {
 		// config is optional
 		if errors.Is(err, os.ErrNotExist) {
-			log.Printf("Info: couldn't find configuration in %q", configPath)
+			logger.InfoS("configuration file not found, using the defaults", "path", configPath)
 			return conf, nil
 		}
 		return conf, err
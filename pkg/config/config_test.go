@@ -70,6 +70,9 @@ func TestReadValidData(t *testing.T) {
 	if cfg.ExcludeList["masternode"][0] != "memory" {
 		t.Errorf("unexpected values: %#v", cfg)
 	}
+	if len(cfg.Sinks) != 2 || cfg.Sinks[1] != "nfd" {
+		t.Errorf("unexpected values: %#v", cfg)
+	}
 }
 
 const testData string = `resources:
@@ -81,4 +84,5 @@ topologymanagerscope: "pod"
 excludelist:
   masternode: [memory, device/exampleA]
   workernode1: [memory, device/exampleB]
-  workernode2: [cpu]`
+  workernode2: [cpu]
+sinks: [api, nfd]`
@@ -0,0 +1,299 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpuaudit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/cgroups"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/logging"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/metrics"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/stalepods"
+)
+
+var logger = logging.Component("cpuaudit")
+
+const (
+	FindingCpusetMismatch   = "CpusetMismatch"
+	FindingExclusiveOverlap = "ExclusiveOverlap"
+	FindingReservedOverlap  = "ReservedOverlap"
+	FindingCgroupNotFound   = "CgroupNotFound"
+)
+
+var findingKinds = []string{
+	FindingCpusetMismatch,
+	FindingExclusiveOverlap,
+	FindingReservedOverlap,
+	FindingCgroupNotFound,
+}
+
+const (
+	defaultPodResourcesTimeout = 10 * time.Second
+)
+
+type Args struct {
+	CgroupRoot   string
+	Interval     time.Duration
+	ReservedCPUs string
+}
+
+// ContainerState joins what podresources reports about a container with its actual cgroup.
+type ContainerState struct {
+	Namespace string
+	Pod       string
+	Container string
+	// Exclusive are the exclusive cpus according to podresources
+	Exclusive cpuset.CPUSet
+	// Effective is the cpuset the container actually runs on
+	Effective cpuset.CPUSet
+	HasCgroup bool
+}
+
+func (cs ContainerState) Name() string {
+	return fmt.Sprintf("%s/%s/%s", cs.Namespace, cs.Pod, cs.Container)
+}
+
+type Finding struct {
+	Kind      string `json:"kind"`
+	Container string `json:"container"`
+	Other     string `json:"other,omitempty"`
+	CPUs      string `json:"cpus"`
+	Message   string `json:"message"`
+}
+
+type Report struct {
+	Timestamp     time.Time `json:"timestamp"`
+	CgroupVersion string    `json:"cgroupVersion"`
+	Containers    int       `json:"containers"`
+	Findings      []Finding `json:"findings"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// Auditor periodically compares the exclusive cpus reported by podresources with the cpusets of the containers.
+type Auditor struct {
+	cli      podresourcesapi.PodResourcesListerClient
+	src      stalepods.PodSource
+	reader   *cgroups.Reader
+	reserved cpuset.CPUSet
+	interval time.Duration
+
+	lock sync.RWMutex
+	last Report
+}
+
+// NewAuditor expects a podresources client which already filters out the shared pool cpus.
+func NewAuditor(cli podresourcesapi.PodResourcesListerClient, src stalepods.PodSource, args Args) (*Auditor, error) {
+	reader, err := cgroups.NewReader(args.CgroupRoot)
+	if err != nil {
+		return nil, err
+	}
+	reserved, err := cpuset.Parse(args.ReservedCPUs)
+	if err != nil {
+		return nil, err
+	}
+	logger.InfoS("cpuset audit", "cgroup", reader.Version(), "cgroupRoot", args.CgroupRoot, "reservedCPUs", reserved.String())
+	return &Auditor{
+		cli:      cli,
+		src:      src,
+		reader:   reader,
+		reserved: reserved,
+		interval: args.Interval,
+	}, nil
+}
+
+func (au *Auditor) Run(stopCh <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(au.interval)
+		defer ticker.Stop()
+		for {
+			au.update()
+			select {
+			case <-ticker.C:
+			case <-stopCh:
+				logger.InfoS("cpuset audit stop")
+				return
+			}
+		}
+	}()
+}
+
+func (au *Auditor) update() {
+	report, err := au.Audit()
+	if err != nil {
+		logger.ErrorS(err, "cpuset audit failed")
+		report.Error = err.Error()
+	}
+	for _, finding := range report.Findings {
+		logger.InfoS("cpuset audit finding", "kind", finding.Kind, "container", finding.Container, "message", finding.Message)
+	}
+
+	counts := make(map[string]int)
+	for _, finding := range report.Findings {
+		counts[finding.Kind]++
+	}
+	for _, kind := range findingKinds {
+		metrics.UpdateCPUSetAuditMetric(kind, counts[kind])
+	}
+
+	au.lock.Lock()
+	defer au.lock.Unlock()
+	au.last = report
+}
+
+func (au *Auditor) Audit() (Report, error) {
+	report := Report{
+		Timestamp:     time.Now(),
+		CgroupVersion: au.reader.Version(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultPodResourcesTimeout)
+	defer cancel()
+	resp, err := au.cli.List(ctx, &podresourcesapi.ListPodResourcesRequest{})
+	if err != nil {
+		return report, err
+	}
+	pods, err := au.src.ListPods()
+	if err != nil {
+		return report, err
+	}
+	cpusets, err := au.reader.ContainerCPUSets()
+	if err != nil {
+		return report, err
+	}
+
+	exclusive := make(map[string]cpuset.CPUSet)
+	for _, podRes := range resp.GetPodResources() {
+		for _, cntRes := range podRes.GetContainers() {
+			name := fmt.Sprintf("%s/%s/%s", podRes.GetNamespace(), podRes.GetName(), cntRes.GetName())
+			exclusive[name] = cpuset.NewCPUSetInt64(cntRes.GetCpuIds()...)
+		}
+	}
+
+	states := []ContainerState{}
+	for _, pod := range pods {
+		for _, cntStatus := range pod.Status.ContainerStatuses {
+			if cntStatus.State.Running == nil {
+				continue
+			}
+			st := ContainerState{
+				Namespace: pod.Namespace,
+				Pod:       pod.Name,
+				Container: cntStatus.Name,
+			}
+			st.Exclusive = exclusive[st.Name()]
+			key := cgroups.ContainerKey{
+				PodUID:      string(pod.UID),
+				ContainerID: containerIDFromStatus(cntStatus.ContainerID),
+			}
+			st.Effective, st.HasCgroup = cpusets[key]
+			states = append(states, st)
+		}
+	}
+
+	report.Containers = len(states)
+	report.Findings = AuditContainers(states, au.reserved)
+	return report, nil
+}
+
+func (au *Auditor) LastReport() Report {
+	au.lock.RLock()
+	defer au.lock.RUnlock()
+	return au.last
+}
+
+// ServeHTTP exposes the last report as JSON
+func (au *Auditor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(au.LastReport()); err != nil {
+		logger.ErrorS(err, "cannot encode the cpuset audit report")
+	}
+}
+
+// AuditContainers checks the exclusive cpus of each container against its own cpuset,
+// the cpusets of all the other containers and the reserved cpus.
+func AuditContainers(states []ContainerState, reserved cpuset.CPUSet) []Finding {
+	sort.Slice(states, func(i, j int) bool { return states[i].Name() < states[j].Name() })
+
+	findings := []Finding{}
+	for idx, st := range states {
+		if st.Exclusive.IsEmpty() {
+			continue
+		}
+		if !st.HasCgroup {
+			findings = append(findings, Finding{
+				Kind:      FindingCgroupNotFound,
+				Container: st.Name(),
+				CPUs:      st.Exclusive.String(),
+				Message:   "cannot find the container cgroup",
+			})
+			continue
+		}
+		if !st.Effective.Equals(st.Exclusive) {
+			findings = append(findings, Finding{
+				Kind:      FindingCpusetMismatch,
+				Container: st.Name(),
+				CPUs:      st.Effective.String(),
+				Message:   fmt.Sprintf("podresources reports exclusive cpus %q, cpuset is %q", st.Exclusive.String(), st.Effective.String()),
+			})
+		}
+		if overlap := st.Exclusive.Intersection(reserved); !overlap.IsEmpty() {
+			findings = append(findings, Finding{
+				Kind:      FindingReservedOverlap,
+				Container: st.Name(),
+				CPUs:      overlap.String(),
+				Message:   fmt.Sprintf("exclusive cpus %q overlap with the reserved cpus", overlap.String()),
+			})
+		}
+		for otherIdx, other := range states {
+			if otherIdx == idx || !other.HasCgroup {
+				continue
+			}
+			// report the overlaps between two exclusive containers once
+			if !other.Exclusive.IsEmpty() && otherIdx < idx {
+				continue
+			}
+			overlap := st.Exclusive.Intersection(other.Effective)
+			if overlap.IsEmpty() {
+				continue
+			}
+			findings = append(findings, Finding{
+				Kind:      FindingExclusiveOverlap,
+				Container: st.Name(),
+				Other:     other.Name(),
+				CPUs:      overlap.String(),
+				Message:   fmt.Sprintf("exclusive cpus %q are also in the cpuset of %s", overlap.String(), other.Name()),
+			})
+		}
+	}
+	return findings
+}
+
+// containerIDFromStatus strips the runtime scheme, e.g. cri-o://<id>
+func containerIDFromStatus(containerID string) string {
+	if idx := strings.Index(containerID, "://"); idx >= 0 {
+		return containerID[idx+3:]
+	}
+	return containerID
+}
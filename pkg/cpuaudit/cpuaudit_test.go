@@ -0,0 +1,169 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpuaudit
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+const (
+	podUID = "0c1b4a4c-7e1d-4c5e-9a10-3f0e3c1c2b5d"
+	cntID1 = "1111111111111111111111111111111111111111111111111111111111111111"
+	cntID2 = "2222222222222222222222222222222222222222222222222222222222222222"
+)
+
+func writeCgroup(t *testing.T, dir, file, cpus string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("cannot create %q: %v", dir, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(cpus+"\n"), 0644); err != nil {
+		t.Fatalf("cannot write %q: %v", dir, err)
+	}
+}
+
+func TestAuditContainers(t *testing.T) {
+	states := []ContainerState{
+		{
+			Namespace: "ns", Pod: "guaranteed", Container: "cnt",
+			Exclusive: cpuset.NewCPUSet(2, 3),
+			Effective: cpuset.NewCPUSet(2, 3),
+			HasCgroup: true,
+		},
+		{
+			// the cpu manager did not update the cpuset
+			Namespace: "ns", Pod: "leaking", Container: "cnt",
+			Exclusive: cpuset.NewCPUSet(0, 4),
+			Effective: cpuset.NewCPUSet(0, 1, 4, 5, 6, 7),
+			HasCgroup: true,
+		},
+		{
+			Namespace: "ns", Pod: "shared", Container: "cnt",
+			Effective: cpuset.NewCPUSet(1, 4, 5, 6, 7),
+			HasCgroup: true,
+		},
+		{
+			Namespace: "ns", Pod: "starting", Container: "cnt",
+			Exclusive: cpuset.NewCPUSet(6),
+		},
+	}
+	got := AuditContainers(states, cpuset.NewCPUSet(0, 1))
+
+	kinds := []string{}
+	for _, finding := range got {
+		kinds = append(kinds, finding.Kind+" "+finding.Container+" "+finding.Other+" "+finding.CPUs)
+	}
+	expected := []string{
+		FindingCpusetMismatch + " ns/leaking/cnt  0-1,4-7",
+		FindingReservedOverlap + " ns/leaking/cnt  0",
+		FindingExclusiveOverlap + " ns/leaking/cnt ns/shared/cnt 4",
+		FindingCgroupNotFound + " ns/starting/cnt  6",
+	}
+	if !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("got %v, want %v", kinds, expected)
+	}
+}
+
+type fakeLister struct {
+	resp *podresourcesapi.ListPodResourcesResponse
+}
+
+func (fl *fakeLister) List(ctx context.Context, in *podresourcesapi.ListPodResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.ListPodResourcesResponse, error) {
+	return fl.resp, nil
+}
+
+func (fl *fakeLister) GetAllocatableResources(ctx context.Context, in *podresourcesapi.AllocatableResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.AllocatableResourcesResponse, error) {
+	return &podresourcesapi.AllocatableResourcesResponse{}, nil
+}
+
+type fakeSource struct {
+	pods []*corev1.Pod
+}
+
+func (fs *fakeSource) ListPods() ([]*corev1.Pod, error) {
+	return fs.pods, nil
+}
+
+func TestAudit(t *testing.T) {
+	root := t.TempDir()
+	podDir := filepath.Join(root, "cpuset", "kubepods", "pod"+podUID)
+	writeCgroup(t, filepath.Join(podDir, cntID1), "cpuset.effective_cpus", "2-3")
+	writeCgroup(t, filepath.Join(podDir, cntID2), "cpuset.effective_cpus", "3-7")
+
+	cli := &fakeLister{
+		resp: &podresourcesapi.ListPodResourcesResponse{
+			PodResources: []*podresourcesapi.PodResources{
+				{
+					Namespace: "ns", Name: "pod",
+					Containers: []*podresourcesapi.ContainerResources{
+						{Name: "exclusive", CpuIds: []int64{2, 3}},
+						{Name: "shared"},
+					},
+				},
+			},
+		},
+	}
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	src := &fakeSource{
+		pods: []*corev1.Pod{
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod", UID: types.UID(podUID)},
+				Status: corev1.PodStatus{
+					ContainerStatuses: []corev1.ContainerStatus{
+						{Name: "exclusive", ContainerID: "cri-o://" + cntID1, State: running},
+						{Name: "shared", ContainerID: "cri-o://" + cntID2, State: running},
+					},
+				},
+			},
+		},
+	}
+
+	au, err := NewAuditor(cli, src, Args{CgroupRoot: root})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	report, err := au.Audit()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Containers != 2 {
+		t.Errorf("expected 2 containers, got %d", report.Containers)
+	}
+	expected := []Finding{
+		{
+			Kind:      FindingExclusiveOverlap,
+			Container: "ns/pod/exclusive",
+			Other:     "ns/pod/shared",
+			CPUs:      "3",
+			Message:   `exclusive cpus "3" are also in the cpuset of ns/pod/shared`,
+		},
+	}
+	if !reflect.DeepEqual(report.Findings, expected) {
+		t.Errorf("got %v, want %v", report.Findings, expected)
+	}
+}
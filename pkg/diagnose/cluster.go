@@ -0,0 +1,119 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/nrtupdater"
+)
+
+// AccessReviewer tells if the exporter is allowed to perform an action
+type AccessReviewer interface {
+	CanI(ctx context.Context, attrs authorizationv1.ResourceAttributes) (bool, error)
+}
+
+type selfSubjectAccessReviewer struct {
+	cs kubernetes.Interface
+}
+
+// NewSelfSubjectAccessReviewer reviews the actions of the identity of the clientset
+func NewSelfSubjectAccessReviewer(cs kubernetes.Interface) AccessReviewer {
+	return selfSubjectAccessReviewer{cs: cs}
+}
+
+func (sr selfSubjectAccessReviewer) CanI(ctx context.Context, attrs authorizationv1.ResourceAttributes) (bool, error) {
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &attrs,
+		},
+	}
+	resp, err := sr.cs.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return false, err
+	}
+	return resp.Status.Allowed, nil
+}
+
+// CheckCRD verifies the apiserver serves the NodeResourceTopology version the exporter publishes
+func CheckCRD(servedVersions func() ([]string, error), apiVersion string) Check {
+	return Check{
+		Name: "crd",
+		Run: func(ctx context.Context) Result {
+			served, err := servedVersions()
+			if err != nil {
+				return Fail("check the connection to the apiserver", "cannot discover the served versions of %s: %v", nrtupdater.TopologyGroup, err)
+			}
+			hint := "install the NodeResourceTopology CRD, see manifests/crd.yaml"
+			if len(served) == 0 {
+				return Fail(hint, "%s is not served", nrtupdater.TopologyGroup)
+			}
+			selected, err := nrtupdater.SelectAPIVersion(apiVersion, served)
+			if err != nil {
+				return Fail(hint+", or change --nrt-api-version", "%v", err)
+			}
+			for _, version := range served {
+				if version == selected {
+					return Pass("%s serves %v, publishing %s", nrtupdater.TopologyGroup, served, selected)
+				}
+			}
+			return Fail(hint+", or change --nrt-api-version", "%s serves %v, not %s", nrtupdater.TopologyGroup, served, selected)
+		},
+	}
+}
+
+// CheckPermissions reviews all the actions, and reports all the denied ones
+func CheckPermissions(reviewer AccessReviewer, required []authorizationv1.ResourceAttributes) Check {
+	return Check{
+		Name: "api-permissions",
+		Run: func(ctx context.Context) Result {
+			denied := []string{}
+			for _, attrs := range required {
+				allowed, err := reviewer.CanI(ctx, attrs)
+				if err != nil {
+					return Fail("check the connection to the apiserver", "cannot review %s: %v", describeAccess(attrs), err)
+				}
+				if !allowed {
+					denied = append(denied, describeAccess(attrs))
+				}
+			}
+			if len(denied) > 0 {
+				return Fail("add the missing rules to the ClusterRole bound to the exporter service account, see the output of the render subcommand", "cannot %s", strings.Join(denied, ", "))
+			}
+			return Pass("all the %d required actions are allowed", len(required))
+		},
+	}
+}
+
+// describeAccess renders the attributes like "patch nodes/status"
+func describeAccess(attrs authorizationv1.ResourceAttributes) string {
+	res := attrs.Resource
+	if attrs.Group != "" {
+		res = res + "." + attrs.Group
+	}
+	if attrs.Subresource != "" {
+		res = res + "/" + attrs.Subresource
+	}
+	if attrs.Namespace != "" {
+		return fmt.Sprintf("%s %s in %s", attrs.Verb, res, attrs.Namespace)
+	}
+	return fmt.Sprintf("%s %s", attrs.Verb, res)
+}
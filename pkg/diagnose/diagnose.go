@@ -0,0 +1,118 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+)
+
+// severity orders the statuses, to find the worst one
+var severity = map[Status]int{
+	StatusPass: 0,
+	StatusWarn: 1,
+	StatusFail: 2,
+}
+
+type Result struct {
+	Name    string `json:"name"`
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+	// Hint tells how to fix a warning or a failure
+	Hint string `json:"hint,omitempty"`
+}
+
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) Result
+}
+
+type Report struct {
+	// Status is the worst status of the results
+	Status  Status   `json:"status"`
+	Results []Result `json:"results"`
+}
+
+func Pass(format string, args ...interface{}) Result {
+	return Result{Status: StatusPass, Message: fmt.Sprintf(format, args...)}
+}
+
+func Warn(hint, format string, args ...interface{}) Result {
+	return Result{Status: StatusWarn, Message: fmt.Sprintf(format, args...), Hint: hint}
+}
+
+func Fail(hint, format string, args ...interface{}) Result {
+	return Result{Status: StatusFail, Message: fmt.Sprintf(format, args...), Hint: hint}
+}
+
+// Unavailable is a check which always fails, for the checks whose prerequisites are missing
+func Unavailable(name string, err error, hint string) Check {
+	return Check{
+		Name: name,
+		Run: func(ctx context.Context) Result {
+			return Fail(hint, "%v", err)
+		},
+	}
+}
+
+// Run runs all the checks in order, regardless of their results
+func Run(ctx context.Context, checks []Check) Report {
+	rep := Report{
+		Status:  StatusPass,
+		Results: make([]Result, 0, len(checks)),
+	}
+	for _, check := range checks {
+		res := check.Run(ctx)
+		res.Name = check.Name
+		if severity[res.Status] > severity[rep.Status] {
+			rep.Status = res.Status
+		}
+		rep.Results = append(rep.Results, res)
+	}
+	return rep
+}
+
+func (rep Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rep)
+}
+
+// WriteText prints a line per check, followed by the hint if any
+func (rep Report) WriteText(w io.Writer) error {
+	for _, res := range rep.Results {
+		if _, err := fmt.Fprintf(w, "[%s] %s: %s\n", strings.ToUpper(string(res.Status)), res.Name, res.Message); err != nil {
+			return err
+		}
+		if res.Hint != "" {
+			if _, err := fmt.Fprintf(w, "       hint: %s\n", res.Hint); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := fmt.Fprintf(w, "result: %s\n", rep.Status)
+	return err
+}
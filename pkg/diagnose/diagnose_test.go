@@ -0,0 +1,323 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+
+	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/podrescli"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/nrtupdater"
+)
+
+type fakePodResources struct {
+	alloc *podresourcesapi.AllocatableResourcesResponse
+	list  *podresourcesapi.ListPodResourcesResponse
+	err   error
+}
+
+func (fp fakePodResources) List(ctx context.Context, in *podresourcesapi.ListPodResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.ListPodResourcesResponse, error) {
+	return fp.list, fp.err
+}
+
+func (fp fakePodResources) GetAllocatableResources(ctx context.Context, in *podresourcesapi.AllocatableResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.AllocatableResourcesResponse, error) {
+	return fp.alloc, fp.err
+}
+
+type fakeReviewer struct {
+	denied map[string]bool
+}
+
+func (fr fakeReviewer) CanI(ctx context.Context, attrs authorizationv1.ResourceAttributes) (bool, error) {
+	return !fr.denied[describeAccess(attrs)], nil
+}
+
+func runCheck(check Check) Result {
+	return Run(context.Background(), []Check{check}).Results[0]
+}
+
+func TestRun(t *testing.T) {
+	checks := []Check{
+		{Name: "a", Run: func(ctx context.Context) Result { return Pass("fine") }},
+		{Name: "b", Run: func(ctx context.Context) Result { return Warn("do this", "not great") }},
+		Unavailable("c", fmt.Errorf("fake error"), "do that"),
+	}
+	rep := Run(context.Background(), checks)
+	if rep.Status != StatusFail {
+		t.Errorf("unexpected status: %v", rep.Status)
+	}
+
+	var buf bytes.Buffer
+	if err := rep.WriteText(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `[PASS] a: fine
+[WARN] b: not great
+       hint: do this
+[FAIL] c: fake error
+       hint: do that
+result: fail
+`
+	if buf.String() != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+
+	if rep := Run(context.Background(), checks[:2]); rep.Status != StatusWarn {
+		t.Errorf("unexpected status: %v", rep.Status)
+	}
+}
+
+func TestCheckPodResources(t *testing.T) {
+	testCases := []struct {
+		name     string
+		cli      fakePodResources
+		expected Status
+	}{
+		{
+			name:     "unreachable",
+			cli:      fakePodResources{err: fmt.Errorf("fake error")},
+			expected: StatusFail,
+		},
+		{
+			name: "no exclusive cpus",
+			cli: fakePodResources{
+				alloc: &podresourcesapi.AllocatableResourcesResponse{},
+				list:  &podresourcesapi.ListPodResourcesResponse{},
+			},
+			expected: StatusWarn,
+		},
+		{
+			name: "working",
+			cli: fakePodResources{
+				alloc: &podresourcesapi.AllocatableResourcesResponse{CpuIds: []int64{1, 2, 3}},
+				list:  &podresourcesapi.ListPodResourcesResponse{},
+			},
+			expected: StatusPass,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := runCheck(CheckPodResources(tc.cli, "unix:///fake.sock"))
+			if res.Status != tc.expected {
+				t.Errorf("got %v (%s), want %v", res.Status, res.Message, tc.expected)
+			}
+		})
+	}
+}
+
+func TestCheckReferenceContainer(t *testing.T) {
+	cli := fakePodResources{
+		list: &podresourcesapi.ListPodResourcesResponse{
+			PodResources: []*podresourcesapi.PodResources{
+				{
+					Namespace:  "ns",
+					Name:       "pod",
+					Containers: []*podresourcesapi.ContainerResources{{Name: "cnt", CpuIds: []int64{0, 1}}},
+				},
+			},
+		},
+	}
+	if res := runCheck(CheckReferenceContainer(cli, &podrescli.ContainerIdent{Namespace: "ns", PodName: "pod", ContainerName: "cnt"})); res.Status != StatusPass {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	if res := runCheck(CheckReferenceContainer(cli, &podrescli.ContainerIdent{Namespace: "ns", PodName: "pod", ContainerName: "missing"})); res.Status != StatusFail {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	if res := runCheck(CheckReferenceContainer(cli, nil)); res.Status != StatusPass {
+		t.Errorf("unexpected result: %+v", res)
+	}
+}
+
+func TestCheckKubeletConfig(t *testing.T) {
+	testCases := []struct {
+		name     string
+		topoInfo nrtupdater.TopologyInfo
+		topoErr  error
+		expected Status
+	}{
+		{
+			name:     "unreadable",
+			topoErr:  fmt.Errorf("fake error"),
+			expected: StatusFail,
+		},
+		{
+			name:     "cpu manager not static",
+			topoInfo: nrtupdater.TopologyInfo{TopologyManagerPolicy: "single-numa-node", TopologyManagerScope: "pod", CPUManagerPolicy: "none"},
+			expected: StatusWarn,
+		},
+		{
+			name:     "no topology manager",
+			topoInfo: nrtupdater.TopologyInfo{TopologyManagerPolicy: "none", TopologyManagerScope: "container", CPUManagerPolicy: "static"},
+			expected: StatusWarn,
+		},
+		{
+			name:     "aligned",
+			topoInfo: nrtupdater.TopologyInfo{TopologyManagerPolicy: "single-numa-node", TopologyManagerScope: "pod", CPUManagerPolicy: "static"},
+			expected: StatusPass,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := runCheck(CheckKubeletConfig(tc.topoInfo, tc.topoErr))
+			if res.Status != tc.expected {
+				t.Errorf("got %v (%s), want %v", res.Status, res.Message, tc.expected)
+			}
+		})
+	}
+}
+
+func TestCheckSysfs(t *testing.T) {
+	root, err := ioutil.TempDir("", "diagnose-sysfs")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	if res := runCheck(CheckSysfs(root)); res.Status != StatusFail {
+		t.Errorf("unexpected result on empty sysfs: %+v", res)
+	}
+
+	for _, dir := range []string{"devices/system/node/node0", "devices/system/node/node1", "devices/system/cpu"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "devices/system/cpu/online"), []byte("0-7\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res := runCheck(CheckSysfs(root))
+	if res.Status != StatusPass || res.Message != `2 NUMA nodes, online cpus "0-7"` {
+		t.Errorf("unexpected result: %+v", res)
+	}
+}
+
+func TestCheckConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diagnose-config")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		name     string
+		data     string
+		expected Status
+	}{
+		{
+			name:     "missing",
+			expected: StatusWarn,
+		},
+		{
+			name:     "malformed",
+			data:     "excludeList: [",
+			expected: StatusFail,
+		},
+		{
+			name:     "unknown key",
+			data:     "excludList:\n  '*': [memory]\n",
+			expected: StatusWarn,
+		},
+		{
+			name:     "valid",
+			data:     "excludeList:\n  '*': [memory]\nsinks: [api]\n",
+			expected: StatusPass,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.ReplaceAll(tc.name, " ", "-")+".yaml")
+			if tc.data != "" {
+				if err := ioutil.WriteFile(path, []byte(tc.data), 0644); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			res := runCheck(CheckConfigFile(path))
+			if res.Status != tc.expected {
+				t.Errorf("got %v (%s), want %v", res.Status, res.Message, tc.expected)
+			}
+		})
+	}
+}
+
+func TestCheckCRD(t *testing.T) {
+	served := func(versions ...string) func() ([]string, error) {
+		return func() ([]string, error) { return versions, nil }
+	}
+	testCases := []struct {
+		name       string
+		served     func() ([]string, error)
+		apiVersion string
+		expected   Status
+	}{
+		{
+			name:       "discovery failure",
+			served:     func() ([]string, error) { return nil, fmt.Errorf("fake error") },
+			apiVersion: nrtupdater.APIVersionAuto,
+			expected:   StatusFail,
+		},
+		{
+			name:       "missing",
+			served:     served(),
+			apiVersion: nrtupdater.APIVersionAuto,
+			expected:   StatusFail,
+		},
+		{
+			name:       "requested version not served",
+			served:     served("v1alpha1"),
+			apiVersion: nrtupdater.APIVersionV1alpha2,
+			expected:   StatusFail,
+		},
+		{
+			name:       "auto",
+			served:     served("v1alpha1", "v1alpha2"),
+			apiVersion: nrtupdater.APIVersionAuto,
+			expected:   StatusPass,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := runCheck(CheckCRD(tc.served, tc.apiVersion))
+			if res.Status != tc.expected {
+				t.Errorf("got %v (%s), want %v", res.Status, res.Message, tc.expected)
+			}
+		})
+	}
+}
+
+func TestCheckPermissions(t *testing.T) {
+	required := []authorizationv1.ResourceAttributes{
+		{Verb: "get", Group: nrtupdater.TopologyGroup, Resource: "noderesourcetopologies"},
+		{Verb: "update", Resource: "pods", Subresource: "status", Namespace: "rte"},
+	}
+	if res := runCheck(CheckPermissions(fakeReviewer{}, required)); res.Status != StatusPass {
+		t.Errorf("unexpected result: %+v", res)
+	}
+
+	res := runCheck(CheckPermissions(fakeReviewer{denied: map[string]bool{"update pods/status in rte": true}}, required))
+	if res.Status != StatusFail || res.Message != "cannot update pods/status in rte" {
+		t.Errorf("unexpected result: %+v", res)
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/podrescli"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/config"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/nrtupdater"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/sharedpool"
+)
+
+const podResourcesTimeout = 10 * time.Second
+
+// CheckPodResources queries the kubelet podresources API like the scans do
+func CheckPodResources(cli podresourcesapi.PodResourcesListerClient, socketPath string) Check {
+	return Check{
+		Name: "podresources-socket",
+		Run: func(ctx context.Context) Result {
+			ctx, cancel := context.WithTimeout(ctx, podResourcesTimeout)
+			defer cancel()
+
+			hint := fmt.Sprintf("make sure --podresources-socket %q is the kubelet podresources socket and it is mounted in the container", socketPath)
+			allocResp, err := cli.GetAllocatableResources(ctx, &podresourcesapi.AllocatableResourcesRequest{})
+			if err != nil {
+				return Fail(hint+", and that the kubelet feature gate KubeletPodResourcesGetAllocatable is enabled", "cannot get the allocatable resources: %v", err)
+			}
+			listResp, err := cli.List(ctx, &podresourcesapi.ListPodResourcesRequest{})
+			if err != nil {
+				return Fail(hint, "cannot list the pod resources: %v", err)
+			}
+			if len(allocResp.GetCpuIds()) == 0 {
+				return Warn("set the kubelet cpuManagerPolicy to static", "the kubelet reports no allocatable cpus")
+			}
+			return Pass("%d allocatable cpus, %d device resources, %d pods", len(allocResp.GetCpuIds()), len(allocResp.GetDevices()), len(listResp.GetPodResources()))
+		},
+	}
+}
+
+// CheckReferenceContainer looks for the reference container in the pods the kubelet reports
+func CheckReferenceContainer(cli podresourcesapi.PodResourcesListerClient, refCnt *podrescli.ContainerIdent) Check {
+	return Check{
+		Name: "reference-container",
+		Run: func(ctx context.Context) Result {
+			if refCnt == nil || refCnt.IsEmpty() {
+				return Pass("not set")
+			}
+			ctx, cancel := context.WithTimeout(ctx, podResourcesTimeout)
+			defer cancel()
+
+			resp, err := cli.List(ctx, &podresourcesapi.ListPodResourcesRequest{})
+			if err != nil {
+				return Fail("fix the podresources-socket check first", "cannot list the pod resources: %v", err)
+			}
+			cpus, found := sharedpool.FindContainerCPUs(refCnt, resp)
+			if !found {
+				return Fail("check --reference-container or the REFERENCE_NAMESPACE, REFERENCE_POD_NAME, REFERENCE_CONTAINER_NAME env vars", "container %s not found", refCnt.String())
+			}
+			return Pass("container %s runs on cpus %q", refCnt.String(), cpus.String())
+		},
+	}
+}
+
+// CheckKubeletConfig reports the resource managers policies which make the topology data less useful
+func CheckKubeletConfig(topoInfo nrtupdater.TopologyInfo, topoErr error) Check {
+	return Check{
+		Name: "kubelet-config",
+		Run: func(ctx context.Context) Result {
+			if topoErr != nil {
+				return Fail("check --kubelet-config-file, or set both --topology-manager-policy and --topology-manager-scope", "%v", topoErr)
+			}
+			issues := []string{}
+			if topoInfo.TopologyManagerPolicy == "none" {
+				issues = append(issues, "the topology manager policy is none, the resources are not NUMA aligned")
+			}
+			switch topoInfo.CPUManagerPolicy {
+			case "static":
+			case "":
+				issues = append(issues, "the cpu manager policy is not set in the kubelet configuration, or the configuration is not readable")
+			default:
+				issues = append(issues, fmt.Sprintf("the cpu manager policy is %q, the exclusive cpus are not reported", topoInfo.CPUManagerPolicy))
+			}
+			if len(issues) > 0 {
+				return Warn("set the kubelet cpuManagerPolicy to static and topologyManagerPolicy to single-numa-node or restricted, and mount the kubelet configuration", "%s", strings.Join(issues, "; "))
+			}
+			return Pass("topology manager policy %q scope %q, cpu manager policy %q", topoInfo.TopologyManagerPolicy, topoInfo.TopologyManagerScope, topoInfo.CPUManagerPolicy)
+		},
+	}
+}
+
+// CheckSysfs reads the NUMA nodes and the online cpus, like the resource monitor does
+func CheckSysfs(sysfsRoot string) Check {
+	return Check{
+		Name: "sysfs",
+		Run: func(ctx context.Context) Result {
+			hint := fmt.Sprintf("make sure --sysfs %q is the host sysfs, mounted read-only in the container", sysfsRoot)
+			nodes, err := filepath.Glob(filepath.Join(sysfsRoot, "devices", "system", "node", "node[0-9]*"))
+			if err != nil {
+				return Fail(hint, "cannot list the NUMA nodes: %v", err)
+			}
+			if len(nodes) == 0 {
+				return Fail(hint, "no NUMA nodes found in %q", sysfsRoot)
+			}
+			online, err := ioutil.ReadFile(filepath.Join(sysfsRoot, "devices", "system", "cpu", "online"))
+			if err != nil {
+				return Fail(hint, "cannot read the online cpus: %v", err)
+			}
+			return Pass("%d NUMA nodes, online cpus %q", len(nodes), strings.TrimSpace(string(online)))
+		},
+	}
+}
+
+// CheckConfigFile reports the configuration which cannot be read, and the unknown keys the exporter ignores
+func CheckConfigFile(configPath string) Check {
+	return Check{
+		Name: "config-file",
+		Run: func(ctx context.Context) Result {
+			data, err := ioutil.ReadFile(configPath)
+			if errors.Is(err, os.ErrNotExist) {
+				return Warn("if a configuration is expected, check --config and the configmap mount", "%q not found, using the defaults", configPath)
+			}
+			if err != nil {
+				return Fail("check the permissions of --config", "cannot read %q: %v", configPath, err)
+			}
+			conf := config.Config{}
+			if err := yaml.Unmarshal(data, &conf); err != nil {
+				return Fail("fix the YAML syntax", "cannot parse %q: %v", configPath, err)
+			}
+			if err := yaml.UnmarshalStrict(data, &config.Config{}); err != nil {
+				return Warn("remove or fix the unknown keys, which are ignored", "%q: %v", configPath, err)
+			}
+			return Pass("%q: %d excluded resource lists, %d sinks", configPath, len(conf.ExcludeList), len(conf.Sinks))
+		},
+	}
+}
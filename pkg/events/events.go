@@ -0,0 +1,116 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package events records the Kubernetes Events about the topology and the exporter state
+// against the node and the exporter pod, so the cluster tooling can alert on them.
+package events
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/version"
+)
+
+const (
+	ReasonZoneExhausted         = "ZoneExhausted"
+	ReasonZoneCapacityChanged   = "ZoneCapacityChanged"
+	ReasonSysinfoFallbackActive = "SysinfoFallbackActive"
+	ReasonPublishFailed         = "PublishFailed"
+	ReasonConfigReloaded        = "ConfigReloaded"
+)
+
+const (
+	// a flapping zone must not flood the apiserver: after the burst, one event every minute per object
+	burstSize   = 10
+	refillEvery = time.Minute
+	// the identical events within this window are merged, bumping the count of the first one
+	maxIntervalInSeconds = 600
+)
+
+// Recorder emits the events against the node and, if known, the exporter pod. The events are
+// emitted only on transitions; on top of that, the correlator of the client-go broadcaster
+// deduplicates and rate limits them. All the methods are safe on a nil Recorder, which emits
+// nothing: the packages taking a Recorder accept nil to disable the events.
+type Recorder struct {
+	recorder record.EventRecorder
+	nodeRef  *corev1.ObjectReference
+	podRef   *corev1.ObjectReference
+}
+
+// NewRecorder sends the events to the apiserver. The pod namespace and name may be empty.
+// The node is read once, because the events must reference its UID to show up in its description.
+func NewRecorder(ctx context.Context, cs kubernetes.Interface, nodeName, podNamespace, podName string) (*Recorder, error) {
+	node, err := cs.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot get the node %q: %w", nodeName, err)
+	}
+	broadcaster := record.NewBroadcasterWithCorrelatorOptions(record.CorrelatorOptions{
+		BurstSize:            burstSize,
+		QPS:                  float32(1 / refillEvery.Seconds()),
+		MaxIntervalInSeconds: maxIntervalInSeconds,
+	})
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: cs.CoreV1().Events("")})
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: version.ProgramName, Host: nodeName})
+	return NewRecorderFromEventRecorder(recorder, node, podNamespace, podName), nil
+}
+
+// NewRecorderFromEventRecorder uses the given recorder, e.g. a record.FakeRecorder
+func NewRecorderFromEventRecorder(recorder record.EventRecorder, node *corev1.Node, podNamespace, podName string) *Recorder {
+	rec := &Recorder{
+		recorder: recorder,
+		nodeRef: &corev1.ObjectReference{
+			Kind: "Node",
+			Name: node.Name,
+			UID:  node.UID,
+		},
+	}
+	if podNamespace != "" && podName != "" {
+		rec.podRef = &corev1.ObjectReference{
+			Kind:      "Pod",
+			Namespace: podNamespace,
+			Name:      podName,
+		}
+	}
+	return rec
+}
+
+// Nodef records an event about the node resources
+func (rec *Recorder) Nodef(eventType, reason, messageFmt string, args ...interface{}) {
+	if rec == nil {
+		return
+	}
+	klog.V(2).Infof("event %s/%s on node %s", eventType, reason, rec.nodeRef.Name)
+	rec.recorder.Eventf(rec.nodeRef, eventType, reason, messageFmt, args...)
+}
+
+// Exporterf records an event about the exporter itself, against both the node and the exporter pod
+func (rec *Recorder) Exporterf(eventType, reason, messageFmt string, args ...interface{}) {
+	if rec == nil {
+		return
+	}
+	rec.Nodef(eventType, reason, messageFmt, args...)
+	if rec.podRef != nil {
+		rec.recorder.Eventf(rec.podRef, eventType, reason, messageFmt, args...)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/k8stopologyawareschedwg/noderesourcetopology-api/pkg/apis/topology/v1alpha1"
+)
+
+var testNode = &corev1.Node{
+	ObjectMeta: metav1.ObjectMeta{Name: "node", UID: "node-uid"},
+}
+
+// refRecorder keeps the objects the events are about, which the FakeRecorder drops
+type refRecorder struct {
+	refs []*corev1.ObjectReference
+}
+
+func (rr *refRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	rr.refs = append(rr.refs, object.(*corev1.ObjectReference))
+}
+
+func (rr *refRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	rr.Event(object, eventtype, reason, messageFmt)
+}
+
+func (rr *refRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	rr.Event(object, eventtype, reason, messageFmt)
+}
+
+func makeZone(name, capacity, available string) v1alpha1.Zone {
+	return v1alpha1.Zone{
+		Name: name,
+		Type: "Node",
+		Resources: v1alpha1.ResourceInfoList{
+			{
+				Name:        "cpu",
+				Capacity:    resource.MustParse(capacity),
+				Allocatable: resource.MustParse(capacity),
+				Available:   resource.MustParse(available),
+			},
+		},
+	}
+}
+
+func drain(fr *record.FakeRecorder) []string {
+	got := []string{}
+	for {
+		select {
+		case ev := <-fr.Events:
+			got = append(got, ev)
+		default:
+			return got
+		}
+	}
+}
+
+func TestZoneTracker(t *testing.T) {
+	fr := record.NewFakeRecorder(10)
+	zt := NewZoneTracker(NewRecorderFromEventRecorder(fr, testNode, "", ""))
+
+	testCases := []struct {
+		name     string
+		zones    v1alpha1.ZoneList
+		expected []string
+	}{
+		{
+			"baseline",
+			v1alpha1.ZoneList{makeZone("node-0", "8", "4"), makeZone("node-1", "8", "0")},
+			[]string{},
+		},
+		{
+			"exhausted",
+			v1alpha1.ZoneList{makeZone("node-0", "8", "0"), makeZone("node-1", "8", "0")},
+			[]string{"Warning ZoneExhausted zone node-0 has no available cpu left"},
+		},
+		{
+			"still exhausted",
+			v1alpha1.ZoneList{makeZone("node-0", "8", "0"), makeZone("node-1", "8", "0")},
+			[]string{},
+		},
+		{
+			"capacity changed",
+			v1alpha1.ZoneList{makeZone("node-0", "8", "2"), makeZone("node-1", "6", "0")},
+			[]string{"Normal ZoneCapacityChanged zone node-1: cpu capacity 8->6 allocatable 8->6"},
+		},
+		{
+			"zone gone",
+			v1alpha1.ZoneList{makeZone("node-0", "8", "2")},
+			[]string{"Normal ZoneCapacityChanged zone node-1 disappeared"},
+		},
+	}
+	for _, tc := range testCases {
+		zt.Observe(tc.zones)
+		got := drain(fr)
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: got %v expected %v", tc.name, got, tc.expected)
+		}
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	var nilRec *Recorder
+	// must not crash
+	nilRec.Exporterf("Warning", ReasonPublishFailed, "fake")
+
+	fr := record.NewFakeRecorder(10)
+	NewRecorderFromEventRecorder(fr, testNode, "ns", "rte-abcde").Exporterf("Normal", ReasonConfigReloaded, "reloaded")
+	if got := drain(fr); len(got) != 2 {
+		t.Errorf("expected node and pod events, got %v", got)
+	}
+	NewRecorderFromEventRecorder(fr, testNode, "", "").Exporterf("Normal", ReasonConfigReloaded, "reloaded")
+	if got := drain(fr); len(got) != 1 {
+		t.Errorf("expected only the node event, got %v", got)
+	}
+
+	rr := &refRecorder{}
+	NewRecorderFromEventRecorder(rr, testNode, "", "").Nodef("Normal", ReasonZoneCapacityChanged, "changed")
+	expected := []*corev1.ObjectReference{{Kind: "Node", Name: "node", UID: "node-uid"}}
+	if !reflect.DeepEqual(rr.refs, expected) {
+		t.Errorf("got references %v, want %v", rr.refs, expected)
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/k8stopologyawareschedwg/noderesourcetopology-api/pkg/apis/topology/v1alpha1"
+)
+
+type resourceState struct {
+	capacity    string
+	allocatable string
+	exhausted   bool
+}
+
+// ZoneTracker compares the zones of consecutive scans and records their transitions.
+// The first scan is the baseline and records nothing.
+type ZoneTracker struct {
+	rec *Recorder
+
+	lock sync.Mutex
+	// by zone name, then by resource name
+	last map[string]map[string]resourceState
+}
+
+func NewZoneTracker(rec *Recorder) *ZoneTracker {
+	return &ZoneTracker{
+		rec: rec,
+	}
+}
+
+func (zt *ZoneTracker) Observe(zones v1alpha1.ZoneList) {
+	zt.lock.Lock()
+	defer zt.lock.Unlock()
+
+	cur := make(map[string]map[string]resourceState)
+	for _, zone := range zones {
+		states := make(map[string]resourceState)
+		for _, res := range zone.Resources {
+			states[res.Name] = resourceState{
+				capacity:    res.Capacity.String(),
+				allocatable: res.Allocatable.String(),
+				exhausted:   res.Allocatable.Sign() > 0 && res.Available.Sign() <= 0,
+			}
+		}
+		cur[zone.Name] = states
+	}
+	if zt.last != nil {
+		zt.compare(cur)
+	}
+	zt.last = cur
+}
+
+func (zt *ZoneTracker) compare(cur map[string]map[string]resourceState) {
+	for _, zoneName := range zoneNames(cur) {
+		states := cur[zoneName]
+		prev, ok := zt.last[zoneName]
+		if !ok {
+			zt.rec.Nodef(corev1.EventTypeNormal, ReasonZoneCapacityChanged, "zone %s appeared", zoneName)
+			continue
+		}
+		exhausted := []string{}
+		changed := []string{}
+		for _, resName := range resourceNames(states) {
+			st := states[resName]
+			pst, ok := prev[resName]
+			if !ok {
+				changed = append(changed, fmt.Sprintf("%s added (capacity %s allocatable %s)", resName, st.capacity, st.allocatable))
+				continue
+			}
+			if st.capacity != pst.capacity || st.allocatable != pst.allocatable {
+				changed = append(changed, fmt.Sprintf("%s capacity %s->%s allocatable %s->%s", resName, pst.capacity, st.capacity, pst.allocatable, st.allocatable))
+			}
+			if st.exhausted && !pst.exhausted {
+				exhausted = append(exhausted, resName)
+			}
+		}
+		for _, resName := range resourceNames(prev) {
+			if _, ok := states[resName]; !ok {
+				changed = append(changed, fmt.Sprintf("%s removed", resName))
+			}
+		}
+		if len(exhausted) > 0 {
+			zt.rec.Nodef(corev1.EventTypeWarning, ReasonZoneExhausted, "zone %s has no available %s left", zoneName, strings.Join(exhausted, ", "))
+		}
+		if len(changed) > 0 {
+			zt.rec.Nodef(corev1.EventTypeNormal, ReasonZoneCapacityChanged, "zone %s: %s", zoneName, strings.Join(changed, "; "))
+		}
+	}
+	for _, zoneName := range zoneNames(zt.last) {
+		if _, ok := cur[zoneName]; !ok {
+			zt.rec.Nodef(corev1.EventTypeNormal, ReasonZoneCapacityChanged, "zone %s disappeared", zoneName)
+		}
+	}
+}
+
+func zoneNames(zones map[string]map[string]resourceState) []string {
+	names := make([]string, 0, len(zones))
+	for name := range zones {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func resourceNames(states map[string]resourceState) []string {
+	names := make([]string, 0, len(states))
+	for name := range states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
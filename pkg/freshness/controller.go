@@ -0,0 +1,133 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package freshness
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// TaintKey is owned by the controller: it is removed also from the nodes not reporting the condition anymore
+	TaintKey = "k8stopoawareschedwg/topology-info-stale"
+)
+
+type ControllerArgs struct {
+	// StalenessThreshold is how long the condition can be false or without heartbeats before tainting the node
+	StalenessThreshold time.Duration
+	ResyncInterval     time.Duration
+	DryRun             bool
+}
+
+// Controller taints the nodes whose TopologyInfoFresh condition is stale
+type Controller struct {
+	cli  NodeClient
+	args ControllerArgs
+	now  func() time.Time
+}
+
+func NewController(cli NodeClient, args ControllerArgs) *Controller {
+	return &Controller{
+		cli:  cli,
+		args: args,
+		now:  time.Now,
+	}
+}
+
+// IsStale tells if the topology data of the node is outdated. Nodes without the condition are never stale.
+func IsStale(node *corev1.Node, now time.Time, threshold time.Duration) bool {
+	cond := FindCondition(node)
+	if cond == nil {
+		return false
+	}
+	if now.Sub(cond.LastHeartbeatTime.Time) > threshold {
+		return true
+	}
+	return cond.Status != corev1.ConditionTrue && now.Sub(cond.LastTransitionTime.Time) > threshold
+}
+
+func (ctrl *Controller) Run(stopCh <-chan struct{}) {
+	wait.Until(func() {
+		if err := ctrl.Sync(); err != nil {
+			logger.ErrorS(err, "failed to sync the node taints")
+		}
+	}, ctrl.args.ResyncInterval, stopCh)
+}
+
+// Sync adds or removes the taint on all the nodes. Returns the last error, after trying all the nodes.
+func (ctrl *Controller) Sync() error {
+	nodes, err := ctrl.cli.ListNodes()
+	if err != nil {
+		return err
+	}
+	now := ctrl.now()
+	var lastErr error
+	for idx := range nodes {
+		node := &nodes[idx]
+		stale := IsStale(node, now, ctrl.args.StalenessThreshold)
+		if stale == hasTaint(node) {
+			continue
+		}
+		if ctrl.args.DryRun {
+			logger.InfoS("would update the taint", "node", node.Name, "stale", stale, "taint", TaintKey)
+			continue
+		}
+		if err := ctrl.setTaint(node.Name, stale); err != nil {
+			logger.ErrorS(err, "cannot update the taint", "node", node.Name, "taint", TaintKey)
+			lastErr = err
+			continue
+		}
+		logger.InfoS("updated the taint", "node", node.Name, "stale", stale, "taint", TaintKey)
+	}
+	return lastErr
+}
+
+func (ctrl *Controller) setTaint(nodeName string, stale bool) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := ctrl.cli.GetNode(nodeName)
+		if err != nil {
+			return err
+		}
+		if stale == hasTaint(node) {
+			return nil
+		}
+		taints := []corev1.Taint{}
+		for _, taint := range node.Spec.Taints {
+			if taint.Key != TaintKey {
+				taints = append(taints, taint)
+			}
+		}
+		if stale {
+			taints = append(taints, corev1.Taint{
+				Key:    TaintKey,
+				Effect: corev1.TaintEffectNoSchedule,
+			})
+		}
+		node.Spec.Taints = taints
+		return ctrl.cli.UpdateNode(node)
+	})
+}
+
+func hasTaint(node *corev1.Node) bool {
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == TaintKey {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package freshness tells the cluster if the topology data of a node can be trusted. The exporter
+// maintains the TopologyInfoFresh node condition; the controller taints the nodes whose condition
+// is stale, so the latency-sensitive pods are not scheduled against outdated NUMA data.
+package freshness
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/logging"
+)
+
+var logger = logging.Component("freshness")
+
+const (
+	ConditionTopologyInfoFresh corev1.NodeConditionType = "TopologyInfoFresh"
+)
+
+const (
+	ReasonTopologyPublished = "TopologyPublished"
+	ReasonPublishFailed     = "PublishFailed"
+	ReasonCRDNotServed      = "CRDNotServed"
+)
+
+type Args struct {
+	// Enabled maintains the node condition
+	Enabled bool
+	// HeartbeatInterval is the maximum time between condition writes when nothing changes.
+	// The heartbeat is written only after a publish attempt, so a wedged exporter stops it.
+	HeartbeatInterval time.Duration
+}
+
+// NodeClient is the subset of the node API the reporter and the controller need
+type NodeClient interface {
+	GetNode(name string) (*corev1.Node, error)
+	ListNodes() ([]corev1.Node, error)
+	UpdateNode(node *corev1.Node) error
+	PatchNodeStatus(name string, data []byte) error
+}
+
+type clientsetNodeClient struct {
+	cs kubernetes.Interface
+}
+
+func NewClientsetNodeClient(cs kubernetes.Interface) NodeClient {
+	return clientsetNodeClient{cs: cs}
+}
+
+func (cc clientsetNodeClient) GetNode(name string) (*corev1.Node, error) {
+	return cc.cs.CoreV1().Nodes().Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+func (cc clientsetNodeClient) ListNodes() ([]corev1.Node, error) {
+	nodes, err := cc.cs.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return nodes.Items, nil
+}
+
+func (cc clientsetNodeClient) UpdateNode(node *corev1.Node) error {
+	_, err := cc.cs.CoreV1().Nodes().Update(context.TODO(), node, metav1.UpdateOptions{})
+	return err
+}
+
+func (cc clientsetNodeClient) PatchNodeStatus(name string, data []byte) error {
+	_, err := cc.cs.CoreV1().Nodes().PatchStatus(context.TODO(), name, data)
+	return err
+}
+
+// Reporter maintains the condition out of the publish results
+type Reporter struct {
+	cli      NodeClient
+	nodeName string
+	args     Args
+	now      func() time.Time
+
+	lock sync.Mutex
+	last *corev1.NodeCondition
+}
+
+func NewReporter(cli NodeClient, nodeName string, args Args) *Reporter {
+	return &Reporter{
+		cli:      cli,
+		nodeName: nodeName,
+		args:     args,
+		now:      time.Now,
+	}
+}
+
+// Observe records the result of a publish attempt. Errors writing the condition are only logged:
+// the controller treats the missing heartbeats as staleness anyway.
+func (rep *Reporter) Observe(publishErr error) {
+	if publishErr != nil {
+		rep.update(corev1.ConditionFalse, ReasonPublishFailed, fmt.Sprintf("cannot publish the topology data: %v", publishErr))
+		return
+	}
+	rep.update(corev1.ConditionTrue, ReasonTopologyPublished, "the topology data is up to date")
+}
+
+// ObserveCRDNotServed records that the exporter waits for the NodeResourceTopology CRD before publishing
+func (rep *Reporter) ObserveCRDNotServed(err error) {
+	rep.update(corev1.ConditionFalse, ReasonCRDNotServed, fmt.Sprintf("waiting for the NodeResourceTopology CRD: %v", err))
+}
+
+func (rep *Reporter) update(status corev1.ConditionStatus, reason, message string) {
+	rep.lock.Lock()
+	defer rep.lock.Unlock()
+
+	if rep.last == nil {
+		rep.last = rep.currentCondition()
+	}
+
+	now := metav1.NewTime(rep.now())
+	cond := corev1.NodeCondition{
+		Type:              ConditionTopologyInfoFresh,
+		Status:            status,
+		Reason:            reason,
+		Message:           message,
+		LastHeartbeatTime: now,
+	}
+
+	if rep.last != nil && rep.last.Status == cond.Status {
+		cond.LastTransitionTime = rep.last.LastTransitionTime
+		if rep.last.Reason == cond.Reason && now.Sub(rep.last.LastHeartbeatTime.Time) < rep.args.HeartbeatInterval {
+			return
+		}
+	} else {
+		cond.LastTransitionTime = now
+	}
+
+	if err := rep.write(cond); err != nil {
+		logger.ErrorS(err, "cannot set the node condition", "node", rep.nodeName, "condition", ConditionTopologyInfoFresh)
+		return
+	}
+	logger.V(4).InfoS("set the node condition", "node", rep.nodeName, "condition", ConditionTopologyInfoFresh, "status", cond.Status, "reason", cond.Reason)
+	rep.last = &cond
+}
+
+// currentCondition keeps the transition time across the exporter restarts
+func (rep *Reporter) currentCondition() *corev1.NodeCondition {
+	node, err := rep.cli.GetNode(rep.nodeName)
+	if err != nil {
+		logger.ErrorS(err, "cannot get the node", "node", rep.nodeName)
+		return nil
+	}
+	return FindCondition(node)
+}
+
+func (rep *Reporter) write(cond corev1.NodeCondition) error {
+	// conditions are merged by type
+	data, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []corev1.NodeCondition{cond},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return rep.cli.PatchNodeStatus(rep.nodeName, data)
+}
+
+func FindCondition(node *corev1.Node) *corev1.NodeCondition {
+	for idx := range node.Status.Conditions {
+		if node.Status.Conditions[idx].Type == ConditionTopologyInfoFresh {
+			return &node.Status.Conditions[idx]
+		}
+	}
+	return nil
+}
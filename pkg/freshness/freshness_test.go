@@ -0,0 +1,179 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package freshness
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type fakeNodeClient struct {
+	nodes   map[string]*corev1.Node
+	patches []corev1.NodeCondition
+	updates int
+}
+
+func (fc *fakeNodeClient) GetNode(name string) (*corev1.Node, error) {
+	node, ok := fc.nodes[name]
+	if !ok {
+		return nil, fmt.Errorf("node %q not found", name)
+	}
+	return node.DeepCopy(), nil
+}
+
+func (fc *fakeNodeClient) ListNodes() ([]corev1.Node, error) {
+	ret := []corev1.Node{}
+	for _, node := range fc.nodes {
+		ret = append(ret, *node.DeepCopy())
+	}
+	return ret, nil
+}
+
+func (fc *fakeNodeClient) UpdateNode(node *corev1.Node) error {
+	fc.updates++
+	fc.nodes[node.Name] = node.DeepCopy()
+	return nil
+}
+
+func (fc *fakeNodeClient) PatchNodeStatus(name string, data []byte) error {
+	patch := struct {
+		Status struct {
+			Conditions []corev1.NodeCondition `json:"conditions"`
+		} `json:"status"`
+	}{}
+	if err := json.Unmarshal(data, &patch); err != nil {
+		return err
+	}
+	fc.patches = append(fc.patches, patch.Status.Conditions...)
+	return nil
+}
+
+func makeNode(name string, cond *corev1.NodeCondition, tainted bool) *corev1.Node {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if cond != nil {
+		node.Status.Conditions = []corev1.NodeCondition{*cond}
+	}
+	if tainted {
+		node.Spec.Taints = []corev1.Taint{{Key: TaintKey, Effect: corev1.TaintEffectNoSchedule}}
+	}
+	return node
+}
+
+func TestReporter(t *testing.T) {
+	fc := &fakeNodeClient{nodes: map[string]*corev1.Node{"node": makeNode("node", nil, false)}}
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	rep := NewReporter(fc, "node", Args{Enabled: true, HeartbeatInterval: time.Minute})
+	rep.now = func() time.Time { return now }
+
+	rep.Observe(nil)
+	now = now.Add(10 * time.Second)
+	// nothing changed, before the heartbeat
+	rep.Observe(nil)
+	now = now.Add(time.Minute)
+	rep.Observe(nil)
+	now = now.Add(10 * time.Second)
+	rep.Observe(fmt.Errorf("fake error"))
+
+	if len(fc.patches) != 3 {
+		t.Fatalf("unexpected condition writes: %+v", fc.patches)
+	}
+	hb := fc.patches[1]
+	if hb.Status != corev1.ConditionTrue || !hb.LastTransitionTime.Equal(&fc.patches[0].LastTransitionTime) || hb.LastHeartbeatTime.Equal(&fc.patches[0].LastHeartbeatTime) {
+		t.Errorf("unexpected heartbeat: %+v", hb)
+	}
+	failed := fc.patches[2]
+	if failed.Status != corev1.ConditionFalse || failed.Reason != ReasonPublishFailed || !failed.LastTransitionTime.Equal(&failed.LastHeartbeatTime) {
+		t.Errorf("unexpected failure condition: %+v", failed)
+	}
+}
+
+func TestReporterCRDNotServed(t *testing.T) {
+	fc := &fakeNodeClient{nodes: map[string]*corev1.Node{"node": makeNode("node", nil, false)}}
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	rep := NewReporter(fc, "node", Args{Enabled: true, HeartbeatInterval: time.Minute})
+	rep.now = func() time.Time { return now }
+
+	rep.ObserveCRDNotServed(fmt.Errorf("fake error"))
+	now = now.Add(10 * time.Second)
+	// same status, the reason changes
+	rep.Observe(fmt.Errorf("fake error"))
+
+	if len(fc.patches) != 2 {
+		t.Fatalf("unexpected condition writes: %+v", fc.patches)
+	}
+	waiting := fc.patches[0]
+	if waiting.Status != corev1.ConditionFalse || waiting.Reason != ReasonCRDNotServed {
+		t.Errorf("unexpected waiting condition: %+v", waiting)
+	}
+	if !fc.patches[1].LastTransitionTime.Equal(&waiting.LastTransitionTime) {
+		t.Errorf("unexpected transition: %+v", fc.patches[1])
+	}
+}
+
+func TestReporterKeepsTransitionTime(t *testing.T) {
+	since := metav1.NewTime(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	cond := &corev1.NodeCondition{Type: ConditionTopologyInfoFresh, Status: corev1.ConditionTrue, Reason: ReasonTopologyPublished, LastTransitionTime: since, LastHeartbeatTime: since}
+	fc := &fakeNodeClient{nodes: map[string]*corev1.Node{"node": makeNode("node", cond, false)}}
+	NewReporter(fc, "node", Args{Enabled: true, HeartbeatInterval: time.Minute}).Observe(nil)
+	if len(fc.patches) != 1 || !fc.patches[0].LastTransitionTime.Equal(&since) {
+		t.Errorf("unexpected condition writes: %+v", fc.patches)
+	}
+}
+
+func TestController(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) metav1.Time { return metav1.NewTime(now.Add(-d)) }
+	fc := &fakeNodeClient{nodes: map[string]*corev1.Node{
+		"fresh":       makeNode("fresh", &corev1.NodeCondition{Type: ConditionTopologyInfoFresh, Status: corev1.ConditionTrue, LastHeartbeatTime: at(time.Minute), LastTransitionTime: at(time.Hour)}, true),
+		"failing":     makeNode("failing", &corev1.NodeCondition{Type: ConditionTopologyInfoFresh, Status: corev1.ConditionFalse, LastHeartbeatTime: at(time.Minute), LastTransitionTime: at(10 * time.Minute)}, false),
+		"just-failed": makeNode("just-failed", &corev1.NodeCondition{Type: ConditionTopologyInfoFresh, Status: corev1.ConditionFalse, LastHeartbeatTime: at(time.Minute), LastTransitionTime: at(time.Minute)}, false),
+		"silent":      makeNode("silent", &corev1.NodeCondition{Type: ConditionTopologyInfoFresh, Status: corev1.ConditionTrue, LastHeartbeatTime: at(time.Hour), LastTransitionTime: at(time.Hour)}, false),
+		"unmanaged":   makeNode("unmanaged", nil, false),
+	}}
+	ctrl := NewController(fc, ControllerArgs{StalenessThreshold: 5 * time.Minute, ResyncInterval: time.Minute})
+	ctrl.now = func() time.Time { return now }
+
+	if err := ctrl.Sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]bool{
+		"fresh":       false,
+		"failing":     true,
+		"just-failed": false,
+		"silent":      true,
+		"unmanaged":   false,
+	}
+	for name, tainted := range expected {
+		if hasTaint(fc.nodes[name]) != tainted {
+			t.Errorf("node %q: expected tainted=%v", name, tainted)
+		}
+	}
+	if fc.updates != 3 {
+		t.Errorf("unexpected node updates: %d", fc.updates)
+	}
+
+	// nothing to do on the next round
+	if err := ctrl.Sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fc.updates != 3 {
+		t.Errorf("unexpected node updates: %d", fc.updates)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/k8stopologyawareschedwg/noderesourcetopology-api/pkg/apis/topology/v1alpha1"
+)
+
+type Args struct {
+	// Address to serve the health and the debug endpoints on. Empty disables the server.
+	Address string
+	// PProf serves the runtime profiles on /debug/pprof/
+	PProf bool
+	// Intervals is the number of sleep intervals the checks tolerate without progress
+	Intervals int
+}
+
+// Tracker follows the progress of the update loop. The loop is healthy as long as it is triggered,
+// and ready as long as the scans and the publishes succeed.
+type Tracker struct {
+	window time.Duration
+	now    func() time.Time
+
+	lock        sync.Mutex
+	started     time.Time
+	lastTrigger time.Time
+	lastScan    time.Time
+	lastPublish time.Time
+	scanErr     error
+	publishErr  error
+	zones       v1alpha1.ZoneList
+}
+
+func NewTracker(sleepInterval time.Duration, intervals int) *Tracker {
+	if intervals < 1 {
+		intervals = 1
+	}
+	tr := &Tracker{
+		window: sleepInterval * time.Duration(intervals),
+		now:    time.Now,
+	}
+	tr.started = tr.now()
+	return tr
+}
+
+// ObserveTrigger records a trigger accepted by the update loop. A nil tracker does nothing.
+func (tr *Tracker) ObserveTrigger() {
+	if tr == nil {
+		return
+	}
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+	tr.lastTrigger = tr.now()
+}
+
+// ObserveScan records the result of a scan. A nil tracker does nothing.
+func (tr *Tracker) ObserveScan(err error) {
+	if tr == nil {
+		return
+	}
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+	tr.scanErr = err
+	if err == nil {
+		tr.lastScan = tr.now()
+	}
+}
+
+// ObserveUpdate records the zones and the result of their publish. A nil tracker does nothing.
+func (tr *Tracker) ObserveUpdate(zones v1alpha1.ZoneList, err error) {
+	if tr == nil {
+		return
+	}
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+	tr.zones = zones
+	tr.publishErr = err
+	if err == nil {
+		tr.lastPublish = tr.now()
+	}
+}
+
+// Zones returns the zones of the last update
+func (tr *Tracker) Zones() v1alpha1.ZoneList {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+	return tr.zones
+}
+
+// Healthy fails if the update loop was not triggered within the window, the loop is likely wedged
+func (tr *Tracker) Healthy() error {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+	last := tr.lastTrigger
+	if last.IsZero() {
+		last = tr.started
+	}
+	if since := tr.now().Sub(last); since > tr.window {
+		return fmt.Errorf("no update triggered in the last %v", since.Round(time.Second))
+	}
+	return nil
+}
+
+// Ready fails unless both a scan and a publish succeeded within the window
+func (tr *Tracker) Ready() error {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+	now := tr.now()
+	if err := checkRecent(now, tr.lastScan, tr.window, "scan", tr.scanErr); err != nil {
+		return err
+	}
+	return checkRecent(now, tr.lastPublish, tr.window, "publish", tr.publishErr)
+}
+
+func checkRecent(now, last time.Time, window time.Duration, what string, lastErr error) error {
+	if !last.IsZero() && now.Sub(last) <= window {
+		return nil
+	}
+	msg := fmt.Sprintf("no successful %s", what)
+	if !last.IsZero() {
+		msg = fmt.Sprintf("%s in the last %v", msg, now.Sub(last).Round(time.Second))
+	}
+	if lastErr != nil {
+		return fmt.Errorf("%s: %v", msg, lastErr)
+	}
+	return fmt.Errorf("%s", msg)
+}
@@ -0,0 +1,209 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/k8stopologyawareschedwg/noderesourcetopology-api/pkg/apis/topology/v1alpha1"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (fc *fakeClock) Now() time.Time {
+	return fc.now
+}
+
+func newFakeTracker(fc *fakeClock) *Tracker {
+	tr := NewTracker(time.Minute, 3)
+	tr.now = fc.Now
+	tr.started = fc.now
+	return tr
+}
+
+func TestHealthy(t *testing.T) {
+	fc := &fakeClock{now: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+	tr := newFakeTracker(fc)
+
+	fc.now = fc.now.Add(2 * time.Minute)
+	if err := tr.Healthy(); err != nil {
+		t.Errorf("unhealthy within the window since the start: %v", err)
+	}
+	fc.now = fc.now.Add(2 * time.Minute)
+	if err := tr.Healthy(); err == nil {
+		t.Errorf("healthy without triggers")
+	}
+	tr.ObserveTrigger()
+	fc.now = fc.now.Add(3 * time.Minute)
+	if err := tr.Healthy(); err != nil {
+		t.Errorf("unhealthy within the window since the trigger: %v", err)
+	}
+	fc.now = fc.now.Add(time.Second)
+	if err := tr.Healthy(); err == nil {
+		t.Errorf("healthy past the window since the trigger")
+	}
+}
+
+func TestReady(t *testing.T) {
+	testCases := []struct {
+		name       string
+		scanAge    time.Duration
+		scanErr    error
+		publishAge time.Duration
+		publishErr error
+		expected   string
+	}{
+		{
+			name:     "never scanned",
+			scanAge:  -1,
+			expected: "no successful scan",
+		},
+		{
+			name:       "never published",
+			scanAge:    time.Minute,
+			publishAge: -1,
+			publishErr: fmt.Errorf("fake error"),
+			expected:   "no successful publish: fake error",
+		},
+		{
+			name:       "recent",
+			scanAge:    time.Minute,
+			publishAge: time.Minute,
+		},
+		{
+			name:       "recent despite the last scan failing",
+			scanAge:    time.Minute,
+			scanErr:    fmt.Errorf("fake error"),
+			publishAge: time.Minute,
+		},
+		{
+			name:       "old scan",
+			scanAge:    4 * time.Minute,
+			scanErr:    fmt.Errorf("fake error"),
+			publishAge: time.Minute,
+			expected:   "no successful scan in the last 4m0s: fake error",
+		},
+		{
+			name:       "old publish",
+			scanAge:    time.Minute,
+			publishAge: 5 * time.Minute,
+			expected:   "no successful publish in the last 5m0s",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fc := &fakeClock{now: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+			tr := newFakeTracker(fc)
+			now := fc.now.Add(10 * time.Minute)
+			if tc.scanAge >= 0 {
+				fc.now = now.Add(-tc.scanAge)
+				tr.ObserveScan(nil)
+			}
+			if tc.publishAge >= 0 {
+				fc.now = now.Add(-tc.publishAge)
+				tr.ObserveUpdate(nil, nil)
+			}
+			fc.now = now
+			tr.scanErr = tc.scanErr
+			if tc.publishErr != nil {
+				tr.ObserveUpdate(nil, tc.publishErr)
+			}
+
+			err := tr.Ready()
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tc.expected {
+				t.Errorf("got %q, want %q", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestNilTracker(t *testing.T) {
+	var tr *Tracker
+	// must not panic
+	tr.ObserveTrigger()
+	tr.ObserveScan(nil)
+	tr.ObserveUpdate(nil, nil)
+}
+
+func TestServer(t *testing.T) {
+	fc := &fakeClock{now: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+	tr := newFakeTracker(fc)
+	srv := NewServer(Args{PProf: true}, tr)
+	srv.HandleJSON("/debug/config", map[string]string{"foo": "bar"})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	if rr := get("/healthz"); rr.Code != http.StatusOK {
+		t.Errorf("/healthz: unexpected code %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := get("/readyz"); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz: unexpected code %d: %s", rr.Code, rr.Body.String())
+	}
+
+	zones := v1alpha1.ZoneList{{Name: "node-0", Type: "Node"}}
+	tr.ObserveScan(nil)
+	tr.ObserveUpdate(zones, nil)
+	if rr := get("/readyz"); rr.Code != http.StatusOK {
+		t.Errorf("/readyz: unexpected code %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr := get("/debug/zones")
+	got := v1alpha1.ZoneList{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("/debug/zones: cannot decode %q: %v", rr.Body.String(), err)
+	}
+	if len(got) != 1 || got[0].Name != "node-0" {
+		t.Errorf("/debug/zones: unexpected zones: %v", got)
+	}
+
+	if rr := get("/debug/config"); strings.TrimSpace(rr.Body.String()) != `{"foo":"bar"}` {
+		t.Errorf("/debug/config: unexpected body: %q", rr.Body.String())
+	}
+
+	if rr := get("/debug/pprof/"); !strings.Contains(rr.Body.String(), "goroutine") {
+		t.Errorf("/debug/pprof/: unexpected index: %q", rr.Body.String())
+	}
+	if rr := get("/debug/pprof/goroutine?debug=1"); rr.Code != http.StatusOK {
+		t.Errorf("/debug/pprof/goroutine: unexpected code %d", rr.Code)
+	}
+	if rr := get("/debug/pprof/missing"); rr.Code != http.StatusNotFound {
+		t.Errorf("/debug/pprof/missing: unexpected code %d", rr.Code)
+	}
+}
+
+func TestServerNoPProf(t *testing.T) {
+	srv := NewServer(Args{}, NewTracker(time.Minute, 3))
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("pprof served while disabled: %d", rr.Code)
+	}
+}
@@ -0,0 +1,158 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const pprofPrefix = "/debug/pprof/"
+
+// Server serves the health checks and the debug endpoints on its own address,
+// to keep them off the metrics endpoint.
+type Server struct {
+	args    Args
+	tracker *Tracker
+	mux     *http.ServeMux
+}
+
+func NewServer(args Args, tracker *Tracker) *Server {
+	srv := &Server{
+		args:    args,
+		tracker: tracker,
+		mux:     http.NewServeMux(),
+	}
+	srv.mux.HandleFunc("/healthz", serveCheck(tracker.Healthy))
+	srv.mux.HandleFunc("/readyz", serveCheck(tracker.Ready))
+	srv.mux.HandleFunc("/debug/zones", func(w http.ResponseWriter, r *http.Request) {
+		serveJSON(w, "zones", tracker.Zones())
+	})
+	if args.PProf {
+		// net/http/pprof registers itself on the default mux, which the metrics endpoint serves
+		srv.mux.HandleFunc(pprofPrefix, servePProf)
+	}
+	return srv
+}
+
+// HandleJSON serves the JSON encoding of data on path. Use it before Serve.
+func (srv *Server) HandleJSON(path string, data interface{}) {
+	srv.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		serveJSON(w, path, data)
+	})
+}
+
+// Handle serves handler on path. Use it before Serve.
+func (srv *Server) Handle(path string, handler http.Handler) {
+	srv.mux.Handle(path, handler)
+}
+
+func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	srv.mux.ServeHTTP(w, r)
+}
+
+// Serve listens until the context is done
+func (srv *Server) Serve(ctx context.Context) error {
+	hsrv := &http.Server{
+		Addr:    srv.args.Address,
+		Handler: srv,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := hsrv.Shutdown(shutdownCtx); err != nil {
+			klog.Warningf("cannot shut down the health server: %v", err)
+		}
+	}()
+	klog.Infof("serving the health checks on %q", srv.args.Address)
+	if err := hsrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func serveCheck(check func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := check(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, "%v\n", err)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+func serveJSON(w http.ResponseWriter, what string, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		klog.Warningf("cannot encode %s: %v", what, err)
+	}
+}
+
+// servePProf serves the index on the prefix, the cpu profile on "profile" and any other runtime profile by name
+func servePProf(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, pprofPrefix)
+	if name == "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "profile\n")
+		for _, prof := range pprof.Profiles() {
+			fmt.Fprintf(w, "%s %d\n", prof.Name(), prof.Count())
+		}
+		return
+	}
+
+	if name == "profile" {
+		seconds, err := strconv.Atoi(r.URL.Query().Get("seconds"))
+		if err != nil || seconds <= 0 {
+			seconds = 30
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if err := pprof.StartCPUProfile(w); err != nil {
+			http.Error(w, fmt.Sprintf("cannot start the cpu profile: %v", err), http.StatusInternalServerError)
+			return
+		}
+		select {
+		case <-time.After(time.Duration(seconds) * time.Second):
+		case <-r.Context().Done():
+		}
+		pprof.StopCPUProfile()
+		return
+	}
+
+	prof := pprof.Lookup(name)
+	if prof == nil {
+		http.Error(w, fmt.Sprintf("unknown profile %q", name), http.StatusNotFound)
+		return
+	}
+	debug, _ := strconv.Atoi(r.URL.Query().Get("debug"))
+	if debug > 0 {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	if err := prof.WriteTo(w, debug); err != nil {
+		klog.Warningf("cannot write the %s profile: %v", name, err)
+	}
+}
@@ -0,0 +1,55 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8shelpers
+
+import (
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// GetRestConfig returns the in-cluster configuration if kubeConfig is empty
+func GetRestConfig(kubeConfig string) (*restclient.Config, error) {
+	if kubeConfig == "" {
+		return restclient.InClusterConfig()
+	}
+	return clientcmd.BuildConfigFromFlags("", kubeConfig)
+}
+
+func GetK8sClient(kubeConfig string) (*kubernetes.Clientset, error) {
+	config, err := GetRestConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+func GetDynamicClient(kubeConfig string) (dynamic.Interface, error) {
+	config, err := GetRestConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	return dynamic.NewForConfig(config)
+}
+
+func GetDiscoveryClient(kubeConfig string) (discovery.DiscoveryInterface, error) {
+	config, err := GetRestConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	return discovery.NewDiscoveryClientForConfig(config)
+}
@@ -0,0 +1,156 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// jsonLogger writes a JSON object per line. klog filters the verbosity, so all the levels are enabled.
+type jsonLogger struct {
+	out       *jsonOutput
+	level     int
+	name      string
+	values    []interface{}
+	callDepth int
+}
+
+type jsonOutput struct {
+	lock sync.Mutex
+	w    io.Writer
+	now  func() time.Time
+}
+
+// NewJSONLogger is the logr backend of klog for the JSON format
+func NewJSONLogger(w io.Writer) logr.Logger {
+	return jsonLogger{
+		out: &jsonOutput{w: w, now: time.Now},
+	}
+}
+
+func (l jsonLogger) Enabled() bool {
+	return true
+}
+
+func (l jsonLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.write("info", nil, msg, keysAndValues)
+}
+
+func (l jsonLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	l.write("error", err, msg, keysAndValues)
+}
+
+func (l jsonLogger) V(level int) logr.Logger {
+	l.level = level
+	return l
+}
+
+func (l jsonLogger) WithValues(keysAndValues ...interface{}) logr.Logger {
+	l.values = append(append([]interface{}{}, l.values...), keysAndValues...)
+	return l
+}
+
+func (l jsonLogger) WithName(name string) logr.Logger {
+	if l.name != "" {
+		name = l.name + "." + name
+	}
+	l.name = name
+	return l
+}
+
+// WithCallDepth lets klog point the caller past its own frames
+func (l jsonLogger) WithCallDepth(depth int) logr.Logger {
+	l.callDepth += depth
+	return l
+}
+
+func (l jsonLogger) write(level string, err error, msg string, keysAndValues []interface{}) {
+	var buf bytes.Buffer
+	buf.WriteString(`{"ts":`)
+	writeValue(&buf, l.out.now().UTC().Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	writeValue(&buf, level)
+	if level == "info" {
+		buf.WriteString(`,"v":`)
+		buf.WriteString(strconv.Itoa(l.level))
+	}
+	// Info and Error are two frames down the caller
+	if _, file, line, ok := runtime.Caller(l.callDepth + 2); ok {
+		buf.WriteString(`,"caller":`)
+		writeValue(&buf, fmt.Sprintf("%s:%d", filepath.Base(file), line))
+	}
+	if l.name != "" {
+		buf.WriteString(`,"logger":`)
+		writeValue(&buf, l.name)
+	}
+	buf.WriteString(`,"msg":`)
+	// the unstructured klog lines keep their newline
+	writeValue(&buf, strings.TrimSuffix(msg, "\n"))
+	if err != nil {
+		buf.WriteString(`,"err":`)
+		writeValue(&buf, err.Error())
+	}
+	writeKeysAndValues(&buf, l.values)
+	writeKeysAndValues(&buf, keysAndValues)
+	buf.WriteString("}\n")
+
+	l.out.lock.Lock()
+	defer l.out.lock.Unlock()
+	l.out.w.Write(buf.Bytes())
+}
+
+func writeKeysAndValues(buf *bytes.Buffer, keysAndValues []interface{}) {
+	for idx := 0; idx < len(keysAndValues); idx += 2 {
+		key, ok := keysAndValues[idx].(string)
+		if !ok {
+			key = fmt.Sprint(keysAndValues[idx])
+		}
+		var val interface{} = "(MISSING)"
+		if idx+1 < len(keysAndValues) {
+			val = keysAndValues[idx+1]
+		}
+		buf.WriteString(",")
+		writeValue(buf, key)
+		buf.WriteString(":")
+		writeValue(buf, val)
+	}
+}
+
+// writeValue prefers the text of the errors and of the types without a JSON representation
+func writeValue(buf *bytes.Buffer, val interface{}) {
+	switch v := val.(type) {
+	case error:
+		val = v.Error()
+	case json.Marshaler:
+	case fmt.Stringer:
+		val = v.String()
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprintf("%+v", val))
+	}
+	buf.Write(data)
+}
@@ -0,0 +1,191 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package logging lets the components log with key/value pairs through klog, with their own verbosity.
+// The klog output, structured or not, can be rendered as text or as JSON lines.
+package logging
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"k8s.io/klog/v2"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+type Args struct {
+	// Format is the rendering of all the klog output
+	Format string
+	// Verbosity overrides -v for the listed components
+	Verbosity map[string]int
+}
+
+var (
+	lock       sync.RWMutex
+	components = map[string]bool{}
+	verbosity  = map[string]int{}
+	// jsonLog is the logr backend of klog with the JSON format. The verbose component
+	// lines go straight to it, since klog passes their level only through klog.V.
+	jsonLog logr.Logger
+)
+
+// Validate checks the format and the component names, known once the packages are initialized
+func (args Args) Validate() error {
+	switch args.Format {
+	case FormatText, FormatJSON, "":
+	default:
+		return fmt.Errorf("unsupported log format: %q", args.Format)
+	}
+
+	lock.RLock()
+	defer lock.RUnlock()
+	for name := range args.Verbosity {
+		if !components[name] {
+			return fmt.Errorf("unknown logging component %q, known: %s", name, strings.Join(knownComponents(), ", "))
+		}
+	}
+	return nil
+}
+
+// Setup applies the args. nodeName is added to every JSON line.
+func Setup(args Args, nodeName string) error {
+	if err := args.Validate(); err != nil {
+		return err
+	}
+	if args.Format == FormatJSON {
+		setJSONLogger(NewJSONLogger(os.Stderr).WithValues("node", nodeName))
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	verbosity = map[string]int{}
+	for name, level := range args.Verbosity {
+		verbosity[name] = level
+	}
+	return nil
+}
+
+func setJSONLogger(log logr.Logger) {
+	klog.SetLogger(log)
+	lock.Lock()
+	defer lock.Unlock()
+	jsonLog = log
+}
+
+// ParseVerbosity parses the per component verbosity, like sysinfo=4,podrescompat=2
+func ParseVerbosity(value string) (map[string]int, error) {
+	levels := map[string]int{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		items := strings.SplitN(item, "=", 2)
+		if len(items) != 2 {
+			return nil, fmt.Errorf("malformed component verbosity %q, expected component=level", item)
+		}
+		level, err := strconv.Atoi(items[1])
+		if err != nil || level < 0 {
+			return nil, fmt.Errorf("invalid verbosity %q of component %q", items[1], items[0])
+		}
+		levels[items[0]] = level
+	}
+	return levels, nil
+}
+
+// KnownComponents lists the registered components, once the packages are initialized
+func KnownComponents() []string {
+	lock.RLock()
+	defer lock.RUnlock()
+	return knownComponents()
+}
+
+func knownComponents() []string {
+	names := []string{}
+	for name := range components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Logger logs on behalf of a component, adding its name to the key/value pairs
+type Logger struct {
+	component string
+}
+
+// Component registers the component, to be called at package initialization
+func Component(name string) Logger {
+	lock.Lock()
+	defer lock.Unlock()
+	components[name] = true
+	return Logger{component: name}
+}
+
+// V is enabled by the component verbosity if set, by -v otherwise
+func (l Logger) V(level int) Verbose {
+	lock.RLock()
+	compLevel, ok := verbosity[l.component]
+	lock.RUnlock()
+	if ok {
+		return Verbose{component: l.component, level: level, enabled: level <= compLevel}
+	}
+	return Verbose{component: l.component, level: level, enabled: klog.V(klog.Level(level)).Enabled()}
+}
+
+func (l Logger) InfoS(msg string, keysAndValues ...interface{}) {
+	klog.InfoSDepth(1, msg, withComponent(l.component, keysAndValues)...)
+}
+
+func (l Logger) ErrorS(err error, msg string, keysAndValues ...interface{}) {
+	klog.ErrorSDepth(1, err, msg, withComponent(l.component, keysAndValues)...)
+}
+
+// Verbose mirrors klog.Verbose for the component loggers
+type Verbose struct {
+	component string
+	level     int
+	enabled   bool
+}
+
+func (v Verbose) Enabled() bool {
+	return v.enabled
+}
+
+func (v Verbose) InfoS(msg string, keysAndValues ...interface{}) {
+	if !v.enabled {
+		return
+	}
+	lock.RLock()
+	log := jsonLog
+	lock.RUnlock()
+	if log != nil {
+		logr.WithCallDepth(log.V(v.level), 1).Info(msg, withComponent(v.component, keysAndValues)...)
+		return
+	}
+	klog.InfoSDepth(1, msg, withComponent(v.component, keysAndValues)...)
+}
+
+func withComponent(component string, keysAndValues []interface{}) []interface{} {
+	return append([]interface{}{"component", component}, keysAndValues...)
+}
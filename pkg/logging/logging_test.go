@@ -0,0 +1,115 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+var testLogger = Component("test")
+
+func TestParseVerbosity(t *testing.T) {
+	testCases := []struct {
+		value     string
+		expected  map[string]int
+		expectErr bool
+	}{
+		{value: "", expected: map[string]int{}},
+		{value: "sysinfo=4, podrescompat=2", expected: map[string]int{"sysinfo": 4, "podrescompat": 2}},
+		{value: "sysinfo", expectErr: true},
+		{value: "sysinfo=high", expectErr: true},
+		{value: "sysinfo=-1", expectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			got, err := ParseVerbosity(tc.value)
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tc.expectErr && !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("got %v, want %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestSetup(t *testing.T) {
+	defer Setup(Args{}, "")
+
+	if err := Setup(Args{Format: "xml"}, "node"); err == nil {
+		t.Errorf("expected error on unsupported format")
+	}
+	if err := Setup(Args{Verbosity: map[string]int{"nonexistent": 2}}, "node"); err == nil {
+		t.Errorf("expected error on unknown component")
+	}
+
+	if err := Setup(Args{Verbosity: map[string]int{"test": 3}}, "node"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !testLogger.V(3).Enabled() || testLogger.V(4).Enabled() {
+		t.Errorf("the component verbosity is not applied")
+	}
+}
+
+func TestJSONLogger(t *testing.T) {
+	var buf bytes.Buffer
+	jl := NewJSONLogger(&buf).(jsonLogger)
+	jl.out.now = func() time.Time { return time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+	setJSONLogger(jl.WithValues("node", "node-0"))
+	defer setJSONLogger(nil)
+	defer Setup(Args{}, "")
+	if err := Setup(Args{Verbosity: map[string]int{"test": 4}}, "node-0"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	testLogger.V(4).InfoS("mapped device", "pciAddress", "0000:3b:00.0", "numa", 1)
+	testLogger.ErrorS(fmt.Errorf("fake error"), "cannot map")
+	klog.Infof("plain %s", "line")
+	klog.Flush()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("unexpected output:\n%s", buf.String())
+	}
+
+	expected := []map[string]interface{}{
+		{"ts": "2022-01-01T00:00:00Z", "level": "info", "v": 4.0, "msg": "mapped device", "node": "node-0", "component": "test", "pciAddress": "0000:3b:00.0", "numa": 1.0},
+		{"ts": "2022-01-01T00:00:00Z", "level": "error", "msg": "cannot map", "err": "fake error", "node": "node-0", "component": "test"},
+		{"ts": "2022-01-01T00:00:00Z", "level": "info", "v": 0.0, "msg": "plain line", "node": "node-0"},
+	}
+	for idx, line := range lines {
+		got := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("line %d is not JSON: %v\n%s", idx, err, line)
+		}
+		caller, _ := got["caller"].(string)
+		if !strings.HasPrefix(caller, "logging_test.go:") {
+			t.Errorf("line %d: unexpected caller %q", idx, caller)
+		}
+		delete(got, "caller")
+		if !reflect.DeepEqual(got, expected[idx]) {
+			t.Errorf("line %d: got %v, want %v", idx, got, expected[idx])
+		}
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// the metrics, ours and the upstream ones, are registered in the default registry and exposed by Serve
+
+var nodeName string
+
+var (
+	StalePodResourcesAllocations = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rte_stale_podresources_allocations",
+		Help: "The number of pods holding exclusive resources in podresources but not running anymore",
+	}, []string{"node"})
+
+	StalePodResourcesCPUs = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rte_stale_podresources_cpus",
+		Help: "The number of exclusive cpus held by pods not running anymore",
+	}, []string{"node"})
+
+	CPUSetAuditFindings = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rte_cpuset_audit_findings",
+		Help: "The number of inconsistencies between the exclusive cpus reported by podresources and the container cpusets",
+	}, []string{"node", "kind"})
+
+	NRTUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rte_nrt_updates_total",
+		Help: "The number of NodeResourceTopology updates, by outcome: written, heartbeat, skipped or failed",
+	}, []string{"node", "outcome"})
+)
+
+func Setup(node string) {
+	nodeName = node
+}
+
+func UpdateStalePodResourcesMetrics(allocations, cpus int) {
+	StalePodResourcesAllocations.With(prometheus.Labels{
+		"node": nodeName,
+	}).Set(float64(allocations))
+	StalePodResourcesCPUs.With(prometheus.Labels{
+		"node": nodeName,
+	}).Set(float64(cpus))
+}
+
+func UpdateCPUSetAuditMetric(kind string, findings int) {
+	CPUSetAuditFindings.With(prometheus.Labels{
+		"node": nodeName,
+		"kind": kind,
+	}).Set(float64(findings))
+}
+
+func UpdateNRTUpdatesMetric(outcome string) {
+	NRTUpdates.With(prometheus.Labels{
+		"node":    nodeName,
+		"outcome": outcome,
+	}).Inc()
+}
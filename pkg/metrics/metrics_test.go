@@ -0,0 +1,52 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestWithNodeLabel(t *testing.T) {
+	Setup("node-a")
+	defer Setup("")
+
+	reg := prometheus.NewRegistry()
+	vec := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "test_calls_total",
+		Help: "test",
+	}, []string{"node"})
+	reg.MustRegister(vec)
+	vec.With(prometheus.Labels{"node": ""}).Inc()
+	vec.With(prometheus.Labels{"node": "node-b"}).Inc()
+
+	mfs, err := withNodeLabel(reg).Gather()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mfs) != 1 {
+		t.Fatalf("expected 1 metric family, got %d", len(mfs))
+	}
+	var got []string
+	for _, metric := range mfs[0].GetMetric() {
+		for _, label := range metric.GetLabel() {
+			got = append(got, label.GetValue())
+		}
+	}
+	if len(got) != 2 || got[0] != "node-a" || got[1] != "node-b" {
+		t.Errorf("unexpected node labels: %v", got)
+	}
+}
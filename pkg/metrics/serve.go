@@ -0,0 +1,79 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/klog/v2"
+)
+
+const metricsPath = "/metrics"
+
+// Handler serves the default registry like promhttp.Handler does. The upstream metrics learn the
+// node name only when the upstream package serves them itself, so their node label is filled in here.
+func Handler() http.Handler {
+	return promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(withNodeLabel(prometheus.DefaultGatherer), promhttp.HandlerOpts{}),
+	)
+}
+
+func withNodeLabel(gatherer prometheus.Gatherer) prometheus.GathererFunc {
+	return func() ([]*dto.MetricFamily, error) {
+		mfs, err := gatherer.Gather()
+		for _, mf := range mfs {
+			for _, metric := range mf.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if label.GetName() == "node" && label.GetValue() == "" {
+						value := nodeName
+						label.Value = &value
+					}
+				}
+			}
+		}
+		return mfs, err
+	}
+}
+
+// Serve exposes the metrics on addr until the context is done. Any other path is served by
+// http.DefaultServeMux, where the http sink registers.
+func Serve(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, Handler())
+	mux.Handle("/", http.DefaultServeMux)
+	hsrv := &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := hsrv.Shutdown(shutdownCtx); err != nil {
+			klog.Warningf("cannot shut down the metrics server: %v", err)
+		}
+	}()
+	klog.Infof("serving the metrics on %q", addr)
+	if err := hsrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
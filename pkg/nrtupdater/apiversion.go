@@ -0,0 +1,98 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nrtupdater
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/k8shelpers"
+)
+
+const (
+	APIVersionAuto     = "auto"
+	APIVersionV1alpha1 = "v1alpha1"
+	APIVersionV1alpha2 = "v1alpha2"
+)
+
+const (
+	TopologyGroup = "topology.node.k8s.io"
+)
+
+// NodeResourceTopologyResource returns the resource to use with the dynamic client. Only v1alpha1 types
+// are vendored, so all the versions are handled as unstructured.
+func NodeResourceTopologyResource(apiVersion string) schema.GroupVersionResource {
+	return schema.GroupVersionResource{
+		Group:    TopologyGroup,
+		Version:  apiVersion,
+		Resource: "noderesourcetopologies",
+	}
+}
+
+func resolveAPIVersion(args Args) (string, error) {
+	if args.APIVersion != APIVersionAuto {
+		return SelectAPIVersion(args.APIVersion, nil)
+	}
+	if args.NoPublish {
+		return APIVersionV1alpha1, nil
+	}
+	served, err := DiscoverServedVersions()
+	if err != nil {
+		return "", err
+	}
+	return SelectAPIVersion(args.APIVersion, served)
+}
+
+// SelectAPIVersion picks the newest served version on APIVersionAuto, otherwise it checks the requested version.
+func SelectAPIVersion(requested string, served []string) (string, error) {
+	switch requested {
+	case APIVersionV1alpha1, APIVersionV1alpha2:
+		return requested, nil
+	case APIVersionAuto:
+		for _, candidate := range []string{APIVersionV1alpha2, APIVersionV1alpha1} {
+			for _, version := range served {
+				if version == candidate {
+					return candidate, nil
+				}
+			}
+		}
+		return "", fmt.Errorf("no supported version of %s is served (got %v)", TopologyGroup, served)
+	}
+	return "", fmt.Errorf("unsupported NodeResourceTopology API version: %q", requested)
+}
+
+// DiscoverServedVersions lists the served versions of the NodeResourceTopology API group
+func DiscoverServedVersions() ([]string, error) {
+	cli, err := k8shelpers.GetDiscoveryClient("")
+	if err != nil {
+		return nil, err
+	}
+	groups, err := cli.ServerGroups()
+	if err != nil {
+		return nil, err
+	}
+	served := []string{}
+	for _, group := range groups.Groups {
+		if group.Name != TopologyGroup {
+			continue
+		}
+		for _, version := range group.Versions {
+			served = append(served, version.Version)
+		}
+	}
+	logger.V(2).InfoS("served versions", "group", TopologyGroup, "versions", served)
+	return served, nil
+}
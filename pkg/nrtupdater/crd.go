@@ -0,0 +1,162 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nrtupdater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/yaml"
+
+	"github.com/openshift-kni/resource-topology-exporter/manifests"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/k8shelpers"
+)
+
+// CustomResourceDefinitionResource is handled through the dynamic client, the apiextensions types are not vendored
+var CustomResourceDefinitionResource = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+// ErrCRDNotServed is observed while the NodeResourceTopology API group is not served
+var ErrCRDNotServed = errors.New("the NodeResourceTopology CRD is not served")
+
+// crdClient is the subset of dynamic.ResourceInterface the CRD installation needs
+type crdClient interface {
+	Create(ctx context.Context, obj *unstructured.Unstructured, options metav1.CreateOptions, subresources ...string) (*unstructured.Unstructured, error)
+}
+
+type crdEnsurer struct {
+	discover   func() ([]string, error)
+	cli        crdClient
+	apiVersion string
+	backoff    wait.Backoff
+	observe    func(err error)
+}
+
+// EnsureCRD waits until the NodeResourceTopology CRD serves the version to publish, according to the CRD policy.
+// On CRDPolicyInstall it first creates the embedded CRD; if not permitted it just waits.
+// observe is called with the reason of each retry. A served CRD without the version to publish is not retried.
+func EnsureCRD(ctx context.Context, args Args, observe func(err error)) error {
+	if args.NoPublish || args.CRDPolicy == CRDPolicyIgnore || args.CRDPolicy == "" {
+		return nil
+	}
+	ens := crdEnsurer{
+		discover:   DiscoverServedVersions,
+		apiVersion: args.APIVersion,
+		backoff: wait.Backoff{
+			Duration: time.Second,
+			Factor:   2.0,
+			Jitter:   0.1,
+			Steps:    math.MaxInt32,
+			Cap:      time.Minute,
+		},
+		observe: observe,
+	}
+	if args.CRDPolicy == CRDPolicyInstall {
+		dynCli, err := k8shelpers.GetDynamicClient("")
+		if err != nil {
+			return err
+		}
+		ens.cli = dynCli.Resource(CustomResourceDefinitionResource)
+	}
+	if args.CRDTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, args.CRDTimeout)
+		defer cancel()
+	}
+	return ens.ensure(ctx)
+}
+
+func (ens crdEnsurer) ensure(ctx context.Context) error {
+	backoff := ens.backoff
+	for {
+		served, err := ens.discover()
+		if err == nil {
+			if len(served) > 0 {
+				return checkServedVersion(ens.apiVersion, served)
+			}
+			err = ErrCRDNotServed
+		}
+
+		if errors.Is(err, ErrCRDNotServed) && ens.cli != nil {
+			if installErr := ens.install(ctx); installErr != nil {
+				logger.ErrorS(installErr, "cannot install the NodeResourceTopology CRD, waiting for it")
+			}
+			// one attempt: once created, or if not permitted, waiting is all we can do
+			ens.cli = nil
+		}
+
+		if ens.observe != nil {
+			ens.observe(err)
+		}
+		delay := backoff.Step()
+		logger.ErrorS(err, "NodeResourceTopology CRD not available, retrying", "delay", delay)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%v: %w", err, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (ens crdEnsurer) install(ctx context.Context) error {
+	crd, err := EmbeddedCRD()
+	if err != nil {
+		return err
+	}
+	_, err = ens.cli.Create(ctx, crd, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		logger.InfoS("the NodeResourceTopology CRD already exists", "crd", crd.GetName())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	logger.InfoS("installed the NodeResourceTopology CRD", "crd", crd.GetName())
+	return nil
+}
+
+// EmbeddedCRD is the NodeResourceTopology CRD the exporter is built with
+func EmbeddedCRD() (*unstructured.Unstructured, error) {
+	obj := map[string]interface{}{}
+	if err := yaml.Unmarshal(manifests.CRD, &obj); err != nil {
+		return nil, fmt.Errorf("cannot decode the embedded CRD: %w", err)
+	}
+	return &unstructured.Unstructured{Object: obj}, nil
+}
+
+// checkServedVersion fails if the version to publish is not among the served ones
+func checkServedVersion(apiVersion string, served []string) error {
+	if apiVersion == APIVersionAuto {
+		_, err := SelectAPIVersion(apiVersion, served)
+		return err
+	}
+	for _, version := range served {
+		if version == apiVersion {
+			return nil
+		}
+	}
+	return fmt.Errorf("the NodeResourceTopology CRD does not serve %s (served: %v)", apiVersion, served)
+}
@@ -0,0 +1,121 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nrtupdater
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/k8shelpers"
+)
+
+// gcClient is the subset of dynamic.ResourceInterface the garbage collection needs
+type gcClient interface {
+	Delete(ctx context.Context, name string, options metav1.DeleteOptions, subresources ...string) error
+}
+
+type GCArgs struct {
+	APIVersion string
+	DryRun     bool
+}
+
+// GarbageCollect removes the NodeResourceTopology objects whose node no longer exists.
+// Objects created with the node as owner are removed by the cluster garbage collector,
+// this is for the ones published without it, e.g. while the node could not be read.
+// Only the objects this exporter published are considered: the ones with the node as
+// owner or with the heartbeat annotation. Other producers may have their own rules.
+func GarbageCollect(ctx context.Context, args GCArgs) ([]string, error) {
+	apiVersion, err := resolveAPIVersion(Args{APIVersion: args.APIVersion})
+	if err != nil {
+		return nil, err
+	}
+	dynCli, err := k8shelpers.GetDynamicClient("")
+	if err != nil {
+		return nil, err
+	}
+	cs, err := k8shelpers.GetK8sClient("")
+	if err != nil {
+		return nil, err
+	}
+	cli := dynCli.Resource(NodeResourceTopologyResource(apiVersion))
+	// the objects first: each one is published by an exporter running on its node,
+	// so its node already exists when the nodes are listed, even if it just joined
+	nrts, err := cli.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	nodeNames, err := listNodeNames(ctx, cs)
+	if err != nil {
+		return nil, err
+	}
+	return collectOrphans(ctx, cli, nrts.Items, nodeNames, args.DryRun)
+}
+
+func listNodeNames(ctx context.Context, cs kubernetes.Interface) (sets.String, error) {
+	nodes, err := cs.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	nodeNames := sets.NewString()
+	for _, node := range nodes.Items {
+		nodeNames.Insert(node.Name)
+	}
+	return nodeNames, nil
+}
+
+// publishedByExporter tells if the object carries the marks this exporter sets
+func publishedByExporter(nrt *unstructured.Unstructured) bool {
+	if _, ok := nrt.GetAnnotations()[AnnotationRTEHeartbeat]; ok {
+		return true
+	}
+	for _, owner := range nrt.GetOwnerReferences() {
+		if owner.APIVersion == "v1" && owner.Kind == "Node" {
+			return true
+		}
+	}
+	return false
+}
+
+func collectOrphans(ctx context.Context, cli gcClient, nrts []unstructured.Unstructured, nodeNames sets.String, dryRun bool) ([]string, error) {
+	removed := []string{}
+	for idx := range nrts {
+		name := nrts[idx].GetName()
+		if nodeNames.Has(name) {
+			continue
+		}
+		if !publishedByExporter(&nrts[idx]) {
+			logger.V(2).InfoS("gc: skipping NodeResourceTopology not published by the exporter", "nrt", name)
+			continue
+		}
+		if dryRun {
+			logger.InfoS("gc: would delete NodeResourceTopology", "nrt", name)
+			removed = append(removed, name)
+			continue
+		}
+		err := cli.Delete(ctx, name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return removed, fmt.Errorf("gc failed to delete NodeResourceTopology %q: %w", name, err)
+		}
+		logger.InfoS("gc: deleted NodeResourceTopology", "nrt", name)
+		removed = append(removed, name)
+	}
+	return removed, nil
+}
@@ -0,0 +1,352 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nrtupdater
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/k8stopologyawareschedwg/noderesourcetopology-api/pkg/apis/topology/v1alpha1"
+	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/utils"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/k8shelpers"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/logging"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/metrics"
+)
+
+var logger = logging.Component("nrtupdater")
+
+const (
+	AnnotationRTEUpdate = "k8stopoawareschedwg/rte-update"
+	// AnnotationRTEHeartbeat is the time of the last write, refreshed even if the content did not change
+	AnnotationRTEHeartbeat = "k8stopoawareschedwg/rte-heartbeat"
+	// AnnotationRTEStale is the time the exporter stopped maintaining the object
+	AnnotationRTEStale = "k8stopoawareschedwg/rte-stale"
+	// AnnotationRTEPodFingerprint is the fingerprint of the pods holding exclusive resources, see the podfingerprint package
+	AnnotationRTEPodFingerprint = "k8stopoawareschedwg/rte-pod-fingerprint"
+)
+
+const (
+	ShutdownKeep      = "keep"
+	ShutdownMarkStale = "mark-stale"
+	ShutdownDelete    = "delete"
+)
+
+const (
+	CRDPolicyIgnore  = "ignore"
+	CRDPolicyWait    = "wait"
+	CRDPolicyInstall = "install"
+)
+
+const (
+	RTEUpdatePeriodic = "periodic"
+	RTEUpdateReactive = "reactive"
+	RTEUpdateRepair   = "repair"
+)
+
+// FieldManager identifies the exporter writes in the object managed fields
+const FieldManager = "resource-topology-exporter"
+
+const (
+	UpdateWritten   = "written"
+	UpdateHeartbeat = "heartbeat"
+	UpdateSkipped   = "skipped"
+	UpdateRepaired  = "repaired"
+	UpdateFailed    = "failed"
+)
+
+// Command line arguments
+type Args struct {
+	NoPublish bool
+	Oneshot   bool
+	Hostname  string
+	// APIVersion is the NodeResourceTopology version to publish, or APIVersionAuto to discover it
+	APIVersion string
+	// HeartbeatInterval is the maximum time between writes when the content does not change. 0 disables the skipping.
+	HeartbeatInterval time.Duration
+	// ShutdownAction is what happens to the object when the exporter terminates
+	ShutdownAction string
+	// RepairInterval is the minimum time between repairs of the object changed by someone else. 0 disables the repairs.
+	RepairInterval time.Duration
+	// CRDPolicy is what happens at startup if the NodeResourceTopology CRD is not served
+	CRDPolicy string
+	// CRDTimeout bounds the wait for the CRD. 0 waits forever.
+	CRDTimeout time.Duration
+}
+
+// TopologyInfo describes the kubelet resource managers, published as attributes since v1alpha2
+type TopologyInfo struct {
+	TopologyManagerPolicy        string
+	TopologyManagerScope         string
+	TopologyManagerPolicyOptions map[string]string
+	CPUManagerPolicy             string
+	CPUManagerPolicyOptions      map[string]string
+	// ZoneAttributes are the v1alpha2 attributes of each zone, by zone name
+	ZoneAttributes map[string]v1alpha1.AttributeList
+}
+
+// nrtClient is the subset of dynamic.ResourceInterface the updater needs
+type nrtClient interface {
+	Create(ctx context.Context, obj *unstructured.Unstructured, options metav1.CreateOptions, subresources ...string) (*unstructured.Unstructured, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, options metav1.PatchOptions, subresources ...string) (*unstructured.Unstructured, error)
+	Delete(ctx context.Context, name string, options metav1.DeleteOptions, subresources ...string) error
+}
+
+type NRTUpdater struct {
+	// ctx bounds the API calls of the updates and of the repairs
+	ctx        context.Context
+	args       Args
+	tmPolicy   string
+	topoInfo   TopologyInfo
+	apiVersion string
+	cli        nrtClient
+	watchCli   watchClient
+	owner      *metav1.OwnerReference
+
+	// serializes the updates and the shutdown
+	lock    sync.Mutex
+	stopped bool
+	// the last successful write
+	lastObject  *unstructured.Unstructured
+	lastContent []byte
+	lastWrite   time.Time
+}
+
+type MonitorInfo struct {
+	Timer bool
+	Zones v1alpha1.ZoneList
+	// PodFingerprint matches the pods of the scan the zones are computed from
+	PodFingerprint string
+}
+
+func (mi MonitorInfo) UpdateReason() string {
+	if mi.Timer {
+		return RTEUpdatePeriodic
+	}
+	return RTEUpdateReactive
+}
+
+// NewNRTUpdater resolves the API version to publish. The discovery needs to reach the apiserver.
+// The context bounds the API calls, except the ones of the shutdown.
+func NewNRTUpdater(ctx context.Context, args Args, policy string, topoInfo TopologyInfo) (*NRTUpdater, error) {
+	apiVersion, err := resolveAPIVersion(args)
+	if err != nil {
+		return nil, err
+	}
+	logger.InfoS("publishing NodeResourceTopology", "apiVersion", apiVersion)
+	te := &NRTUpdater{
+		ctx:        ctx,
+		args:       args,
+		tmPolicy:   policy,
+		topoInfo:   topoInfo,
+		apiVersion: apiVersion,
+	}
+	if !args.NoPublish {
+		dynCli, err := k8shelpers.GetDynamicClient("")
+		if err != nil {
+			return nil, err
+		}
+		res := dynCli.Resource(NodeResourceTopologyResource(apiVersion))
+		te.cli = res
+		te.watchCli = res
+		te.owner = getNodeOwnerReference(ctx, args.Hostname)
+	}
+	return te, nil
+}
+
+// getNodeOwnerReference tolerates errors: without the owner the object is just not garbage collected
+func getNodeOwnerReference(ctx context.Context, nodeName string) *metav1.OwnerReference {
+	cs, err := k8shelpers.GetK8sClient("")
+	if err != nil {
+		logger.ErrorS(err, "cannot set the node as owner")
+		return nil
+	}
+	node, err := cs.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		logger.ErrorS(err, "cannot set the node as owner")
+		return nil
+	}
+	owner := NodeOwnerReference(node)
+	return &owner
+}
+
+// GetObject reads the NodeResourceTopology object of the node, in the version the exporter would publish
+func GetObject(ctx context.Context, args Args) (*unstructured.Unstructured, error) {
+	apiVersion, err := resolveAPIVersion(args)
+	if err != nil {
+		return nil, err
+	}
+	dynCli, err := k8shelpers.GetDynamicClient("")
+	if err != nil {
+		return nil, err
+	}
+	return dynCli.Resource(NodeResourceTopologyResource(apiVersion)).Get(ctx, args.Hostname, metav1.GetOptions{})
+}
+
+func (te *NRTUpdater) APIVersion() string {
+	return te.apiVersion
+}
+
+func (te *NRTUpdater) NodeName() string {
+	return te.args.Hostname
+}
+
+func (te *NRTUpdater) TopologyPolicy() string {
+	return te.tmPolicy
+}
+
+// Render returns the object as Update would publish it. It does not need the apiserver,
+// so it can feed the other sinks also with NoPublish.
+func (te *NRTUpdater) Render(info MonitorInfo) (*unstructured.Unstructured, error) {
+	return te.render(info, time.Now())
+}
+
+func (te *NRTUpdater) render(info MonitorInfo, now time.Time) (*unstructured.Unstructured, error) {
+	annotations := map[string]string{
+		AnnotationRTEUpdate:    info.UpdateReason(),
+		AnnotationRTEHeartbeat: now.UTC().Format(time.RFC3339),
+	}
+	if info.PodFingerprint != "" {
+		annotations[AnnotationRTEPodFingerprint] = info.PodFingerprint
+	}
+	nrt, err := NewObject(te.apiVersion, te.args.Hostname, annotations, te.tmPolicy, te.topoInfo, info.Zones)
+	if err != nil {
+		return nil, err
+	}
+	if te.owner != nil {
+		nrt.SetOwnerReferences([]metav1.OwnerReference{*te.owner})
+	}
+	return nrt, nil
+}
+
+func (te *NRTUpdater) Update(info MonitorInfo) error {
+	logger.V(3).InfoS("update: sending zones", "zones", utils.Dump(info.Zones))
+
+	if te.args.NoPublish {
+		return nil
+	}
+
+	te.lock.Lock()
+	defer te.lock.Unlock()
+	if te.stopped {
+		logger.V(2).InfoS("update: shutting down, skipped")
+		return nil
+	}
+
+	now := time.Now()
+	nrt, err := te.render(info, now)
+	if err != nil {
+		return err
+	}
+	content, err := ContentOf(nrt)
+	if err != nil {
+		return err
+	}
+
+	outcome := UpdateWritten
+	if te.lastContent != nil && bytes.Equal(content, te.lastContent) && info.PodFingerprint == te.lastFingerprint() {
+		if now.Sub(te.lastWrite) < te.args.HeartbeatInterval {
+			logger.V(4).InfoS("update: content unchanged, skipped")
+			metrics.UpdateNRTUpdatesMetric(UpdateSkipped)
+			return nil
+		}
+		outcome = UpdateHeartbeat
+	}
+
+	if err := te.publish(nrt); err != nil {
+		metrics.UpdateNRTUpdatesMetric(UpdateFailed)
+		return err
+	}
+	metrics.UpdateNRTUpdatesMetric(outcome)
+	te.lastObject = nrt
+	te.lastContent = content
+	te.lastWrite = now
+	return nil
+}
+
+// publish patches the object, creating it if missing. A concurrent create or update is retried.
+func (te *NRTUpdater) publish(nrt *unstructured.Unstructured) error {
+	patch, err := MergePatchFor(nrt)
+	if err != nil {
+		return err
+	}
+	return retry.OnError(retry.DefaultRetry, isRetriable, func() error {
+		nrtPatched, err := te.cli.Patch(te.ctx, nrt.GetName(), types.MergePatchType, patch, metav1.PatchOptions{FieldManager: FieldManager})
+		if err == nil {
+			logger.V(5).InfoS("update patched CRD instance", "nrt", utils.Dump(nrtPatched))
+			return nil
+		}
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("update failed to patch %s.NodeResourceTopology: %w", te.apiVersion, err)
+		}
+		nrtCreated, err := te.cli.Create(te.ctx, nrt, metav1.CreateOptions{FieldManager: FieldManager})
+		if err != nil {
+			return fmt.Errorf("update failed to create %s.NodeResourceTopology: %w", te.apiVersion, err)
+		}
+		logger.V(2).InfoS("update created CRD instance", "nrt", utils.Dump(nrtCreated))
+		return nil
+	})
+}
+
+// Shutdown applies the shutdown action within the given context. Any later update is ignored.
+func (te *NRTUpdater) Shutdown(ctx context.Context) error {
+	te.lock.Lock()
+	defer te.lock.Unlock()
+	te.stopped = true
+	if te.args.NoPublish {
+		return nil
+	}
+
+	switch te.args.ShutdownAction {
+	case ShutdownMarkStale:
+		patch, err := StalePatch(time.Now())
+		if err != nil {
+			return err
+		}
+		_, err = te.cli.Patch(ctx, te.args.Hostname, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: FieldManager})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("shutdown failed to mark %s.NodeResourceTopology stale: %w", te.apiVersion, err)
+		}
+		logger.InfoS("shutdown: marked NodeResourceTopology stale", "nrt", te.args.Hostname)
+	case ShutdownDelete:
+		err := te.cli.Delete(ctx, te.args.Hostname, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("shutdown failed to delete %s.NodeResourceTopology: %w", te.apiVersion, err)
+		}
+		logger.InfoS("shutdown: deleted NodeResourceTopology", "nrt", te.args.Hostname)
+	}
+	return nil
+}
+
+// lastFingerprint is the fingerprint of the last write. Needs the lock.
+func (te *NRTUpdater) lastFingerprint() string {
+	if te.lastObject == nil {
+		return ""
+	}
+	return te.lastObject.GetAnnotations()[AnnotationRTEPodFingerprint]
+}
+
+func isRetriable(err error) bool {
+	return errors.IsConflict(err) || errors.IsAlreadyExists(err)
+}
@@ -0,0 +1,480 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nrtupdater
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/k8stopologyawareschedwg/noderesourcetopology-api/pkg/apis/topology/v1alpha1"
+)
+
+func TestSelectAPIVersion(t *testing.T) {
+	testCases := []struct {
+		name      string
+		requested string
+		served    []string
+		expected  string
+		expectErr bool
+	}{
+		{name: "explicit", requested: APIVersionV1alpha1, served: []string{APIVersionV1alpha2}, expected: APIVersionV1alpha1},
+		{name: "auto newest", requested: APIVersionAuto, served: []string{APIVersionV1alpha1, APIVersionV1alpha2}, expected: APIVersionV1alpha2},
+		{name: "auto old cluster", requested: APIVersionAuto, served: []string{APIVersionV1alpha1}, expected: APIVersionV1alpha1},
+		{name: "auto not served", requested: APIVersionAuto, served: []string{"v1beta1"}, expectErr: true},
+		{name: "unsupported", requested: "v2", expectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := SelectAPIVersion(tc.requested, tc.served)
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.expected {
+				t.Errorf("got %q, want %q", got, tc.expected)
+			}
+		})
+	}
+}
+
+func makeZones(available string) v1alpha1.ZoneList {
+	return v1alpha1.ZoneList{
+		{
+			Name: "node-1",
+			Type: "Node",
+		},
+		{
+			Name: "node-0",
+			Type: "Node",
+			Resources: v1alpha1.ResourceInfoList{
+				{Name: "memory", Capacity: resource.MustParse("8Gi"), Allocatable: resource.MustParse("8Gi"), Available: resource.MustParse("8Gi")},
+				{Name: "cpu", Capacity: resource.MustParse("8"), Allocatable: resource.MustParse("6"), Available: resource.MustParse(available)},
+			},
+		},
+	}
+}
+
+func TestNewObject(t *testing.T) {
+	topoInfo := TopologyInfo{
+		TopologyManagerPolicy:        "single-numa-node",
+		TopologyManagerScope:         "pod",
+		TopologyManagerPolicyOptions: map[string]string{"prefer-closest-numa-nodes": "true"},
+		CPUManagerPolicy:             "static",
+		CPUManagerPolicyOptions:      map[string]string{"full-pcpus-only": "true"},
+		ZoneAttributes: map[string]v1alpha1.AttributeList{
+			"node-0": {{Name: AttributeZoneCPUs, Value: "0-3"}, {Name: AttributeZoneCores, Value: "2"}},
+		},
+	}
+	monitorZones := makeZones("4")
+	obj, err := NewObject(APIVersionV1alpha2, "node", nil, string(v1alpha1.SingleNUMANodePodLevel), topoInfo, monitorZones)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if obj.GetAPIVersion() != "topology.node.k8s.io/v1alpha2" || obj.GetKind() != "NodeResourceTopology" || obj.GetName() != "node" {
+		t.Errorf("unexpected object identity: %v", obj.Object)
+	}
+	attrs, _, _ := unstructured.NestedSlice(obj.Object, "attributes")
+	expectedAttrs := []interface{}{
+		map[string]interface{}{"name": "cpuManagerPolicy", "value": "static"},
+		map[string]interface{}{"name": "cpuManagerPolicyOption.full-pcpus-only", "value": "true"},
+		map[string]interface{}{"name": "topologyManagerPolicy", "value": "single-numa-node"},
+		map[string]interface{}{"name": "topologyManagerPolicyOption.prefer-closest-numa-nodes", "value": "true"},
+		map[string]interface{}{"name": "topologyManagerScope", "value": "pod"},
+	}
+	if !reflect.DeepEqual(attrs, expectedAttrs) {
+		t.Errorf("got attributes %v, want %v", attrs, expectedAttrs)
+	}
+
+	// zones and resources are sorted
+	zones, _, _ := unstructured.NestedSlice(obj.Object, "zones")
+	zone := zones[0].(map[string]interface{})
+	if zone["name"] != "node-0" {
+		t.Errorf("zones not sorted: %v", zones)
+	}
+	resources := zone["resources"].([]interface{})
+	if got := resources[0].(map[string]interface{}); got["name"] != "cpu" || got["available"] != "4" {
+		t.Errorf("unexpected resources: %v", resources)
+	}
+	zoneAttrs, _, _ := unstructured.NestedSlice(zone, "attributes")
+	expectedZoneAttrs := []interface{}{
+		map[string]interface{}{"name": "cores", "value": "2"},
+		map[string]interface{}{"name": "cpus", "value": "0-3"},
+	}
+	if !reflect.DeepEqual(zoneAttrs, expectedZoneAttrs) {
+		t.Errorf("got zone attributes %v, want %v", zoneAttrs, expectedZoneAttrs)
+	}
+	if _, ok := zones[1].(map[string]interface{})["attributes"]; ok {
+		t.Errorf("unexpected attributes for a zone without any: %v", zones[1])
+	}
+	if len(monitorZones[1].Attributes) != 0 {
+		t.Errorf("the zones of the resource monitor were modified: %v", monitorZones[1])
+	}
+
+	obj, err = NewObject(APIVersionV1alpha1, "node", nil, string(v1alpha1.SingleNUMANodePodLevel), topoInfo, makeZones("4"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := obj.Object["attributes"]; ok || obj.GetAPIVersion() != "topology.node.k8s.io/v1alpha1" {
+		t.Errorf("unexpected v1alpha1 object: %v", obj.Object)
+	}
+	zones, _, _ = unstructured.NestedSlice(obj.Object, "zones")
+	if _, ok := zones[0].(map[string]interface{})["attributes"]; ok {
+		t.Errorf("unexpected zone attributes in a v1alpha1 object: %v", zones[0])
+	}
+}
+
+type fakeNRTClient struct {
+	objects   map[string]*unstructured.Unstructured
+	patches   int
+	creates   int
+	conflicts int
+}
+
+func (fc *fakeNRTClient) Create(ctx context.Context, obj *unstructured.Unstructured, options metav1.CreateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	fc.creates++
+	if _, ok := fc.objects[obj.GetName()]; ok {
+		return nil, errors.NewAlreadyExists(schema.GroupResource{}, obj.GetName())
+	}
+	fc.objects[obj.GetName()] = obj.DeepCopy()
+	return obj, nil
+}
+
+func (fc *fakeNRTClient) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, options metav1.PatchOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	fc.patches++
+	if fc.conflicts > 0 {
+		fc.conflicts--
+		return nil, errors.NewConflict(schema.GroupResource{}, name, fmt.Errorf("fake conflict"))
+	}
+	obj, ok := fc.objects[name]
+	if !ok {
+		return nil, errors.NewNotFound(schema.GroupResource{}, name)
+	}
+	if pt != types.MergePatchType {
+		return nil, fmt.Errorf("unexpected patch type %v", pt)
+	}
+	cur, _ := json.Marshal(obj.Object)
+	patched, err := jsonpatch.MergePatch(cur, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patched, &obj.Object); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func TestUpdateSkipsNoop(t *testing.T) {
+	cli := &fakeNRTClient{objects: make(map[string]*unstructured.Unstructured)}
+	te := &NRTUpdater{
+		ctx:        context.Background(),
+		args:       Args{Hostname: "node", HeartbeatInterval: time.Hour},
+		tmPolicy:   string(v1alpha1.SingleNUMANodePodLevel),
+		apiVersion: APIVersionV1alpha2,
+		cli:        cli,
+	}
+
+	// missing object: the patch fails and the object is created
+	if err := te.Update(MonitorInfo{Zones: makeZones("4")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cli.patches != 1 || cli.creates != 1 {
+		t.Errorf("expected patch and create, got %d patches %d creates", cli.patches, cli.creates)
+	}
+
+	// same content, in a different order: skipped
+	zones := makeZones("4")
+	zones[0], zones[1] = zones[1], zones[0]
+	if err := te.Update(MonitorInfo{Timer: true, Zones: zones}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cli.patches != 1 || cli.creates != 1 {
+		t.Errorf("noop update not skipped, got %d patches %d creates", cli.patches, cli.creates)
+	}
+
+	// real change, the conflict is retried
+	cli.conflicts = 1
+	if err := te.Update(MonitorInfo{Zones: makeZones("2")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cli.patches != 3 {
+		t.Errorf("expected 3 patches, got %d", cli.patches)
+	}
+	zone := cli.objects["node"].Object["zones"].([]interface{})[0].(map[string]interface{})
+	if got := zone["resources"].([]interface{})[0].(map[string]interface{})["available"]; got != "2" {
+		t.Errorf("change not published: %v", zone)
+	}
+	if cli.objects["node"].GetAnnotations()[AnnotationRTEUpdate] != RTEUpdateReactive {
+		t.Errorf("annotation not updated: %v", cli.objects["node"].GetAnnotations())
+	}
+
+	// no change, but the heartbeat is due
+	te.lastWrite = te.lastWrite.Add(-2 * time.Hour)
+	if err := te.Update(MonitorInfo{Timer: true, Zones: makeZones("2")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cli.patches != 4 {
+		t.Errorf("heartbeat not written, got %d patches", cli.patches)
+	}
+}
+
+func (fc *fakeNRTClient) Delete(ctx context.Context, name string, options metav1.DeleteOptions, subresources ...string) error {
+	if _, ok := fc.objects[name]; !ok {
+		return errors.NewNotFound(schema.GroupResource{}, name)
+	}
+	delete(fc.objects, name)
+	return nil
+}
+
+func (fc *fakeNRTClient) List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	list := &unstructured.UnstructuredList{}
+	for _, obj := range fc.objects {
+		list.Items = append(list.Items, *obj.DeepCopy())
+	}
+	return list, nil
+}
+
+func TestShutdown(t *testing.T) {
+	for _, action := range []string{ShutdownKeep, ShutdownMarkStale, ShutdownDelete} {
+		t.Run(action, func(t *testing.T) {
+			cli := &fakeNRTClient{objects: make(map[string]*unstructured.Unstructured)}
+			te := &NRTUpdater{
+				ctx:        context.Background(),
+				args:       Args{Hostname: "node", ShutdownAction: action},
+				apiVersion: APIVersionV1alpha2,
+				cli:        cli,
+				owner:      &metav1.OwnerReference{APIVersion: "v1", Kind: "Node", Name: "node", UID: "node-uid"},
+			}
+			if err := te.Update(MonitorInfo{Zones: makeZones("4")}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			owners := cli.objects["node"].GetOwnerReferences()
+			if len(owners) != 1 || owners[0].UID != "node-uid" {
+				t.Errorf("unexpected owners: %v", owners)
+			}
+
+			if err := te.Shutdown(context.Background()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// updates racing with the shutdown are ignored
+			if err := te.Update(MonitorInfo{Zones: makeZones("2")}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			nrt, ok := cli.objects["node"]
+			switch action {
+			case ShutdownKeep:
+				if !ok || nrt.GetAnnotations()[AnnotationRTEStale] != "" {
+					t.Errorf("object modified on shutdown: %v", nrt)
+				}
+			case ShutdownMarkStale:
+				if !ok || nrt.GetAnnotations()[AnnotationRTEStale] == "" {
+					t.Errorf("object not marked stale: %v", nrt)
+				}
+			case ShutdownDelete:
+				if ok {
+					t.Errorf("object not deleted: %v", nrt)
+				}
+			}
+		})
+	}
+}
+
+func TestStaleMarkClearedOnUpdate(t *testing.T) {
+	cli := &fakeNRTClient{objects: make(map[string]*unstructured.Unstructured)}
+	obj, err := NewObject(APIVersionV1alpha2, "node", map[string]string{AnnotationRTEStale: "2021-12-01T00:00:00Z"}, "", TopologyInfo{}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cli.objects["node"] = obj
+
+	te := &NRTUpdater{ctx: context.Background(), args: Args{Hostname: "node"}, apiVersion: APIVersionV1alpha2, cli: cli}
+	if err := te.Update(MonitorInfo{Zones: makeZones("4")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := cli.objects["node"].GetAnnotations()[AnnotationRTEStale]; ok {
+		t.Errorf("stale mark not cleared: %v", cli.objects["node"].GetAnnotations())
+	}
+}
+
+func TestCollectOrphans(t *testing.T) {
+	heartbeat := map[string]string{AnnotationRTEHeartbeat: "2021-12-01T00:00:00Z"}
+	cli := &fakeNRTClient{objects: make(map[string]*unstructured.Unstructured)}
+	for _, name := range []string{"node-a", "node-b", "node-gone"} {
+		obj, err := NewObject(APIVersionV1alpha1, name, heartbeat, "", TopologyInfo{}, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		cli.objects[name] = obj
+	}
+	owned, err := NewObject(APIVersionV1alpha1, "node-gone-owned", nil, "", TopologyInfo{}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	owned.SetOwnerReferences([]metav1.OwnerReference{NodeOwnerReference(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-gone-owned", UID: "uid"}})})
+	cli.objects["node-gone-owned"] = owned
+	// published by someone else
+	foreign, err := NewObject(APIVersionV1alpha1, "node-foreign", nil, "", TopologyInfo{}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cli.objects["node-foreign"] = foreign
+	nodeNames := sets.NewString("node-a", "node-b")
+
+	collect := func(dryRun bool) []string {
+		nrts, err := cli.List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		removed, err := collectOrphans(context.TODO(), cli, nrts.Items, nodeNames, dryRun)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		sort.Strings(removed)
+		return removed
+	}
+
+	expected := []string{"node-gone", "node-gone-owned"}
+	if removed := collect(true); !reflect.DeepEqual(removed, expected) || len(cli.objects) != 5 {
+		t.Errorf("dry run: removed %v, left %d objects", removed, len(cli.objects))
+	}
+	if removed := collect(false); !reflect.DeepEqual(removed, expected) || len(cli.objects) != 3 {
+		t.Errorf("removed %v, left %d objects", removed, len(cli.objects))
+	}
+	if _, ok := cli.objects["node-foreign"]; !ok {
+		t.Errorf("deleted an object not published by the exporter")
+	}
+}
+
+func TestUpdatePodFingerprint(t *testing.T) {
+	cli := &fakeNRTClient{objects: make(map[string]*unstructured.Unstructured)}
+	te := &NRTUpdater{
+		ctx:        context.Background(),
+		args:       Args{Hostname: "node", HeartbeatInterval: time.Hour},
+		apiVersion: APIVersionV1alpha2,
+		cli:        cli,
+	}
+
+	if err := te.Update(MonitorInfo{Zones: makeZones("4"), PodFingerprint: "pfp0v001aaaa"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := te.Update(MonitorInfo{Zones: makeZones("4"), PodFingerprint: "pfp0v001aaaa"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cli.patches != 1 {
+		t.Errorf("noop update not skipped, got %d patches", cli.patches)
+	}
+
+	// a pod replaced by another one with the same resources changes only the fingerprint
+	if err := te.Update(MonitorInfo{Zones: makeZones("4"), PodFingerprint: "pfp0v001bbbb"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cli.patches != 2 {
+		t.Errorf("fingerprint change not published, got %d patches", cli.patches)
+	}
+	if fp := cli.objects["node"].GetAnnotations()[AnnotationRTEPodFingerprint]; fp != "pfp0v001bbbb" {
+		t.Errorf("unexpected fingerprint %q", fp)
+	}
+}
+
+type fakeCRDClient struct {
+	created []string
+	err     error
+}
+
+func (fc *fakeCRDClient) Create(ctx context.Context, obj *unstructured.Unstructured, options metav1.CreateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	if fc.err != nil {
+		return nil, fc.err
+	}
+	fc.created = append(fc.created, obj.GetName())
+	return obj, nil
+}
+
+func TestEnsureCRD(t *testing.T) {
+	crdName := "noderesourcetopologies." + TopologyGroup
+	forbidden := errors.NewForbidden(schema.GroupResource{Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"}, crdName, fmt.Errorf("denied"))
+
+	testCases := []struct {
+		name         string
+		apiVersion   string
+		served       [][]string
+		installErr   error
+		install      bool
+		expectErr    bool
+		expectTries  int
+		expectCreate []string
+	}{
+		{name: "served", apiVersion: APIVersionV1alpha1, served: [][]string{{APIVersionV1alpha1}}, expectTries: 1},
+		{name: "wait", apiVersion: APIVersionV1alpha1, served: [][]string{nil, nil, {APIVersionV1alpha1}}, expectTries: 3},
+		{name: "install", apiVersion: APIVersionAuto, served: [][]string{nil, {APIVersionV1alpha1}}, install: true, expectTries: 2, expectCreate: []string{crdName}},
+		{name: "install forbidden", apiVersion: APIVersionV1alpha1, served: [][]string{nil, nil, {APIVersionV1alpha1}}, install: true, installErr: forbidden, expectTries: 3},
+		{name: "version mismatch", apiVersion: APIVersionV1alpha2, served: [][]string{{APIVersionV1alpha1}}, expectErr: true, expectTries: 1},
+		{name: "timeout", apiVersion: APIVersionV1alpha1, served: [][]string{nil, nil, nil, nil, nil, nil, nil, nil, nil, nil}, expectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tries := 0
+			observed := 0
+			fc := &fakeCRDClient{err: tc.installErr}
+			ens := crdEnsurer{
+				discover: func() ([]string, error) {
+					served := tc.served[tries%len(tc.served)]
+					tries++
+					return served, nil
+				},
+				apiVersion: tc.apiVersion,
+				backoff:    wait.Backoff{Duration: time.Millisecond, Factor: 1.0, Steps: 100},
+				observe: func(err error) {
+					observed++
+				},
+			}
+			if tc.install {
+				ens.cli = fc
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			err := ens.ensure(ctx)
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.expectTries > 0 && tries != tc.expectTries {
+				t.Errorf("discovered %d times, want %d", tries, tc.expectTries)
+			}
+			if !tc.expectErr && observed != tries-1 {
+				t.Errorf("observed %d retries, want %d", observed, tries-1)
+			}
+			if !reflect.DeepEqual(fc.created, tc.expectCreate) {
+				t.Errorf("created %v, want %v", fc.created, tc.expectCreate)
+			}
+		})
+	}
+}
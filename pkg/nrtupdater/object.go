@@ -0,0 +1,196 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nrtupdater
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/k8stopologyawareschedwg/noderesourcetopology-api/pkg/apis/topology/v1alpha1"
+)
+
+// attribute names, see https://github.com/k8stopologyawareschedwg/noderesourcetopology-api
+const (
+	AttributeTopologyManagerPolicy       = "topologyManagerPolicy"
+	AttributeTopologyManagerScope        = "topologyManagerScope"
+	AttributeTopologyManagerPolicyOption = "topologyManagerPolicyOption."
+	AttributeCPUManagerPolicy            = "cpuManagerPolicy"
+	AttributeCPUManagerPolicyOption      = "cpuManagerPolicyOption."
+	// zone attributes
+	AttributeZoneCPUs  = "cpus"
+	AttributeZoneCores = "cores"
+)
+
+// contentFields are owned by the exporter, everything else in the object is left alone
+var contentFields = []string{"topologyPolicies", "attributes", "zones"}
+
+// nodeResourceTopology covers both v1alpha1 and v1alpha2, whose types are not vendored.
+// The zones did not change since v1alpha1.
+type nodeResourceTopology struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// deprecated in v1alpha2, still set for older consumers
+	TopologyPolicies []string `json:"topologyPolicies,omitempty"`
+	// v1alpha2 only
+	Attributes v1alpha1.AttributeList `json:"attributes,omitempty"`
+	Zones      v1alpha1.ZoneList      `json:"zones"`
+}
+
+// Attributes returns the top level v1alpha2 attributes, sorted by name
+func (ti TopologyInfo) Attributes() v1alpha1.AttributeList {
+	attrs := v1alpha1.AttributeList{}
+	if ti.TopologyManagerPolicy != "" {
+		attrs = append(attrs, v1alpha1.AttributeInfo{Name: AttributeTopologyManagerPolicy, Value: ti.TopologyManagerPolicy})
+	}
+	if ti.TopologyManagerScope != "" {
+		attrs = append(attrs, v1alpha1.AttributeInfo{Name: AttributeTopologyManagerScope, Value: ti.TopologyManagerScope})
+	}
+	for name, value := range ti.TopologyManagerPolicyOptions {
+		attrs = append(attrs, v1alpha1.AttributeInfo{Name: AttributeTopologyManagerPolicyOption + name, Value: value})
+	}
+	if ti.CPUManagerPolicy != "" {
+		attrs = append(attrs, v1alpha1.AttributeInfo{Name: AttributeCPUManagerPolicy, Value: ti.CPUManagerPolicy})
+	}
+	for name, value := range ti.CPUManagerPolicyOptions {
+		attrs = append(attrs, v1alpha1.AttributeInfo{Name: AttributeCPUManagerPolicyOption + name, Value: value})
+	}
+	sortAttributes(attrs)
+	return attrs
+}
+
+// NewObject builds the object of the given API version as unstructured, to be published with the dynamic client
+func NewObject(apiVersion, name string, annotations map[string]string, tmPolicy string, topoInfo TopologyInfo, zones v1alpha1.ZoneList) (*unstructured.Unstructured, error) {
+	nrt := nodeResourceTopology{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: NodeResourceTopologyResource(apiVersion).GroupVersion().String(),
+			Kind:       "NodeResourceTopology",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Annotations: annotations,
+		},
+		TopologyPolicies: []string{tmPolicy},
+	}
+	if apiVersion != APIVersionV1alpha1 {
+		nrt.Attributes = topoInfo.Attributes()
+		zones = withZoneAttributes(zones, topoInfo.ZoneAttributes)
+	}
+	nrt.Zones = NormalizeZones(zones)
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&nrt)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: obj}, nil
+}
+
+// withZoneAttributes adds the attributes to a copy of the zones, which the resource monitor may reuse
+func withZoneAttributes(zones v1alpha1.ZoneList, attrs map[string]v1alpha1.AttributeList) v1alpha1.ZoneList {
+	if len(attrs) == 0 {
+		return zones
+	}
+	ret := make(v1alpha1.ZoneList, 0, len(zones))
+	for _, zone := range zones {
+		zone.Attributes = append(append(v1alpha1.AttributeList{}, zone.Attributes...), attrs[zone.Name]...)
+		ret = append(ret, zone)
+	}
+	return ret
+}
+
+// NormalizeZones returns a copy of the zones with all the lists sorted by name, so equal content compares equal
+func NormalizeZones(zones v1alpha1.ZoneList) v1alpha1.ZoneList {
+	ret := make(v1alpha1.ZoneList, 0, len(zones))
+	for _, zone := range zones {
+		zone.Costs = append(v1alpha1.CostList{}, zone.Costs...)
+		sort.Slice(zone.Costs, func(i, j int) bool { return zone.Costs[i].Name < zone.Costs[j].Name })
+		zone.Attributes = append(v1alpha1.AttributeList{}, zone.Attributes...)
+		sortAttributes(zone.Attributes)
+		zone.Resources = append(v1alpha1.ResourceInfoList{}, zone.Resources...)
+		sort.Slice(zone.Resources, func(i, j int) bool { return zone.Resources[i].Name < zone.Resources[j].Name })
+		ret = append(ret, zone)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// ContentOf serializes the fields owned by the exporter. The serialization is stable, because
+// the unstructured maps are serialized with sorted keys and the quantities in canonical form.
+func ContentOf(obj *unstructured.Unstructured) ([]byte, error) {
+	content := make(map[string]interface{})
+	for _, field := range contentFields {
+		if value, ok := obj.Object[field]; ok {
+			content[field] = value
+		}
+	}
+	return json.Marshal(content)
+}
+
+// MergePatchFor returns the JSON merge patch which makes the existing object match obj, without
+// touching anything but the given annotations, the owner and the fields owned by the exporter.
+// A previous stale mark is cleared.
+func MergePatchFor(obj *unstructured.Unstructured) ([]byte, error) {
+	annotations := map[string]interface{}{
+		AnnotationRTEStale: nil,
+	}
+	for key, value := range obj.GetAnnotations() {
+		annotations[key] = value
+	}
+	metadata := map[string]interface{}{
+		"annotations": annotations,
+	}
+	if owners, ok, _ := unstructured.NestedFieldNoCopy(obj.Object, "metadata", "ownerReferences"); ok {
+		metadata["ownerReferences"] = owners
+	}
+	patch := map[string]interface{}{
+		"metadata": metadata,
+	}
+	for _, field := range contentFields {
+		// null removes the field
+		patch[field] = obj.Object[field]
+	}
+	return json.Marshal(patch)
+}
+
+// StalePatch marks the object as no longer maintained
+func StalePatch(now time.Time) ([]byte, error) {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				AnnotationRTEStale: now.UTC().Format(time.RFC3339),
+			},
+		},
+	}
+	return json.Marshal(patch)
+}
+
+// NodeOwnerReference makes the NRT object garbage collected with its node
+func NodeOwnerReference(node *corev1.Node) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       "Node",
+		Name:       node.Name,
+		UID:        node.UID,
+	}
+}
+
+func sortAttributes(attrs v1alpha1.AttributeList) {
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Name < attrs[j].Name })
+}
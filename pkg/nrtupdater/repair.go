@@ -0,0 +1,202 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nrtupdater
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/metrics"
+)
+
+const (
+	// repairKey is the only key in the repair queue, the updater owns a single object
+	repairKey = "nrt"
+
+	// failed repairs are retried with exponential backoff
+	repairMinBackoff = 100 * time.Millisecond
+	repairMaxBackoff = 5 * time.Minute
+)
+
+// watchClient is the subset of dynamic.ResourceInterface the repair informer needs
+type watchClient interface {
+	List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error)
+	Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+}
+
+// RunRepair watches the published object and republishes it as soon as someone else deletes it
+// or changes its content. The repairs are at most one per RepairInterval, so fighting with another
+// writer does not flood the apiserver.
+func (te *NRTUpdater) RunRepair(stopCh <-chan struct{}) {
+	if te.args.NoPublish || te.args.RepairInterval == 0 {
+		return
+	}
+
+	queue := workqueue.NewNamedRateLimitingQueue(newRepairRateLimiter(te.args.RepairInterval), "nrt-repair")
+	fieldSelector := fields.OneTermEqualSelector("metadata.name", te.args.Hostname).String()
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = fieldSelector
+			return te.watchCli.List(te.ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fieldSelector
+			return te.watchCli.Watch(te.ctx, options)
+		},
+	}
+	_, informer := cache.NewInformer(lw, &unstructured.Unstructured{}, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			te.onObserved(queue, obj)
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			te.onObserved(queue, obj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			te.onDeleted(queue)
+		},
+	})
+
+	go informer.Run(stopCh)
+	go te.repairWorker(queue)
+	go func() {
+		<-stopCh
+		queue.ShutDown()
+	}()
+}
+
+func newRepairRateLimiter(interval time.Duration) workqueue.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(repairMinBackoff, repairMaxBackoff),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Every(interval), 1)},
+	)
+}
+
+func (te *NRTUpdater) onObserved(queue workqueue.RateLimitingInterface, obj interface{}) {
+	nrt, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	if !te.diverged(nrt) {
+		return
+	}
+	logger.InfoS("NodeResourceTopology modified by someone else, repairing", "nrt", nrt.GetName(), "managers", describeManagers(nrt))
+	queue.AddRateLimited(repairKey)
+}
+
+func (te *NRTUpdater) onDeleted(queue workqueue.RateLimitingInterface) {
+	te.lock.Lock()
+	expected := !te.stopped && te.lastObject != nil
+	te.lock.Unlock()
+	if !expected {
+		return
+	}
+	logger.InfoS("NodeResourceTopology deleted by someone else, repairing", "nrt", te.args.Hostname)
+	queue.AddRateLimited(repairKey)
+}
+
+// diverged tells if the observed content or fingerprint differ from the last ones written
+func (te *NRTUpdater) diverged(nrt *unstructured.Unstructured) bool {
+	content, err := ContentOf(nrt)
+	if err != nil {
+		logger.ErrorS(err, "cannot serialize the observed NodeResourceTopology")
+		return false
+	}
+	// an update in progress holds the lock until lastContent is current
+	te.lock.Lock()
+	defer te.lock.Unlock()
+	if te.stopped || te.lastContent == nil {
+		return false
+	}
+	return !bytes.Equal(content, te.lastContent) || nrt.GetAnnotations()[AnnotationRTEPodFingerprint] != te.lastFingerprint()
+}
+
+func (te *NRTUpdater) repairWorker(queue workqueue.RateLimitingInterface) {
+	for {
+		key, quit := queue.Get()
+		if quit {
+			return
+		}
+		if err := te.repair(); err != nil {
+			logger.ErrorS(err, "failed to repair")
+			queue.AddRateLimited(key)
+		} else {
+			queue.Forget(key)
+		}
+		queue.Done(key)
+	}
+}
+
+// repair writes again the last published object, with a fresh heartbeat
+func (te *NRTUpdater) repair() error {
+	te.lock.Lock()
+	defer te.lock.Unlock()
+	if te.stopped || te.lastObject == nil {
+		return nil
+	}
+
+	now := time.Now()
+	nrt := te.lastObject.DeepCopy()
+	annotations := nrt.GetAnnotations()
+	annotations[AnnotationRTEUpdate] = RTEUpdateRepair
+	annotations[AnnotationRTEHeartbeat] = now.UTC().Format(time.RFC3339)
+	nrt.SetAnnotations(annotations)
+
+	if err := te.publish(nrt); err != nil {
+		metrics.UpdateNRTUpdatesMetric(UpdateFailed)
+		return err
+	}
+	logger.InfoS("repaired NodeResourceTopology", "nrt", nrt.GetName())
+	metrics.UpdateNRTUpdatesMetric(UpdateRepaired)
+	te.lastWrite = now
+	return nil
+}
+
+// describeManagers lists who wrote the object besides the exporter, most recent first
+func describeManagers(nrt *unstructured.Unstructured) []string {
+	entries := []metav1.ManagedFieldsEntry{}
+	for _, entry := range nrt.GetManagedFields() {
+		if entry.Manager != FieldManager {
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Time == nil || entries[j].Time == nil {
+			return entries[j].Time == nil && entries[i].Time != nil
+		}
+		return entries[j].Time.Before(entries[i].Time)
+	})
+	ret := []string{}
+	for _, entry := range entries {
+		desc := fmt.Sprintf("%s/%s", entry.Manager, entry.Operation)
+		if entry.Time != nil {
+			desc += " at " + entry.Time.UTC().Format(time.RFC3339)
+		}
+		ret = append(ret, desc)
+	}
+	return ret
+}
@@ -0,0 +1,117 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nrtupdater
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRepair(t *testing.T) {
+	cli := &fakeNRTClient{objects: make(map[string]*unstructured.Unstructured)}
+	te := &NRTUpdater{
+		ctx:        context.Background(),
+		args:       Args{Hostname: "node", HeartbeatInterval: time.Hour},
+		apiVersion: APIVersionV1alpha2,
+		cli:        cli,
+	}
+
+	// nothing published yet: nothing to compare with, nothing to repair
+	other, err := NewObject(APIVersionV1alpha2, "node", nil, "", TopologyInfo{}, makeZones("8"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if te.diverged(other) {
+		t.Errorf("diverged before the first write")
+	}
+	if err := te.repair(); err != nil || len(cli.objects) != 0 {
+		t.Errorf("unexpected repair before the first write: %v %v", err, cli.objects)
+	}
+
+	if err := te.Update(MonitorInfo{Zones: makeZones("4")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected, err := ContentOf(cli.objects["node"])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if te.diverged(cli.objects["node"]) {
+		t.Errorf("our own write diverged")
+	}
+
+	// edited by someone else
+	if !te.diverged(other) {
+		t.Errorf("external edit not detected")
+	}
+	cli.objects["node"] = other
+	if err := te.repair(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	repaired, err := ContentOf(cli.objects["node"])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(repaired, expected) {
+		t.Errorf("not repaired:\n%s\nexpected:\n%s", repaired, expected)
+	}
+	if reason := cli.objects["node"].GetAnnotations()[AnnotationRTEUpdate]; reason != RTEUpdateRepair {
+		t.Errorf("unexpected update reason %q", reason)
+	}
+
+	// deleted by someone else
+	delete(cli.objects, "node")
+	if err := te.repair(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := cli.objects["node"]; !ok {
+		t.Errorf("object not re-created")
+	}
+
+	// after the shutdown the object is left alone
+	if err := te.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	delete(cli.objects, "node")
+	if err := te.repair(); err != nil || len(cli.objects) != 0 {
+		t.Errorf("unexpected repair after shutdown: %v %v", err, cli.objects)
+	}
+}
+
+func TestDescribeManagers(t *testing.T) {
+	older := metav1.NewTime(time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC))
+	newer := metav1.NewTime(time.Date(2021, 12, 1, 11, 0, 0, 0, time.UTC))
+	nrt := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	nrt.SetManagedFields([]metav1.ManagedFieldsEntry{
+		{Manager: "kubectl-edit", Operation: metav1.ManagedFieldsOperationUpdate, Time: &older},
+		{Manager: FieldManager, Operation: metav1.ManagedFieldsOperationUpdate, Time: &newer},
+		{Manager: "kubectl-client-side-apply", Operation: metav1.ManagedFieldsOperationUpdate},
+		{Manager: "kubectl-patch", Operation: metav1.ManagedFieldsOperationUpdate, Time: &newer},
+	})
+
+	got := describeManagers(nrt)
+	expected := []string{
+		"kubectl-patch/Update at 2021-12-01T11:00:00Z",
+		"kubectl-edit/Update at 2021-12-01T10:00:00Z",
+		"kubectl-client-side-apply/Update",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v expected %v", got, expected)
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// AnnotationPlacement holds the JSON list of the container placements of the pod
+	AnnotationPlacement = "k8stopoawareschedwg/rte-placement"
+)
+
+type PodPatcher interface {
+	PatchPod(namespace, name string, data []byte) error
+}
+
+type clientsetPatcher struct {
+	cs kubernetes.Interface
+}
+
+func NewClientsetPatcher(cs kubernetes.Interface) PodPatcher {
+	return clientsetPatcher{cs: cs}
+}
+
+func (cp clientsetPatcher) PatchPod(namespace, name string, data []byte) error {
+	_, err := cp.cs.CoreV1().Pods(namespace).Patch(context.TODO(), name, types.MergePatchType, data, metav1.PatchOptions{})
+	return err
+}
+
+// Annotator sets the placement annotation on the pods, off the scan path. Only the changed
+// annotations are written; if the pods change faster than they are annotated, the intermediate
+// states are skipped.
+type Annotator struct {
+	patcher PodPatcher
+	wakeup  chan struct{}
+
+	lock    sync.Mutex
+	pending []PodPlacement
+	// annotation values already written, by pod key
+	written map[string]string
+}
+
+func NewAnnotator(patcher PodPatcher) *Annotator {
+	return &Annotator{
+		patcher: patcher,
+		wakeup:  make(chan struct{}, 1),
+		written: make(map[string]string),
+	}
+}
+
+// Notify hands over the current placements, never blocks
+func (an *Annotator) Notify(pods []PodPlacement) {
+	an.lock.Lock()
+	an.pending = pods
+	an.lock.Unlock()
+	select {
+	case an.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (an *Annotator) Run(stopCh <-chan struct{}) {
+	go func() {
+		for {
+			select {
+			case <-an.wakeup:
+				an.lock.Lock()
+				pods := an.pending
+				an.lock.Unlock()
+				an.annotate(pods)
+			case <-stopCh:
+				logger.InfoS("placement annotator stop")
+				return
+			}
+		}
+	}()
+}
+
+func (an *Annotator) annotate(pods []PodPlacement) {
+	seen := make(map[string]bool)
+	for _, pp := range pods {
+		key := pp.Key()
+		seen[key] = true
+		data, err := json.Marshal(pp.Containers)
+		if err != nil {
+			logger.ErrorS(err, "cannot encode the placement", "pod", key)
+			continue
+		}
+		value := string(data)
+		if an.written[key] == value {
+			continue
+		}
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]string{
+					AnnotationPlacement: value,
+				},
+			},
+		})
+		if err != nil {
+			logger.ErrorS(err, "cannot encode the placement patch", "pod", key)
+			continue
+		}
+		if err := an.patcher.PatchPod(pp.Namespace, pp.Name, patch); err != nil {
+			// retried at the next scan
+			logger.ErrorS(err, "cannot annotate the pod with its placement", "pod", key)
+			continue
+		}
+		logger.V(4).InfoS("annotated the pod placement", "pod", key, "placement", value)
+		an.written[key] = value
+	}
+	for key := range an.written {
+		if !seen[key] {
+			delete(an.written, key)
+		}
+	}
+}
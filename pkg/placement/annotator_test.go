@@ -0,0 +1,77 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+type fakePatcher struct {
+	patches map[string][]string
+	fail    bool
+}
+
+func (fp *fakePatcher) PatchPod(namespace, name string, data []byte) error {
+	if fp.fail {
+		return fmt.Errorf("fake error")
+	}
+	key := namespace + "/" + name
+	fp.patches[key] = append(fp.patches[key], string(data))
+	return nil
+}
+
+func TestAnnotate(t *testing.T) {
+	fp := &fakePatcher{patches: make(map[string][]string)}
+	an := NewAnnotator(fp)
+	pods := FromPodResources(makeResponse(), cpuToNUMA, NewNamespaceFilter([]string{"telco"}))
+
+	an.annotate(pods)
+	if len(fp.patches["telco/dpdk"]) != 1 || len(fp.patches["telco/hugepages"]) != 1 {
+		t.Fatalf("unexpected patches: %v", fp.patches)
+	}
+	patch := struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}{}
+	if err := json.Unmarshal([]byte(fp.patches["telco/dpdk"][0]), &patch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	containers := []ContainerPlacement{}
+	if err := json.Unmarshal([]byte(patch.Metadata.Annotations[AnnotationPlacement]), &containers); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(containers) != 1 || containers[0].CPUs != "2,4" {
+		t.Errorf("unexpected placement: %+v", containers)
+	}
+
+	// unchanged: not patched again
+	an.annotate(pods)
+	if len(fp.patches["telco/dpdk"]) != 1 {
+		t.Errorf("unchanged placement patched again: %v", fp.patches)
+	}
+
+	// failures are retried next time
+	pods[0].Containers[0].CPUs = "2,4,6"
+	fp.fail = true
+	an.annotate(pods)
+	fp.fail = false
+	an.annotate(pods)
+	if len(fp.patches["telco/dpdk"]) != 2 {
+		t.Errorf("changed placement not patched: %v", fp.patches)
+	}
+}
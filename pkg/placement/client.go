@@ -0,0 +1,93 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/logging"
+)
+
+var logger = logging.Component("placement")
+
+type Report struct {
+	Timestamp time.Time      `json:"timestamp"`
+	Pods      []PodPlacement `json:"pods"`
+}
+
+// TrackingClient computes the placement out of every List response, so it matches the published zones
+type TrackingClient struct {
+	cli       podresourcesapi.PodResourcesListerClient
+	cpuToNUMA map[int]int
+	allowed   NamespaceFilter
+	annotator *Annotator
+
+	lock sync.RWMutex
+	last Report
+}
+
+// NewTrackingClient exports the placement of the pods in the allowed namespaces. The annotator may be nil.
+func NewTrackingClient(cli podresourcesapi.PodResourcesListerClient, cpuToNUMA map[int]int, args Args, annotator *Annotator) *TrackingClient {
+	return &TrackingClient{
+		cli:       cli,
+		cpuToNUMA: cpuToNUMA,
+		allowed:   NewNamespaceFilter(args.Namespaces),
+		annotator: annotator,
+	}
+}
+
+func (tc *TrackingClient) List(ctx context.Context, in *podresourcesapi.ListPodResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.ListPodResourcesResponse, error) {
+	resp, err := tc.cli.List(ctx, in, opts...)
+	if err != nil {
+		return resp, err
+	}
+	report := Report{
+		Timestamp: time.Now(),
+		Pods:      FromPodResources(resp, tc.cpuToNUMA, tc.allowed),
+	}
+	tc.lock.Lock()
+	tc.last = report
+	tc.lock.Unlock()
+	if tc.annotator != nil {
+		tc.annotator.Notify(report.Pods)
+	}
+	return resp, nil
+}
+
+func (tc *TrackingClient) GetAllocatableResources(ctx context.Context, in *podresourcesapi.AllocatableResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.AllocatableResourcesResponse, error) {
+	return tc.cli.GetAllocatableResources(ctx, in, opts...)
+}
+
+func (tc *TrackingClient) LastReport() Report {
+	tc.lock.RLock()
+	defer tc.lock.RUnlock()
+	return tc.last
+}
+
+// ServeHTTP exposes the last placement as JSON
+func (tc *TrackingClient) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(tc.LastReport()); err != nil {
+		logger.ErrorS(err, "cannot encode the placement report")
+	}
+}
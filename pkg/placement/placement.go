@@ -0,0 +1,190 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package placement tells which NUMA zones, cpus and devices each container holds.
+package placement
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jaypipes/ghw"
+
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+const (
+	// AllNamespaces in the namespace list exports the placement of every pod
+	AllNamespaces = "*"
+)
+
+type Args struct {
+	// Namespaces whose pods placement is exported. Empty disables the export.
+	Namespaces []string
+	// Annotate also sets the placement as pod annotation
+	Annotate bool
+}
+
+func (args Args) Enabled() bool {
+	return len(args.Namespaces) > 0
+}
+
+type DevicePlacement struct {
+	ResourceName string   `json:"resourceName"`
+	DeviceIDs    []string `json:"deviceIds"`
+	Zones        []string `json:"zones,omitempty"`
+}
+
+type MemoryPlacement struct {
+	MemoryType string   `json:"memoryType"`
+	Size       uint64   `json:"size"`
+	Zones      []string `json:"zones,omitempty"`
+}
+
+type ContainerPlacement struct {
+	Name    string            `json:"name"`
+	CPUs    string            `json:"cpus,omitempty"`
+	Devices []DevicePlacement `json:"devices,omitempty"`
+	Memory  []MemoryPlacement `json:"memory,omitempty"`
+	// Zones are all the zones the container holds resources from
+	Zones []string `json:"zones"`
+}
+
+type PodPlacement struct {
+	Namespace  string               `json:"namespace"`
+	Name       string               `json:"name"`
+	Containers []ContainerPlacement `json:"containers"`
+}
+
+func (pp PodPlacement) Key() string {
+	return pp.Namespace + "/" + pp.Name
+}
+
+// NamespaceFilter tells if the placement of the pods of a namespace can be exported
+type NamespaceFilter func(namespace string) bool
+
+func NewNamespaceFilter(namespaces []string) NamespaceFilter {
+	allowed := make(map[string]bool)
+	for _, ns := range namespaces {
+		allowed[strings.TrimSpace(ns)] = true
+	}
+	return func(namespace string) bool {
+		return allowed[AllNamespaces] || allowed[namespace]
+	}
+}
+
+// CPUToNUMA maps each cpu to its NUMA node, reading the topology like the resource monitor does
+func CPUToNUMA(sysfsRoot string) (map[int]int, error) {
+	topo, err := ghw.Topology(ghw.WithPathOverrides(ghw.PathOverrides{
+		"/sys": sysfsRoot,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	cpuToNUMA := make(map[int]int)
+	for _, node := range topo.Nodes {
+		for _, core := range node.Cores {
+			for _, cpuID := range core.LogicalProcessors {
+				cpuToNUMA[cpuID] = node.ID
+			}
+		}
+	}
+	return cpuToNUMA, nil
+}
+
+// FromPodResources computes the placement of the pods holding exclusive resources in the allowed namespaces
+func FromPodResources(resp *podresourcesapi.ListPodResourcesResponse, cpuToNUMA map[int]int, allowed NamespaceFilter) []PodPlacement {
+	ret := []PodPlacement{}
+	for _, podRes := range resp.GetPodResources() {
+		if !allowed(podRes.GetNamespace()) {
+			continue
+		}
+		pp := PodPlacement{
+			Namespace: podRes.GetNamespace(),
+			Name:      podRes.GetName(),
+		}
+		for _, cntRes := range podRes.GetContainers() {
+			cp, ok := containerPlacement(cntRes, cpuToNUMA)
+			if ok {
+				pp.Containers = append(pp.Containers, cp)
+			}
+		}
+		if len(pp.Containers) == 0 {
+			continue
+		}
+		ret = append(ret, pp)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Key() < ret[j].Key() })
+	return ret
+}
+
+func containerPlacement(cntRes *podresourcesapi.ContainerResources, cpuToNUMA map[int]int) (ContainerPlacement, bool) {
+	cp := ContainerPlacement{
+		Name: cntRes.GetName(),
+	}
+	zones := make(map[int]bool)
+
+	cpus := cpuset.NewCPUSetInt64(cntRes.GetCpuIds()...)
+	if !cpus.IsEmpty() {
+		cp.CPUs = cpus.String()
+		for _, cpuID := range cpus.ToSlice() {
+			if numaID, ok := cpuToNUMA[cpuID]; ok {
+				zones[numaID] = true
+			}
+		}
+	}
+	for _, dev := range cntRes.GetDevices() {
+		dp := DevicePlacement{
+			ResourceName: dev.GetResourceName(),
+			DeviceIDs:    dev.GetDeviceIds(),
+		}
+		for _, node := range dev.GetTopology().GetNodes() {
+			dp.Zones = append(dp.Zones, ZoneName(int(node.GetID())))
+			zones[int(node.GetID())] = true
+		}
+		cp.Devices = append(cp.Devices, dp)
+	}
+	for _, mem := range cntRes.GetMemory() {
+		mp := MemoryPlacement{
+			MemoryType: mem.GetMemoryType(),
+			Size:       mem.GetSize_(),
+		}
+		for _, node := range mem.GetTopology().GetNodes() {
+			mp.Zones = append(mp.Zones, ZoneName(int(node.GetID())))
+			zones[int(node.GetID())] = true
+		}
+		cp.Memory = append(cp.Memory, mp)
+	}
+	if cpus.IsEmpty() && len(cp.Devices) == 0 && len(cp.Memory) == 0 {
+		return cp, false
+	}
+
+	numaIDs := []int{}
+	for numaID := range zones {
+		numaIDs = append(numaIDs, numaID)
+	}
+	sort.Ints(numaIDs)
+	cp.Zones = []string{}
+	for _, numaID := range numaIDs {
+		cp.Zones = append(cp.Zones, ZoneName(numaID))
+	}
+	return cp, true
+}
+
+// ZoneName matches the zone names in the NodeResourceTopology objects
+func ZoneName(numaID int) string {
+	return fmt.Sprintf("node-%d", numaID)
+}
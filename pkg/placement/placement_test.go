@@ -0,0 +1,127 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"reflect"
+	"testing"
+
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+// two NUMA nodes, even cpus on node 0
+var cpuToNUMA = map[int]int{0: 0, 1: 1, 2: 0, 3: 1, 4: 0, 5: 1, 6: 0, 7: 1}
+
+func makeResponse() *podresourcesapi.ListPodResourcesResponse {
+	return &podresourcesapi.ListPodResourcesResponse{
+		PodResources: []*podresourcesapi.PodResources{
+			{
+				Namespace: "telco",
+				Name:      "dpdk",
+				Containers: []*podresourcesapi.ContainerResources{
+					{
+						Name:   "app",
+						CpuIds: []int64{4, 2},
+						Devices: []*podresourcesapi.ContainerDevices{
+							{
+								ResourceName: "vendor.com/nic",
+								DeviceIds:    []string{"0000:3b:00.0"},
+								Topology:     &podresourcesapi.TopologyInfo{Nodes: []*podresourcesapi.NUMANode{{ID: 1}}},
+							},
+						},
+					},
+					{Name: "sidecar"},
+				},
+			},
+			{
+				Namespace: "telco",
+				Name:      "shared",
+				Containers: []*podresourcesapi.ContainerResources{
+					{Name: "app"},
+				},
+			},
+			{
+				Namespace: "secret",
+				Name:      "db",
+				Containers: []*podresourcesapi.ContainerResources{
+					{Name: "db", CpuIds: []int64{1}},
+				},
+			},
+			{
+				Namespace: "telco",
+				Name:      "hugepages",
+				Containers: []*podresourcesapi.ContainerResources{
+					{
+						Name: "app",
+						Memory: []*podresourcesapi.ContainerMemory{
+							{
+								MemoryType: "hugepages-1Gi",
+								Size_:      2 << 30,
+								Topology:   &podresourcesapi.TopologyInfo{Nodes: []*podresourcesapi.NUMANode{{ID: 1}}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestFromPodResources(t *testing.T) {
+	got := FromPodResources(makeResponse(), cpuToNUMA, NewNamespaceFilter([]string{"telco"}))
+	expected := []PodPlacement{
+		{
+			Namespace: "telco",
+			Name:      "dpdk",
+			Containers: []ContainerPlacement{
+				{
+					Name: "app",
+					CPUs: "2,4",
+					Devices: []DevicePlacement{
+						{ResourceName: "vendor.com/nic", DeviceIDs: []string{"0000:3b:00.0"}, Zones: []string{"node-1"}},
+					},
+					Zones: []string{"node-0", "node-1"},
+				},
+			},
+		},
+		{
+			Namespace: "telco",
+			Name:      "hugepages",
+			Containers: []ContainerPlacement{
+				{
+					Name: "app",
+					Memory: []MemoryPlacement{
+						{MemoryType: "hugepages-1Gi", Size: 2 << 30, Zones: []string{"node-1"}},
+					},
+					Zones: []string{"node-1"},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %+v\nexpected %+v", got, expected)
+	}
+}
+
+func TestNamespaceFilter(t *testing.T) {
+	all := FromPodResources(makeResponse(), cpuToNUMA, NewNamespaceFilter([]string{AllNamespaces}))
+	if len(all) != 3 {
+		t.Errorf("expected all the exclusive pods, got %+v", all)
+	}
+	none := FromPodResources(makeResponse(), cpuToNUMA, NewNamespaceFilter(nil))
+	if len(none) != 0 {
+		t.Errorf("expected no pods, got %+v", none)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podfingerprint
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc"
+
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+// FromPodResources computes the fingerprint of the pods holding exclusive resources:
+// cpus, devices or memory. Shared cpus are expected to be already filtered out.
+func FromPodResources(resp *podresourcesapi.ListPodResourcesResponse) string {
+	pods := resp.GetPodResources()
+	fp := NewFingerprint(len(pods))
+	for _, pod := range pods {
+		if hasExclusiveResources(pod) {
+			fp.Add(pod.GetNamespace(), pod.GetName())
+		}
+	}
+	return fp.Sign()
+}
+
+func hasExclusiveResources(pod *podresourcesapi.PodResources) bool {
+	for _, cnt := range pod.GetContainers() {
+		if len(cnt.GetCpuIds()) > 0 || len(cnt.GetDevices()) > 0 || len(cnt.GetMemory()) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// TrackingClient remembers the fingerprint of the last successful List response
+type TrackingClient struct {
+	cli podresourcesapi.PodResourcesListerClient
+
+	lock sync.Mutex
+	last string
+}
+
+func NewTrackingClient(cli podresourcesapi.PodResourcesListerClient) *TrackingClient {
+	return &TrackingClient{
+		cli: cli,
+	}
+}
+
+func (tc *TrackingClient) List(ctx context.Context, in *podresourcesapi.ListPodResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.ListPodResourcesResponse, error) {
+	resp, err := tc.cli.List(ctx, in, opts...)
+	if err != nil {
+		return resp, err
+	}
+	fp := FromPodResources(resp)
+	tc.lock.Lock()
+	tc.last = fp
+	tc.lock.Unlock()
+	return resp, nil
+}
+
+func (tc *TrackingClient) GetAllocatableResources(ctx context.Context, in *podresourcesapi.AllocatableResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.AllocatableResourcesResponse, error) {
+	return tc.cli.GetAllocatableResources(ctx, in, opts...)
+}
+
+// Last returns the fingerprint of the last List response, empty if none succeeded
+func (tc *TrackingClient) Last() string {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+	return tc.last
+}
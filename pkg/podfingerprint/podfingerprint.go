@@ -0,0 +1,77 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package podfingerprint computes a stable signature of a set of pods. The exporter publishes the
+// fingerprint of the pods holding exclusive resources on the node; a scheduler can compute the same
+// value from its pod cache and tell if the NodeResourceTopology data already reflects its bindings.
+// This package has no dependency on the exporter internals, to be importable by scheduler code.
+package podfingerprint
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"sort"
+)
+
+const (
+	// Prefix identifies the algorithm. Values with different prefixes are not comparable.
+	Prefix = "pfp0v001"
+)
+
+// Fingerprint accumulates the pods. The order of the Add calls does not matter.
+type Fingerprint struct {
+	pods []string
+}
+
+// NewFingerprint preallocates the room for size pods
+func NewFingerprint(size int) *Fingerprint {
+	return &Fingerprint{
+		pods: make([]string, 0, size),
+	}
+}
+
+// Add adds a pod identified by namespace and name. Adding the same pod twice changes the value.
+func (fp *Fingerprint) Add(namespace, name string) {
+	fp.pods = append(fp.pods, namespace+"/"+name)
+}
+
+// Sum returns the raw hash of the pods added so far
+func (fp *Fingerprint) Sum() uint64 {
+	pods := append([]string{}, fp.pods...)
+	sort.Strings(pods)
+	h := fnv.New64a()
+	var size [8]byte
+	for _, pod := range pods {
+		// length prefixes make the encoding unambiguous
+		binary.LittleEndian.PutUint64(size[:], uint64(len(pod)))
+		h.Write(size[:])
+		h.Write([]byte(pod))
+	}
+	return h.Sum64()
+}
+
+// Sign returns the fingerprint as published by the exporter
+func (fp *Fingerprint) Sign() string {
+	return fmt.Sprintf("%s%016x", Prefix, fp.Sum())
+}
+
+// Check tells if the pods added so far match the given published fingerprint
+func (fp *Fingerprint) Check(expected string) error {
+	got := fp.Sign()
+	if got != expected {
+		return fmt.Errorf("fingerprint mismatch: expected %q got %q", expected, got)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podfingerprint
+
+import (
+	"strings"
+	"testing"
+
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+func sign(pods ...string) string {
+	fp := NewFingerprint(len(pods))
+	for _, pod := range pods {
+		items := strings.SplitN(pod, "/", 2)
+		fp.Add(items[0], items[1])
+	}
+	return fp.Sign()
+}
+
+func TestSign(t *testing.T) {
+	empty := sign()
+	base := sign("ns1/pod-a", "ns2/pod-b")
+
+	if !strings.HasPrefix(base, Prefix) || len(base) != len(Prefix)+16 {
+		t.Errorf("malformed fingerprint %q", base)
+	}
+	if got := sign("ns2/pod-b", "ns1/pod-a"); got != base {
+		t.Errorf("order dependent: %q vs %q", got, base)
+	}
+
+	for _, pods := range [][]string{
+		{"ns1/pod-a"},
+		{"ns1/pod-a", "ns2/pod-c"},
+		{"ns1/pod-a", "ns1/pod-b"},
+		{"ns1/pod-a", "ns2/pod-b", "ns2/pod-b"},
+		// pods are not simply concatenated
+		{"ns1/pod-ans2/pod-b"},
+	} {
+		if got := sign(pods...); got == base || got == empty {
+			t.Errorf("pods %v: collision %q", pods, got)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	fp := NewFingerprint(2)
+	fp.Add("ns1", "pod-a")
+	fp.Add("ns2", "pod-b")
+	if err := fp.Check(sign("ns2/pod-b", "ns1/pod-a")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := fp.Check(sign("ns1/pod-a")); err == nil {
+		t.Errorf("mismatch not detected")
+	}
+}
+
+func TestFromPodResources(t *testing.T) {
+	resp := &podresourcesapi.ListPodResourcesResponse{
+		PodResources: []*podresourcesapi.PodResources{
+			{
+				Namespace: "ns1",
+				Name:      "exclusive-cpus",
+				Containers: []*podresourcesapi.ContainerResources{
+					{Name: "sidecar"},
+					{Name: "cnt", CpuIds: []int64{2, 3}},
+				},
+			},
+			{
+				Namespace: "ns1",
+				Name:      "shared",
+				Containers: []*podresourcesapi.ContainerResources{
+					{Name: "cnt"},
+				},
+			},
+			{
+				Namespace: "ns2",
+				Name:      "devices",
+				Containers: []*podresourcesapi.ContainerResources{
+					{Name: "cnt", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "vendor.com/nic", DeviceIds: []string{"dev0"}}}},
+				},
+			},
+			{
+				Namespace: "ns2",
+				Name:      "memory",
+				Containers: []*podresourcesapi.ContainerResources{
+					{Name: "cnt", Memory: []*podresourcesapi.ContainerMemory{{MemoryType: "hugepages-1Gi", Size_: 1 << 30}}},
+				},
+			},
+		},
+	}
+
+	expected := sign("ns1/exclusive-cpus", "ns2/devices", "ns2/memory")
+	if got := FromPodResources(resp); got != expected {
+		t.Errorf("got %q expected %q", got, expected)
+	}
+}
@@ -16,24 +16,32 @@ package podrescompat
 
 import (
 	"context"
-	"log"
+	"sync"
 
 	"google.golang.org/grpc"
 
+	corev1 "k8s.io/api/core/v1"
 	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
 
+	"github.com/openshift-kni/resource-topology-exporter/pkg/events"
 	"github.com/openshift-kni/resource-topology-exporter/pkg/sysinfo"
 )
 
 type sysinfoClient struct {
 	sysConf sysinfo.Config
 	cli     podresourcesapi.PodResourcesListerClient
+	rec     *events.Recorder
+
+	lock     sync.Mutex
+	fallback bool
 }
 
-func NewSysinfoClientFromLister(cli podresourcesapi.PodResourcesListerClient, sysConf sysinfo.Config) podresourcesapi.PodResourcesListerClient {
+// NewSysinfoClientFromLister falls back to sysinfo if the kubelet cannot report the allocatable resources.
+func NewSysinfoClientFromLister(cli podresourcesapi.PodResourcesListerClient, sysConf sysinfo.Config, rec *events.Recorder) podresourcesapi.PodResourcesListerClient {
 	return &sysinfoClient{
 		cli:     cli,
 		sysConf: sysConf,
+		rec:     rec,
 	}
 }
 
@@ -41,20 +49,63 @@ func (sc *sysinfoClient) List(ctx context.Context, in *podresourcesapi.ListPodRe
 	return sc.cli.List(ctx, in, opts...)
 }
 
+func (sc *sysinfoClient) Get(ctx context.Context, podNamespace, podName string) (*podresourcesapi.PodResources, error) {
+	return GetPodResources(ctx, sc.cli, podNamespace, podName)
+}
+
 func (sc *sysinfoClient) GetAllocatableResources(ctx context.Context, in *podresourcesapi.AllocatableResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.AllocatableResourcesResponse, error) {
 	resp, err := sc.cli.GetAllocatableResources(ctx, in, opts...)
 	if err != nil {
-		log.Printf("podresourcesapi GetAllocatableResources() failed with %v - using sysinfo", err)
+		logger.ErrorS(err, "GetAllocatableResources failed, using sysinfo")
 		sysResp, sysErr := sc.makeAllocatableResourcesResponse()
 		if sysErr != nil {
-			log.Printf("sysinfo makeAllocatableResourcesResponse failed with %v", sysErr)
+			logger.ErrorS(sysErr, "cannot build the allocatable resources from sysinfo")
 			return resp, err
 		}
+		sc.setFallback(true, err)
 		return sysResp, nil
 	}
+	sc.setFallback(false, nil)
+	if sc.sysConf.DynamicResources {
+		// devices handed out through DRA are unknown to the kubelet device manager
+		sysResp, sysErr := sc.makeAllocatableResourcesResponse()
+		if sysErr != nil {
+			logger.ErrorS(sysErr, "cannot build the allocatable resources from sysinfo, DRA devices not accounted")
+			return resp, nil
+		}
+		return MergeAllocatableDevices(resp, sysResp), nil
+	}
 	return resp, nil
 }
 
+// setFallback records the event only when the fallback starts
+func (sc *sysinfoClient) setFallback(active bool, err error) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+	if active && !sc.fallback {
+		sc.rec.Exporterf(corev1.EventTypeWarning, events.ReasonSysinfoFallbackActive, "kubelet cannot report the allocatable resources (%v), using sysinfo", err)
+	}
+	if !active && sc.fallback {
+		logger.InfoS("GetAllocatableResources works again, not using sysinfo anymore")
+	}
+	sc.fallback = active
+}
+
+// MergeAllocatableDevices adds to the kubelet response the devices of the resources only sysinfo knows about.
+func MergeAllocatableDevices(resp, sysResp *podresourcesapi.AllocatableResourcesResponse) *podresourcesapi.AllocatableResourcesResponse {
+	known := make(map[string]bool)
+	for _, dev := range resp.GetDevices() {
+		known[dev.GetResourceName()] = true
+	}
+	for _, dev := range sysResp.GetDevices() {
+		if known[dev.GetResourceName()] {
+			continue
+		}
+		resp.Devices = append(resp.Devices, dev)
+	}
+	return resp
+}
+
 func (sc *sysinfoClient) makeAllocatableResourcesResponse() (*podresourcesapi.AllocatableResourcesResponse, error) {
 	sysInfo, err := sysinfo.NewSysinfo(sc.sysConf)
 	if err != nil {
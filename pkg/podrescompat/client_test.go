@@ -65,3 +65,30 @@ func TestMakeAllocatableResourcesResponseFromSysInfo(t *testing.T) {
 		})
 	}
 }
+
+func TestMergeAllocatableDevices(t *testing.T) {
+	resp := &podresourcesapi.AllocatableResourcesResponse{
+		CpuIds: []int64{1, 2},
+		Devices: []*podresourcesapi.ContainerDevices{
+			{ResourceName: "intel_nics", DeviceIds: []string{"0000:00:02.0"}},
+		},
+	}
+	sysResp := &podresourcesapi.AllocatableResourcesResponse{
+		CpuIds: []int64{1, 2, 3},
+		Devices: []*podresourcesapi.ContainerDevices{
+			{ResourceName: "intel_nics", DeviceIds: []string{"0000:00:02.0", "0000:00:02.1"}},
+			{ResourceName: "example.com/gpu", DeviceIds: []string{"0000:3b:00.0"}},
+		},
+	}
+	expected := &podresourcesapi.AllocatableResourcesResponse{
+		CpuIds: []int64{1, 2},
+		Devices: []*podresourcesapi.ContainerDevices{
+			{ResourceName: "intel_nics", DeviceIds: []string{"0000:00:02.0"}},
+			{ResourceName: "example.com/gpu", DeviceIds: []string{"0000:3b:00.0"}},
+		},
+	}
+	got := MergeAllocatableDevices(resp, sysResp)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, want %v", got, expected)
+	}
+}
@@ -0,0 +1,268 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podrescompat
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+	podresourcesapiv1alpha1 "k8s.io/kubelet/pkg/apis/podresources/v1alpha1"
+	"k8s.io/kubernetes/pkg/kubelet/apis/podresources"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/logging"
+)
+
+const (
+	defaultPodResourcesTimeout = 10 * time.Second
+	defaultPodResourcesMaxSize = 1024 * 1024 * 16 // 16 Mb
+)
+
+const (
+	APIVersionV1       = "v1"
+	APIVersionV1alpha1 = "v1alpha1"
+)
+
+var logger = logging.Component("podrescompat")
+
+// Capabilities describes which parts of the podresources API the kubelet serves.
+type Capabilities struct {
+	// APIVersion is the version used to serve List: APIVersionV1 or APIVersionV1alpha1
+	APIVersion              string
+	GetAllocatableResources bool
+	Get                     bool
+}
+
+func (ca Capabilities) String() string {
+	return fmt.Sprintf("version=%s getAllocatableResources=%v get=%v", ca.APIVersion, ca.GetAllocatableResources, ca.Get)
+}
+
+// PodResourcesGetter fetches the resources of a single pod.
+type PodResourcesGetter interface {
+	Get(ctx context.Context, podNamespace, podName string) (*podresourcesapi.PodResources, error)
+}
+
+// GetPodResources returns the resources of the given pod through cli, so the wrapping clients adjust
+// them like they do for List. It uses the Get of cli if it has one, and filters its List response otherwise.
+func GetPodResources(ctx context.Context, cli podresourcesapi.PodResourcesListerClient, podNamespace, podName string) (*podresourcesapi.PodResources, error) {
+	if getter, ok := cli.(PodResourcesGetter); ok {
+		return getter.Get(ctx, podNamespace, podName)
+	}
+	resp, err := cli.List(ctx, &podresourcesapi.ListPodResourcesRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return findPodResources(resp, podNamespace, podName)
+}
+
+func findPodResources(resp *podresourcesapi.ListPodResourcesResponse, podNamespace, podName string) (*podresourcesapi.PodResources, error) {
+	for _, podRes := range resp.GetPodResources() {
+		if podRes.GetNamespace() == podNamespace && podRes.GetName() == podName {
+			return podRes, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "pod %s/%s not found", podNamespace, podName)
+}
+
+// CompatClient is a v1 podresources client which adapts to the API the kubelet
+// actually serves: it falls back to v1alpha1 List on older kubelets, and uses
+// the per-pod Get on newer ones.
+type CompatClient struct {
+	v1Cli       podresourcesapi.PodResourcesListerClient
+	v1alpha1Cli podresourcesapiv1alpha1.PodResourcesListerClient
+	// conn is used for the calls the vendored kubelet API does not know about
+	conn grpc.ClientConnInterface
+
+	lock            sync.Mutex
+	caps            *Capabilities
+	resolveDynamics DynamicResourceResolver
+}
+
+func NewCompatClient(socketPath string) (*CompatClient, error) {
+	_, conn, err := podresources.GetV1Client(socketPath, defaultPodResourcesTimeout, defaultPodResourcesMaxSize)
+	if err != nil {
+		return nil, err
+	}
+	return NewCompatClientFromConn(conn), nil
+}
+
+func NewCompatClientFromConn(conn *grpc.ClientConn) *CompatClient {
+	return newCompatClient(podresourcesapi.NewPodResourcesListerClient(conn), podresourcesapiv1alpha1.NewPodResourcesListerClient(conn), conn)
+}
+
+func newCompatClient(v1Cli podresourcesapi.PodResourcesListerClient, v1alpha1Cli podresourcesapiv1alpha1.PodResourcesListerClient, conn grpc.ClientConnInterface) *CompatClient {
+	return &CompatClient{
+		v1Cli:       v1Cli,
+		v1alpha1Cli: v1alpha1Cli,
+		conn:        conn,
+	}
+}
+
+// EnableDynamicResources makes List account the devices allocated through DRA claims,
+// which the resolver maps to plain devices. Must be called before the client is used.
+func (cc *CompatClient) EnableDynamicResources(resolve DynamicResourceResolver) {
+	cc.resolveDynamics = resolve
+}
+
+// Negotiate probes the kubelet for the supported API features. The result is cached
+// until a call fails as unimplemented, which means the kubelet changed under us.
+func (cc *CompatClient) Negotiate(ctx context.Context) (Capabilities, error) {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+	if cc.caps != nil {
+		return *cc.caps, nil
+	}
+
+	caps := Capabilities{
+		APIVersion: APIVersionV1,
+	}
+	_, err := cc.v1Cli.List(ctx, &podresourcesapi.ListPodResourcesRequest{})
+	if isUnimplemented(err) {
+		_, err = cc.v1alpha1Cli.List(ctx, &podresourcesapiv1alpha1.ListPodResourcesRequest{})
+		caps.APIVersion = APIVersionV1alpha1
+	}
+	if err != nil {
+		return caps, fmt.Errorf("cannot negotiate podresources API: %w", err)
+	}
+
+	if caps.APIVersion == APIVersionV1 {
+		_, err = cc.v1Cli.GetAllocatableResources(ctx, &podresourcesapi.AllocatableResourcesRequest{})
+		caps.GetAllocatableResources = !isUnimplemented(err)
+
+		// the empty pod is never found, so "not found" proves the endpoint is there. Any other
+		// error, e.g. a timeout or a permission failure, tells nothing and we stick to List.
+		err = cc.conn.Invoke(ctx, methodV1Get, &GetPodResourcesRequest{}, &GetPodResourcesResponse{})
+		caps.Get = err == nil || status.Code(err) == codes.NotFound
+	}
+
+	logger.InfoS("negotiated the podresources API capabilities", "capabilities", caps.String())
+	cc.caps = &caps
+	return caps, nil
+}
+
+func (cc *CompatClient) List(ctx context.Context, in *podresourcesapi.ListPodResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.ListPodResourcesResponse, error) {
+	caps, err := cc.Negotiate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if caps.APIVersion == APIVersionV1alpha1 {
+		resp, err := cc.v1alpha1Cli.List(ctx, &podresourcesapiv1alpha1.ListPodResourcesRequest{}, opts...)
+		if err != nil {
+			cc.invalidateOnUnimplemented(err)
+			return nil, err
+		}
+		return ListResponseFromV1alpha1(resp), nil
+	}
+	if cc.resolveDynamics != nil {
+		resp := draListPodResourcesResponse{}
+		err := cc.conn.Invoke(ctx, methodV1List, in, &resp, opts...)
+		if err != nil {
+			cc.invalidateOnUnimplemented(err)
+			return nil, err
+		}
+		return listResponseFromDynamicResources(&resp, cc.resolveDynamics), nil
+	}
+	resp, err := cc.v1Cli.List(ctx, in, opts...)
+	cc.invalidateOnUnimplemented(err)
+	return resp, err
+}
+
+func (cc *CompatClient) GetAllocatableResources(ctx context.Context, in *podresourcesapi.AllocatableResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.AllocatableResourcesResponse, error) {
+	caps, err := cc.Negotiate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !caps.GetAllocatableResources {
+		// let the callers (e.g. the sysinfo client) handle this like the kubelet told us
+		return nil, status.Errorf(codes.Unimplemented, "GetAllocatableResources not supported by the %s podresources API", caps.APIVersion)
+	}
+	resp, err := cc.v1Cli.GetAllocatableResources(ctx, in, opts...)
+	cc.invalidateOnUnimplemented(err)
+	return resp, err
+}
+
+// Get returns the resources of the given pod, using the podresources Get if the kubelet
+// serves it, and filtering the List response otherwise.
+func (cc *CompatClient) Get(ctx context.Context, podNamespace, podName string) (*podresourcesapi.PodResources, error) {
+	caps, err := cc.Negotiate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if caps.Get {
+		req := GetPodResourcesRequest{
+			PodNamespace: podNamespace,
+			PodName:      podName,
+		}
+		resp := GetPodResourcesResponse{}
+		err := cc.conn.Invoke(ctx, methodV1Get, &req, &resp)
+		if err != nil {
+			cc.invalidateOnUnimplemented(err)
+			return nil, err
+		}
+		return resp.PodResources, nil
+	}
+
+	resp, err := cc.List(ctx, &podresourcesapi.ListPodResourcesRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return findPodResources(resp, podNamespace, podName)
+}
+
+func (cc *CompatClient) invalidateOnUnimplemented(err error) {
+	if !isUnimplemented(err) {
+		return
+	}
+	logger.InfoS("podresources API call unimplemented, will renegotiate the capabilities")
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+	cc.caps = nil
+}
+
+func isUnimplemented(err error) bool {
+	return status.Code(err) == codes.Unimplemented
+}
+
+// ListResponseFromV1alpha1 translates a v1alpha1 List response into its v1 counterpart.
+// v1alpha1 predates CPU, memory and topology reporting, so these are left empty.
+func ListResponseFromV1alpha1(resp *podresourcesapiv1alpha1.ListPodResourcesResponse) *podresourcesapi.ListPodResourcesResponse {
+	ret := podresourcesapi.ListPodResourcesResponse{}
+	for _, podRes := range resp.GetPodResources() {
+		pr := podresourcesapi.PodResources{
+			Name:      podRes.GetName(),
+			Namespace: podRes.GetNamespace(),
+		}
+		for _, cntRes := range podRes.GetContainers() {
+			cr := podresourcesapi.ContainerResources{
+				Name: cntRes.GetName(),
+			}
+			for _, dev := range cntRes.GetDevices() {
+				cr.Devices = append(cr.Devices, &podresourcesapi.ContainerDevices{
+					ResourceName: dev.GetResourceName(),
+					DeviceIds:    dev.GetDeviceIds(),
+				})
+			}
+			pr.Containers = append(pr.Containers, &cr)
+		}
+		ret.PodResources = append(ret.PodResources, &pr)
+	}
+	return &ret
+}
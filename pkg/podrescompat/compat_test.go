@@ -0,0 +1,307 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podrescompat
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+	podresourcesapiv1alpha1 "k8s.io/kubelet/pkg/apis/podresources/v1alpha1"
+)
+
+type fakeV1Client struct {
+	listResp     *podresourcesapi.ListPodResourcesResponse
+	listErr      error
+	allocResp    *podresourcesapi.AllocatableResourcesResponse
+	allocErr     error
+	listRequests int
+}
+
+func (fc *fakeV1Client) List(ctx context.Context, in *podresourcesapi.ListPodResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.ListPodResourcesResponse, error) {
+	fc.listRequests++
+	return fc.listResp, fc.listErr
+}
+
+func (fc *fakeV1Client) GetAllocatableResources(ctx context.Context, in *podresourcesapi.AllocatableResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.AllocatableResourcesResponse, error) {
+	return fc.allocResp, fc.allocErr
+}
+
+type fakeV1alpha1Client struct {
+	listResp *podresourcesapiv1alpha1.ListPodResourcesResponse
+	listErr  error
+}
+
+func (fc *fakeV1alpha1Client) List(ctx context.Context, in *podresourcesapiv1alpha1.ListPodResourcesRequest, opts ...grpc.CallOption) (*podresourcesapiv1alpha1.ListPodResourcesResponse, error) {
+	return fc.listResp, fc.listErr
+}
+
+type fakeConn struct {
+	getResp  *GetPodResourcesResponse
+	getErr   error
+	listResp *draListPodResourcesResponse
+	methods  []string
+}
+
+func (fc *fakeConn) Invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+	fc.methods = append(fc.methods, method)
+	if method == methodV1List {
+		if fc.listResp != nil {
+			*(reply.(*draListPodResourcesResponse)) = *fc.listResp
+		}
+		return nil
+	}
+	if fc.getErr != nil {
+		return fc.getErr
+	}
+	if fc.getResp != nil {
+		*(reply.(*GetPodResourcesResponse)) = *fc.getResp
+	}
+	return nil
+}
+
+func (fc *fakeConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return nil, status.Errorf(codes.Unimplemented, "streams not supported")
+}
+
+func TestNegotiateV1(t *testing.T) {
+	v1Cli := &fakeV1Client{
+		listResp: &podresourcesapi.ListPodResourcesResponse{},
+		allocErr: status.Errorf(codes.Unimplemented, "nope"),
+	}
+	conn := &fakeConn{getErr: status.Errorf(codes.NotFound, "pod not found")}
+	cc := newCompatClient(v1Cli, &fakeV1alpha1Client{}, conn)
+
+	caps, err := cc.Negotiate(context.TODO())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := Capabilities{APIVersion: APIVersionV1, GetAllocatableResources: false, Get: true}
+	if caps != expected {
+		t.Errorf("got %v, want %v", caps, expected)
+	}
+
+	_, err = cc.GetAllocatableResources(context.TODO(), &podresourcesapi.AllocatableResourcesRequest{})
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("expected unimplemented, got %v", err)
+	}
+}
+
+func TestNegotiateGetProbe(t *testing.T) {
+	testCases := []struct {
+		name     string
+		getErr   error
+		expected bool
+	}{
+		{name: "served", getErr: nil, expected: true},
+		{name: "pod not found", getErr: status.Errorf(codes.NotFound, "pod not found"), expected: true},
+		{name: "unimplemented", getErr: status.Errorf(codes.Unimplemented, "unknown method Get"), expected: false},
+		{name: "unavailable", getErr: status.Errorf(codes.Unavailable, "connection refused"), expected: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v1Cli := &fakeV1Client{
+				listResp: &podresourcesapi.ListPodResourcesResponse{},
+			}
+			cc := newCompatClient(v1Cli, &fakeV1alpha1Client{}, &fakeConn{getErr: tc.getErr})
+			caps, err := cc.Negotiate(context.TODO())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if caps.Get != tc.expected {
+				t.Errorf("got get=%v, want %v", caps.Get, tc.expected)
+			}
+		})
+	}
+}
+
+func TestNegotiateV1alpha1(t *testing.T) {
+	v1Cli := &fakeV1Client{
+		listErr: status.Errorf(codes.Unimplemented, "unknown service v1.PodResourcesLister"),
+	}
+	v1alpha1Cli := &fakeV1alpha1Client{
+		listResp: &podresourcesapiv1alpha1.ListPodResourcesResponse{
+			PodResources: []*podresourcesapiv1alpha1.PodResources{
+				{
+					Name:      "pod",
+					Namespace: "ns",
+					Containers: []*podresourcesapiv1alpha1.ContainerResources{
+						{
+							Name: "cnt",
+							Devices: []*podresourcesapiv1alpha1.ContainerDevices{
+								{ResourceName: "intel_nics", DeviceIds: []string{"0000:00:02.0"}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	conn := &fakeConn{}
+	cc := newCompatClient(v1Cli, v1alpha1Cli, conn)
+
+	resp, err := cc.List(context.TODO(), &podresourcesapi.ListPodResourcesRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(conn.methods) != 0 {
+		t.Errorf("unexpected v1 calls on a v1alpha1 kubelet: %v", conn.methods)
+	}
+	expected := &podresourcesapi.ListPodResourcesResponse{
+		PodResources: []*podresourcesapi.PodResources{
+			{
+				Name:      "pod",
+				Namespace: "ns",
+				Containers: []*podresourcesapi.ContainerResources{
+					{
+						Name: "cnt",
+						Devices: []*podresourcesapi.ContainerDevices{
+							{ResourceName: "intel_nics", DeviceIds: []string{"0000:00:02.0"}},
+						},
+					},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(resp, expected) {
+		t.Errorf("got %v, want %v", resp, expected)
+	}
+
+	pr, err := cc.Get(context.TODO(), "ns", "pod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(pr, expected.PodResources[0]) {
+		t.Errorf("got %v, want %v", pr, expected.PodResources[0])
+	}
+	_, err = cc.Get(context.TODO(), "ns", "missing")
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
+
+func TestGetRenegotiatesOnUnimplemented(t *testing.T) {
+	v1Cli := &fakeV1Client{
+		listResp: &podresourcesapi.ListPodResourcesResponse{},
+	}
+	conn := &fakeConn{
+		getResp: &GetPodResourcesResponse{
+			PodResources: &podresourcesapi.PodResources{Name: "pod", Namespace: "ns"},
+		},
+	}
+	cc := newCompatClient(v1Cli, &fakeV1alpha1Client{}, conn)
+
+	pr, err := cc.Get(context.TODO(), "ns", "pod")
+	if err != nil || pr.GetName() != "pod" {
+		t.Fatalf("unexpected result: %v %v", pr, err)
+	}
+
+	// the kubelet got downgraded
+	conn.getErr = status.Errorf(codes.Unimplemented, "unknown method Get")
+	_, err = cc.Get(context.TODO(), "ns", "pod")
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("expected unimplemented, got %v", err)
+	}
+	caps, err := cc.Negotiate(context.TODO())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if caps.Get {
+		t.Errorf("Get still reported as supported after renegotiation")
+	}
+}
+
+func TestGetPodResources(t *testing.T) {
+	v1Cli := &fakeV1Client{
+		listResp: &podresourcesapi.ListPodResourcesResponse{
+			PodResources: []*podresourcesapi.PodResources{
+				{Name: "pod", Namespace: "ns"},
+			},
+		},
+	}
+
+	// a client without Get is served from its List
+	pr, err := GetPodResources(context.TODO(), v1Cli, "ns", "pod")
+	if err != nil || pr.GetName() != "pod" {
+		t.Fatalf("unexpected result: %v %v", pr, err)
+	}
+	if v1Cli.listRequests != 1 {
+		t.Errorf("expected 1 List, got %d", v1Cli.listRequests)
+	}
+	_, err = GetPodResources(context.TODO(), v1Cli, "ns", "missing")
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	// the wrapping clients pass the Get through
+	conn := &fakeConn{
+		getResp: &GetPodResourcesResponse{
+			PodResources: &podresourcesapi.PodResources{Name: "pod", Namespace: "ns"},
+		},
+	}
+	cli := NewContextClientFromLister(context.TODO(), newCompatClient(v1Cli, &fakeV1alpha1Client{}, conn))
+	pr, err = GetPodResources(context.TODO(), cli, "ns", "pod")
+	if err != nil || pr.GetName() != "pod" {
+		t.Fatalf("unexpected result: %v %v", pr, err)
+	}
+	if last := conn.methods[len(conn.methods)-1]; last != methodV1Get {
+		t.Errorf("expected a Get, got %q", last)
+	}
+}
+
+func TestGetMessagesWireFormat(t *testing.T) {
+	codec := encoding.GetCodec("proto")
+
+	req := GetPodResourcesRequest{PodName: "pod", PodNamespace: "ns"}
+	data, err := codec.Marshal(&req)
+	if err != nil {
+		t.Fatalf("cannot marshal request: %v", err)
+	}
+	// field 1 (pod_name) then field 2 (pod_namespace), both length-delimited
+	expected := []byte{0x0a, 0x03, 'p', 'o', 'd', 0x12, 0x02, 'n', 's'}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("got %v, want %v", data, expected)
+	}
+
+	// GetPodResourcesResponse embeds PodResources as field 1, like ListPodResourcesResponse does
+	listResp := podresourcesapi.ListPodResourcesResponse{
+		PodResources: []*podresourcesapi.PodResources{
+			{
+				Name:      "pod",
+				Namespace: "ns",
+				Containers: []*podresourcesapi.ContainerResources{
+					{Name: "cnt", CpuIds: []int64{2, 3}},
+				},
+			},
+		},
+	}
+	data, err = listResp.Marshal()
+	if err != nil {
+		t.Fatalf("cannot marshal list response: %v", err)
+	}
+	resp := GetPodResourcesResponse{}
+	if err := codec.Unmarshal(data, &resp); err != nil {
+		t.Fatalf("cannot unmarshal response: %v", err)
+	}
+	if !reflect.DeepEqual(resp.PodResources, listResp.PodResources[0]) {
+		t.Errorf("got %v, want %v", resp.PodResources, listResp.PodResources[0])
+	}
+}
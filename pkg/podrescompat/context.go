@@ -0,0 +1,68 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podrescompat
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+// contextClient cancels the calls in flight when the root context is done. The callers,
+// like the upstream resource monitor, derive the call contexts from context.Background().
+type contextClient struct {
+	root context.Context
+	cli  podresourcesapi.PodResourcesListerClient
+}
+
+func NewContextClientFromLister(root context.Context, cli podresourcesapi.PodResourcesListerClient) podresourcesapi.PodResourcesListerClient {
+	return &contextClient{
+		root: root,
+		cli:  cli,
+	}
+}
+
+func (cc *contextClient) List(ctx context.Context, in *podresourcesapi.ListPodResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.ListPodResourcesResponse, error) {
+	ctx, cancel := cc.bind(ctx)
+	defer cancel()
+	return cc.cli.List(ctx, in, opts...)
+}
+
+func (cc *contextClient) GetAllocatableResources(ctx context.Context, in *podresourcesapi.AllocatableResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.AllocatableResourcesResponse, error) {
+	ctx, cancel := cc.bind(ctx)
+	defer cancel()
+	return cc.cli.GetAllocatableResources(ctx, in, opts...)
+}
+
+func (cc *contextClient) Get(ctx context.Context, podNamespace, podName string) (*podresourcesapi.PodResources, error) {
+	ctx, cancel := cc.bind(ctx)
+	defer cancel()
+	return GetPodResources(ctx, cc.cli, podNamespace, podName)
+}
+
+// bind returns a context done when either ctx or the root context is done
+func (cc *contextClient) bind(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-cc.root.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
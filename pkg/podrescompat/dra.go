@@ -0,0 +1,209 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podrescompat
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/sysinfo"
+)
+
+// Like Get, the DynamicResources reported per container are newer than the
+// vendored kubelet API, whose generated code drops them while decoding. We
+// mirror the List response down to the DRA fields so we can read them.
+
+const (
+	methodV1List = "/v1.PodResourcesLister/List"
+)
+
+type CDIDevice struct {
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+}
+
+func (m *CDIDevice) Reset()         { *m = CDIDevice{} }
+func (m *CDIDevice) String() string { return fmt.Sprintf("CDIDevice{%s}", m.Name) }
+func (*CDIDevice) ProtoMessage()    {}
+
+type ClaimResource struct {
+	CDIDevices []*CDIDevice `protobuf:"bytes,1,rep,name=cdi_devices,json=cdiDevices,proto3" json:"cdi_devices,omitempty"`
+	DriverName string       `protobuf:"bytes,2,opt,name=driver_name,json=driverName,proto3" json:"driver_name,omitempty"`
+	PoolName   string       `protobuf:"bytes,3,opt,name=pool_name,json=poolName,proto3" json:"pool_name,omitempty"`
+	DeviceName string       `protobuf:"bytes,4,opt,name=device_name,json=deviceName,proto3" json:"device_name,omitempty"`
+}
+
+func (m *ClaimResource) Reset() { *m = ClaimResource{} }
+func (m *ClaimResource) String() string {
+	return fmt.Sprintf("ClaimResource{%s/%s/%s cdi=%v}", m.DriverName, m.PoolName, m.DeviceName, m.CDIDevices)
+}
+func (*ClaimResource) ProtoMessage() {}
+
+type DynamicResource struct {
+	ClassName      string           `protobuf:"bytes,1,opt,name=class_name,json=className,proto3" json:"class_name,omitempty"`
+	ClaimName      string           `protobuf:"bytes,2,opt,name=claim_name,json=claimName,proto3" json:"claim_name,omitempty"`
+	ClaimNamespace string           `protobuf:"bytes,3,opt,name=claim_namespace,json=claimNamespace,proto3" json:"claim_namespace,omitempty"`
+	ClaimResources []*ClaimResource `protobuf:"bytes,4,rep,name=claim_resources,json=claimResources,proto3" json:"claim_resources,omitempty"`
+}
+
+func (m *DynamicResource) Reset() { *m = DynamicResource{} }
+func (m *DynamicResource) String() string {
+	return fmt.Sprintf("DynamicResource{%s/%s %v}", m.ClaimNamespace, m.ClaimName, m.ClaimResources)
+}
+func (*DynamicResource) ProtoMessage() {}
+
+type draContainerResources struct {
+	Name             string                              `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Devices          []*podresourcesapi.ContainerDevices `protobuf:"bytes,2,rep,name=devices,proto3" json:"devices,omitempty"`
+	CpuIds           []int64                             `protobuf:"varint,3,rep,packed,name=cpu_ids,json=cpuIds,proto3" json:"cpu_ids,omitempty"`
+	Memory           []*podresourcesapi.ContainerMemory  `protobuf:"bytes,4,rep,name=memory,proto3" json:"memory,omitempty"`
+	DynamicResources []*DynamicResource                  `protobuf:"bytes,5,rep,name=dynamic_resources,json=dynamicResources,proto3" json:"dynamic_resources,omitempty"`
+}
+
+func (m *draContainerResources) Reset()         { *m = draContainerResources{} }
+func (m *draContainerResources) String() string { return fmt.Sprintf("ContainerResources{%s}", m.Name) }
+func (*draContainerResources) ProtoMessage()    {}
+
+type draPodResources struct {
+	Name       string                   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Namespace  string                   `protobuf:"bytes,2,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Containers []*draContainerResources `protobuf:"bytes,3,rep,name=containers,proto3" json:"containers,omitempty"`
+}
+
+func (m *draPodResources) Reset() { *m = draPodResources{} }
+func (m *draPodResources) String() string {
+	return fmt.Sprintf("PodResources{%s/%s}", m.Namespace, m.Name)
+}
+func (*draPodResources) ProtoMessage() {}
+
+type draListPodResourcesResponse struct {
+	PodResources []*draPodResources `protobuf:"bytes,1,rep,name=pod_resources,json=podResources,proto3" json:"pod_resources,omitempty"`
+}
+
+func (m *draListPodResourcesResponse) Reset() { *m = draListPodResourcesResponse{} }
+func (m *draListPodResourcesResponse) String() string {
+	return fmt.Sprintf("ListPodResourcesResponse{%d pods}", len(m.PodResources))
+}
+func (*draListPodResourcesResponse) ProtoMessage() {}
+
+// DynamicResourceResolver tells which resource, and on which NUMA cell, a device
+// allocated through a DRA claim should be accounted as.
+type DynamicResourceResolver func(claimRes *ClaimResource) (resourceName string, numaID int, ok bool)
+
+// listResponseFromDynamicResources converts the mirrored List response into the v1 one,
+// turning the DRA allocations the resolver knows about into plain topology-aware devices,
+// so they are subtracted from the zone availability like any device plugin resource.
+func listResponseFromDynamicResources(resp *draListPodResourcesResponse, resolve DynamicResourceResolver) *podresourcesapi.ListPodResourcesResponse {
+	ret := podresourcesapi.ListPodResourcesResponse{}
+	for _, podRes := range resp.PodResources {
+		pr := podresourcesapi.PodResources{
+			Name:      podRes.Name,
+			Namespace: podRes.Namespace,
+		}
+		for _, cntRes := range podRes.Containers {
+			cr := podresourcesapi.ContainerResources{
+				Name:    cntRes.Name,
+				Devices: cntRes.Devices,
+				CpuIds:  cntRes.CpuIds,
+				Memory:  cntRes.Memory,
+			}
+			for _, dynRes := range cntRes.DynamicResources {
+				for _, claimRes := range dynRes.ClaimResources {
+					resourceName, numaID, ok := resolve(claimRes)
+					if !ok {
+						logger.InfoS("cannot find the NUMA cell of the claim resource", "resource", claimRes.String(), "claim", dynRes.ClaimNamespace+"/"+dynRes.ClaimName)
+						continue
+					}
+					cr.Devices = append(cr.Devices, &podresourcesapi.ContainerDevices{
+						ResourceName: resourceName,
+						DeviceIds:    []string{claimDeviceID(claimRes)},
+						Topology: &podresourcesapi.TopologyInfo{
+							Nodes: []*podresourcesapi.NUMANode{
+								{ID: int64(numaID)},
+							},
+						},
+					})
+				}
+			}
+			pr.Containers = append(pr.Containers, &cr)
+		}
+		ret.PodResources = append(ret.PodResources, &pr)
+	}
+	return &ret
+}
+
+func claimDeviceID(claimRes *ClaimResource) string {
+	if claimRes.DeviceName != "" {
+		return claimRes.DeviceName
+	}
+	names := make([]string, 0, len(claimRes.CDIDevices))
+	for _, cdiDev := range claimRes.CDIDevices {
+		names = append(names, cdiDev.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+// DRA drivers name PCI devices either after the plain address (0000:3b:00.0)
+// or after a DNS-label friendly version of it (pci-0000-3b-00-0)
+var pciAddressRegexp = regexp.MustCompile(`(?i)([0-9a-f]{4})[:-]([0-9a-f]{2})[:-]([0-9a-f]{2})[.-]([0-7])`)
+
+func PCIAddressFromDeviceName(name string) (string, bool) {
+	match := pciAddressRegexp.FindStringSubmatch(name)
+	if match == nil {
+		return "", false
+	}
+	return strings.ToLower(fmt.Sprintf("%s:%s:%s.%s", match[1], match[2], match[3], match[4])), true
+}
+
+// NewSysinfoDynamicResourceResolver resolves DRA devices which carry a PCI address in
+// their name or in their CDI device names, using the resource mapping of sysinfo.
+func NewSysinfoDynamicResourceResolver(sysInfo sysinfo.SysInfo) DynamicResourceResolver {
+	type devInfo struct {
+		resourceName string
+		numaID       int
+	}
+	devs := make(map[string]devInfo)
+	for resourceName, numaDevs := range sysInfo.Resources {
+		for numaID, addrs := range numaDevs {
+			for _, addr := range addrs {
+				devs[strings.ToLower(addr)] = devInfo{
+					resourceName: resourceName,
+					numaID:       numaID,
+				}
+			}
+		}
+	}
+
+	return func(claimRes *ClaimResource) (string, int, bool) {
+		names := []string{claimRes.DeviceName}
+		for _, cdiDev := range claimRes.CDIDevices {
+			names = append(names, cdiDev.Name)
+		}
+		for _, name := range names {
+			addr, ok := PCIAddressFromDeviceName(name)
+			if !ok {
+				continue
+			}
+			info, ok := devs[addr]
+			if !ok || info.numaID < 0 {
+				continue
+			}
+			return info.resourceName, info.numaID, true
+		}
+		return "", -1, false
+	}
+}
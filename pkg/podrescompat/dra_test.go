@@ -0,0 +1,179 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podrescompat
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc/encoding"
+
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/sysinfo"
+)
+
+func TestPCIAddressFromDeviceName(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		expected string
+		ok       bool
+	}{
+		{"0000:3b:00.0", "0000:3b:00.0", true},
+		{"pci-0000-3B-00-1", "0000:3b:00.1", true},
+		{"vendor.com/gpu=0000:af:00.0", "0000:af:00.0", true},
+		{"gpu-0", "", false},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			got, ok := PCIAddressFromDeviceName(testCase.name)
+			if got != testCase.expected || ok != testCase.ok {
+				t.Errorf("got %q %v, want %q %v", got, ok, testCase.expected, testCase.ok)
+			}
+		})
+	}
+}
+
+func TestListWithDynamicResources(t *testing.T) {
+	sysInfo := sysinfo.SysInfo{
+		CPUs: cpuset.MustParse("0-3"),
+		Resources: map[string]sysinfo.PerNUMADevices{
+			"example.com/gpu": map[int][]string{
+				0: {"0000:3b:00.0"},
+				1: {"0000:af:00.0"},
+			},
+		},
+	}
+	v1Cli := &fakeV1Client{
+		listResp: &podresourcesapi.ListPodResourcesResponse{},
+	}
+	conn := &fakeConn{
+		listResp: &draListPodResourcesResponse{
+			PodResources: []*draPodResources{
+				{
+					Name:      "pod",
+					Namespace: "ns",
+					Containers: []*draContainerResources{
+						{
+							Name:   "cnt",
+							CpuIds: []int64{1},
+							DynamicResources: []*DynamicResource{
+								{
+									ClaimName:      "gpu-claim",
+									ClaimNamespace: "ns",
+									ClaimResources: []*ClaimResource{
+										{DriverName: "gpu.example.com", PoolName: "node", DeviceName: "pci-0000-af-00-0"},
+										{CDIDevices: []*CDIDevice{{Name: "example.com/gpu=gpu-7"}}},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	cc := newCompatClient(v1Cli, &fakeV1alpha1Client{}, conn)
+	cc.EnableDynamicResources(NewSysinfoDynamicResourceResolver(sysInfo))
+
+	resp, err := cc.List(context.TODO(), &podresourcesapi.ListPodResourcesRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &podresourcesapi.ListPodResourcesResponse{
+		PodResources: []*podresourcesapi.PodResources{
+			{
+				Name:      "pod",
+				Namespace: "ns",
+				Containers: []*podresourcesapi.ContainerResources{
+					{
+						Name:   "cnt",
+						CpuIds: []int64{1},
+						Devices: []*podresourcesapi.ContainerDevices{
+							{
+								ResourceName: "example.com/gpu",
+								DeviceIds:    []string{"pci-0000-af-00-0"},
+								Topology: &podresourcesapi.TopologyInfo{
+									Nodes: []*podresourcesapi.NUMANode{
+										{ID: int64(1)},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(resp, expected) {
+		t.Errorf("got %v, want %v", resp, expected)
+	}
+}
+
+func TestDynamicResourcesWireFormat(t *testing.T) {
+	codec := encoding.GetCodec("proto")
+
+	draResp := draListPodResourcesResponse{
+		PodResources: []*draPodResources{
+			{
+				Name:      "pod",
+				Namespace: "ns",
+				Containers: []*draContainerResources{
+					{
+						Name:   "cnt",
+						CpuIds: []int64{2, 3},
+						Devices: []*podresourcesapi.ContainerDevices{
+							{ResourceName: "intel_nics", DeviceIds: []string{"0000:00:02.0"}},
+						},
+						DynamicResources: []*DynamicResource{
+							{
+								ClaimName:      "claim",
+								ClaimNamespace: "ns",
+								ClaimResources: []*ClaimResource{
+									{CDIDevices: []*CDIDevice{{Name: "example.com/gpu=0"}}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	data, err := codec.Marshal(&draResp)
+	if err != nil {
+		t.Fatalf("cannot marshal response: %v", err)
+	}
+
+	// the vendored API must decode the same data, skipping only the DRA fields
+	resp := podresourcesapi.ListPodResourcesResponse{}
+	if err := resp.Unmarshal(data); err != nil {
+		t.Fatalf("cannot unmarshal response: %v", err)
+	}
+	cntRes := resp.GetPodResources()[0].GetContainers()[0]
+	if cntRes.Name != "cnt" || !reflect.DeepEqual(cntRes.CpuIds, []int64{2, 3}) || cntRes.Devices[0].ResourceName != "intel_nics" {
+		t.Errorf("unexpected container resources: %v", cntRes)
+	}
+
+	draBack := draListPodResourcesResponse{}
+	if err := codec.Unmarshal(data, &draBack); err != nil {
+		t.Fatalf("cannot unmarshal response back: %v", err)
+	}
+	got := draBack.PodResources[0].Containers[0].DynamicResources[0]
+	if got.ClaimName != "claim" || got.ClaimResources[0].CDIDevices[0].Name != "example.com/gpu=0" {
+		t.Errorf("unexpected dynamic resources: %v", got)
+	}
+}
@@ -0,0 +1,51 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podrescompat
+
+import (
+	"fmt"
+
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+// The Get endpoint was added to the v1 podresources API in kubernetes 1.27,
+// long after the kubelet API we vendor was cut. We mirror the wire format here,
+// so we can call it on kubelets which support it. The protobuf runtime
+// derives the message layout from the struct tags.
+
+const (
+	methodV1Get = "/v1.PodResourcesLister/Get"
+)
+
+type GetPodResourcesRequest struct {
+	PodName      string `protobuf:"bytes,1,opt,name=pod_name,json=podName,proto3" json:"pod_name,omitempty"`
+	PodNamespace string `protobuf:"bytes,2,opt,name=pod_namespace,json=podNamespace,proto3" json:"pod_namespace,omitempty"`
+}
+
+func (m *GetPodResourcesRequest) Reset() { *m = GetPodResourcesRequest{} }
+func (m *GetPodResourcesRequest) String() string {
+	return fmt.Sprintf("GetPodResourcesRequest{%s/%s}", m.PodNamespace, m.PodName)
+}
+func (*GetPodResourcesRequest) ProtoMessage() {}
+
+type GetPodResourcesResponse struct {
+	PodResources *podresourcesapi.PodResources `protobuf:"bytes,1,opt,name=pod_resources,json=podResources,proto3" json:"pod_resources,omitempty"`
+}
+
+func (m *GetPodResourcesResponse) Reset() { *m = GetPodResourcesResponse{} }
+func (m *GetPodResourcesResponse) String() string {
+	return fmt.Sprintf("GetPodResourcesResponse{%s}", m.PodResources.String())
+}
+func (*GetPodResourcesResponse) ProtoMessage() {}
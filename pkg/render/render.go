@@ -0,0 +1,566 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/openshift-kni/resource-topology-exporter/manifests"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/nrtupdater"
+)
+
+const (
+	ProfileOpenShift = "openshift"
+	ProfileVanilla   = "vanilla"
+)
+
+const (
+	clusterRoleName        = "rte-handler"
+	clusterRoleBindingName = "handle-rte"
+	serviceAccountName     = "rte-account"
+	daemonSetName          = "resource-topology-exporter-ds"
+	configMapName          = "rte-config"
+	metricsServiceName     = "rte-metrics"
+	metricsSecretName      = "rte-metrics-tls"
+
+	exporterContainerName  = "resource-topology-exporter-container"
+	referenceContainerName = "shared-pool-container"
+	proxyContainerName     = "kube-rbac-proxy"
+
+	configDir       = "/etc/resource-topology-exporter"
+	configFileName  = "config.yaml"
+	metricsTLSPort  = 8443
+	metricsCertsDir = "/etc/secrets"
+)
+
+var podLabels = map[string]string{
+	"name": "resource-topology",
+}
+
+type Options struct {
+	// Profile is one of ProfileOpenShift, ProfileVanilla
+	Profile   string
+	Namespace string
+	Image     string
+	// PollInterval is the --sleep-interval of the exporter
+	PollInterval time.Duration
+	Verbosity    int
+	MetricsPort  int
+	// TopologyManagerPolicy and TopologyManagerScope override the kubelet configuration if both set
+	TopologyManagerPolicy string
+	TopologyManagerScope  string
+	// NotifyFile mounts the host notification directory, to trigger the updates from the host
+	NotifyFile bool
+	// ReferenceContainer adds a sidecar running on the shared cpu pool
+	ReferenceContainer      bool
+	ReferenceContainerImage string
+	// Config is the content of the configuration file. If empty, no ConfigMap is rendered
+	// but the exporter still mounts one, if created separately.
+	Config string
+	// MetricsTLS serves the metrics through an authenticating TLS proxy. The exporter still
+	// listens on the plain metrics port, but only on the pod loopback for the proxy.
+	MetricsTLS bool
+	ProxyImage string
+	// NodeCondition maintains the TopologyInfoFresh node condition
+	NodeCondition bool
+	// CRD renders the NodeResourceTopology CRD too
+	CRD bool
+	// CRDPolicy is the exporter --nrt-crd-policy flag. Empty keeps the exporter default.
+	CRDPolicy string
+	// HealthPort serves the health checks, probed by the kubelet, and the debug endpoints like
+	// /debug/placement. 0 disables them.
+	HealthPort int
+	// PlacementNamespaces is the exporter --placement-namespaces flag, comma separated. Empty disables the placement.
+	// The placement is served on HealthPort, so it needs either that or PlacementAnnotate.
+	PlacementNamespaces string
+	// PlacementAnnotate annotates the pods with their placement, which needs PlacementNamespaces
+	PlacementAnnotate bool
+}
+
+// DefaultOptions are the ones of the CI deployment on the profile
+func DefaultOptions(profile string) Options {
+	opts := Options{
+		Profile:                 profile,
+		Namespace:               "resource-topology-exporter",
+		Image:                   "quay.io/openshift-kni/resource-topology-exporter:4.9-snapshot",
+		PollInterval:            10 * time.Second,
+		Verbosity:               2,
+		MetricsPort:             2112,
+		NotifyFile:              true,
+		ReferenceContainer:      true,
+		ReferenceContainerImage: "gcr.io/google_containers/pause-amd64:3.0",
+		ProxyImage:              "quay.io/brancz/kube-rbac-proxy:v0.11.0",
+		CRD:                     true,
+	}
+	if profile == ProfileOpenShift {
+		opts.ProxyImage = "quay.io/openshift/origin-kube-rbac-proxy:4.9"
+	}
+	return opts
+}
+
+// Validate checks the options are consistent before rendering
+func (opts Options) Validate() error {
+	switch opts.Profile {
+	case ProfileOpenShift, ProfileVanilla:
+	default:
+		return fmt.Errorf("unsupported profile: %q", opts.Profile)
+	}
+	if opts.Namespace == "" {
+		return fmt.Errorf("missing namespace")
+	}
+	if opts.Image == "" {
+		return fmt.Errorf("missing image")
+	}
+	if (opts.TopologyManagerPolicy == "") != (opts.TopologyManagerScope == "") {
+		return fmt.Errorf("the topology manager policy and scope must be set together")
+	}
+	if opts.MetricsPort <= 0 || opts.MetricsPort == metricsTLSPort {
+		return fmt.Errorf("invalid metrics port: %d", opts.MetricsPort)
+	}
+	if opts.HealthPort < 0 || (opts.HealthPort > 0 && (opts.HealthPort == opts.MetricsPort || opts.HealthPort == metricsTLSPort)) {
+		return fmt.Errorf("invalid health port: %d", opts.HealthPort)
+	}
+	switch opts.CRDPolicy {
+	case "", nrtupdater.CRDPolicyIgnore, nrtupdater.CRDPolicyWait, nrtupdater.CRDPolicyInstall:
+	default:
+		return fmt.Errorf("unsupported CRD policy: %q", opts.CRDPolicy)
+	}
+	if opts.PlacementAnnotate && opts.PlacementNamespaces == "" {
+		return fmt.Errorf("the placement annotation needs the placement namespaces")
+	}
+	if opts.PlacementNamespaces != "" && !opts.PlacementAnnotate && opts.HealthPort == 0 {
+		return fmt.Errorf("the placement is exported only on the health port or as pod annotations")
+	}
+	return nil
+}
+
+// Manifests are the objects to deploy the exporter. The optional ones are nil if not enabled.
+type Manifests struct {
+	CRD                []byte
+	ClusterRole        *rbacv1.ClusterRole
+	ClusterRoleBinding *rbacv1.ClusterRoleBinding
+	ServiceAccount     *corev1.ServiceAccount
+	ConfigMap          *corev1.ConfigMap
+	MetricsService     *corev1.Service
+	DaemonSet          *appsv1.DaemonSet
+}
+
+// Render builds the manifests from the options
+func Render(opts Options) (Manifests, error) {
+	if err := opts.Validate(); err != nil {
+		return Manifests{}, err
+	}
+	mf := Manifests{
+		ClusterRole:        newClusterRole(opts),
+		ClusterRoleBinding: newClusterRoleBinding(opts),
+		ServiceAccount:     newServiceAccount(opts),
+		DaemonSet:          newDaemonSet(opts),
+	}
+	if opts.CRD {
+		mf.CRD = manifests.CRD
+	}
+	if opts.Config != "" {
+		mf.ConfigMap = newConfigMap(opts)
+	}
+	if opts.MetricsTLS {
+		mf.MetricsService = newMetricsService(opts)
+	}
+	return mf, nil
+}
+
+func newClusterRole(opts Options) *rbacv1.ClusterRole {
+	cr := &rbacv1.ClusterRole{
+		TypeMeta: metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: clusterRoleName,
+		},
+		Rules: []rbacv1.PolicyRule{
+			{
+				APIGroups: []string{nrtupdater.TopologyGroup},
+				Resources: []string{"noderesourcetopologies"},
+				Verbs:     []string{"create", "update", "patch", "delete", "get", "list", "watch"},
+			},
+			{
+				APIGroups: []string{""},
+				Resources: []string{"nodes"},
+				Verbs:     []string{"get", "list"},
+			},
+			{
+				APIGroups: []string{""},
+				Resources: []string{"pods"},
+				Verbs:     []string{"get", "list", "watch"},
+			},
+			{
+				APIGroups: []string{""},
+				Resources: []string{"pods/status"},
+				Verbs:     []string{"update"},
+			},
+			{
+				APIGroups: []string{""},
+				Resources: []string{"events"},
+				Verbs:     []string{"create", "patch", "update"},
+			},
+		},
+	}
+	if opts.CRDPolicy == nrtupdater.CRDPolicyInstall {
+		// the exporter creates the embedded CRD if not served
+		cr.Rules = append(cr.Rules, rbacv1.PolicyRule{
+			APIGroups: []string{"apiextensions.k8s.io"},
+			Resources: []string{"customresourcedefinitions"},
+			Verbs:     []string{"get", "create"},
+		})
+	}
+	if opts.PlacementAnnotate {
+		cr.Rules = append(cr.Rules, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"pods"},
+			Verbs:     []string{"patch"},
+		})
+	}
+	if opts.NodeCondition {
+		cr.Rules = append(cr.Rules, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"nodes/status"},
+			Verbs:     []string{"patch"},
+		})
+	}
+	if opts.MetricsTLS {
+		// the proxy authenticates and authorizes the scrapers
+		cr.Rules = append(cr.Rules,
+			rbacv1.PolicyRule{
+				APIGroups: []string{"authentication.k8s.io"},
+				Resources: []string{"tokenreviews"},
+				Verbs:     []string{"create"},
+			},
+			rbacv1.PolicyRule{
+				APIGroups: []string{"authorization.k8s.io"},
+				Resources: []string{"subjectaccessreviews"},
+				Verbs:     []string{"create"},
+			},
+		)
+	}
+	if opts.Profile == ProfileOpenShift {
+		// the host mounts need the privileged SCC
+		cr.Rules = append(cr.Rules, rbacv1.PolicyRule{
+			APIGroups:     []string{"security.openshift.io"},
+			Resources:     []string{"securitycontextconstraints"},
+			ResourceNames: []string{"privileged"},
+			Verbs:         []string{"use"},
+		})
+	}
+	return cr
+}
+
+func newClusterRoleBinding(opts Options) *rbacv1.ClusterRoleBinding {
+	return &rbacv1.ClusterRoleBinding{
+		TypeMeta: metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRoleBinding"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: clusterRoleBindingName,
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				Kind:      "ServiceAccount",
+				Name:      serviceAccountName,
+				Namespace: opts.Namespace,
+			},
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     "ClusterRole",
+			Name:     clusterRoleName,
+		},
+	}
+}
+
+func newServiceAccount(opts Options) *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      serviceAccountName,
+			Namespace: opts.Namespace,
+		},
+	}
+}
+
+func newConfigMap(opts Options) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      configMapName,
+			Namespace: opts.Namespace,
+		},
+		Data: map[string]string{
+			configFileName: opts.Config,
+		},
+	}
+}
+
+// newMetricsService also gets the proxy certificate from the service CA on OpenShift
+func newMetricsService(opts Options) *corev1.Service {
+	svc := &corev1.Service{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      metricsServiceName,
+			Namespace: opts.Namespace,
+			Labels:    podLabels,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: podLabels,
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "https",
+					Port:       metricsTLSPort,
+					TargetPort: intstr.FromString("https"),
+				},
+			},
+		},
+	}
+	if opts.Profile == ProfileOpenShift {
+		svc.Annotations = map[string]string{
+			"service.beta.openshift.io/serving-cert-secret-name": metricsSecretName,
+		}
+	}
+	return svc
+}
+
+func newDaemonSet(opts Options) *appsv1.DaemonSet {
+	ds := &appsv1.DaemonSet{
+		TypeMeta: metav1.TypeMeta{APIVersion: "apps/v1", Kind: "DaemonSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      daemonSetName,
+			Namespace: opts.Namespace,
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: podLabels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: podLabels,
+				},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: serviceAccountName,
+					Containers:         []corev1.Container{newExporterContainer(opts)},
+					Volumes: []corev1.Volume{
+						hostPathVolume("host-sys", "/sys"),
+						hostPathVolume("host-kubelet-state", "/var/lib/kubelet"),
+						{
+							Name: "rte-config",
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{Name: configMapName},
+									Optional:             newTrue(),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	podSpec := &ds.Spec.Template.Spec
+	if opts.NotifyFile {
+		podSpec.Volumes = append(podSpec.Volumes, hostPathVolume("host-rte-notification", "/run/rte"))
+	}
+	if opts.ReferenceContainer {
+		podSpec.Containers = append(podSpec.Containers, corev1.Container{
+			Name:  referenceContainerName,
+			Image: opts.ReferenceContainerImage,
+		})
+	}
+	if opts.MetricsTLS {
+		podSpec.Containers = append(podSpec.Containers, newProxyContainer(opts))
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: metricsSecretName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: metricsSecretName,
+				},
+			},
+		})
+	}
+	return ds
+}
+
+func newExporterContainer(opts Options) corev1.Container {
+	cnt := corev1.Container{
+		Name:  exporterContainerName,
+		Image: opts.Image,
+		Command: []string{
+			"/bin/resource-topology-exporter",
+			fmt.Sprintf("-v=%d", opts.Verbosity),
+			fmt.Sprintf("--sleep-interval=%v", opts.PollInterval),
+			"--sysfs=/host-sys",
+			"--kubelet-state-dir=/host-var/lib/kubelet",
+			"--podresources-socket=unix:///host-var/lib/kubelet/pod-resources/kubelet.sock",
+			fmt.Sprintf("--config=%s/%s", configDir, configFileName),
+		},
+		Env: []corev1.EnvVar{
+			fieldRefEnv("NODE_NAME", "spec.nodeName"),
+			{
+				Name:  "METRICS_PORT",
+				Value: fmt.Sprintf("%d", opts.MetricsPort),
+			},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "host-sys",
+				MountPath: "/host-sys",
+				ReadOnly:  true,
+			},
+			{
+				Name:      "host-kubelet-state",
+				MountPath: "/host-var/lib/kubelet",
+			},
+			{
+				Name:      "rte-config",
+				MountPath: configDir,
+			},
+		},
+		SecurityContext: &corev1.SecurityContext{
+			Privileged: newTrue(),
+		},
+	}
+	if opts.TopologyManagerPolicy != "" {
+		cnt.Command = append(cnt.Command,
+			fmt.Sprintf("--topology-manager-policy=%s", opts.TopologyManagerPolicy),
+			fmt.Sprintf("--topology-manager-scope=%s", opts.TopologyManagerScope),
+		)
+	}
+	if opts.NotifyFile {
+		cnt.Command = append(cnt.Command, "--notify-file=/host-run/rte/notify")
+		cnt.VolumeMounts = append(cnt.VolumeMounts, corev1.VolumeMount{
+			Name:      "host-rte-notification",
+			MountPath: "/host-run/rte",
+		})
+	}
+	if opts.NodeCondition {
+		cnt.Command = append(cnt.Command, "--node-condition")
+	}
+	if opts.CRDPolicy != "" {
+		cnt.Command = append(cnt.Command, fmt.Sprintf("--nrt-crd-policy=%s", opts.CRDPolicy))
+	}
+	if opts.PlacementNamespaces != "" {
+		cnt.Command = append(cnt.Command, fmt.Sprintf("--placement-namespaces=%s", opts.PlacementNamespaces))
+	}
+	if opts.PlacementAnnotate {
+		cnt.Command = append(cnt.Command, "--placement-annotate")
+	}
+	if opts.ReferenceContainer {
+		cnt.Env = append(cnt.Env,
+			fieldRefEnv("REFERENCE_NAMESPACE", "metadata.namespace"),
+			fieldRefEnv("REFERENCE_POD_NAME", "metadata.name"),
+			corev1.EnvVar{
+				Name:  "REFERENCE_CONTAINER_NAME",
+				Value: referenceContainerName,
+			},
+		)
+	}
+	if opts.MetricsTLS {
+		// only the proxy, in the same pod, reaches the plain metrics
+		cnt.Env = append(cnt.Env, corev1.EnvVar{
+			Name:  "METRICS_HOST",
+			Value: "127.0.0.1",
+		})
+	} else {
+		cnt.Ports = []corev1.ContainerPort{
+			{
+				Name:          "metrics-port",
+				ContainerPort: int32(opts.MetricsPort),
+			},
+		}
+	}
+	if opts.HealthPort > 0 {
+		cnt.Command = append(cnt.Command, fmt.Sprintf("--health-address=:%d", opts.HealthPort))
+		cnt.Ports = append(cnt.Ports, corev1.ContainerPort{
+			Name:          "health-port",
+			ContainerPort: int32(opts.HealthPort),
+		})
+		cnt.LivenessProbe = newHealthProbe("/healthz")
+		cnt.ReadinessProbe = newHealthProbe("/readyz")
+	}
+	return cnt
+}
+
+func newHealthProbe(path string) *corev1.Probe {
+	return &corev1.Probe{
+		Handler: corev1.Handler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path: path,
+				Port: intstr.FromString("health-port"),
+			},
+		},
+	}
+}
+
+func newProxyContainer(opts Options) corev1.Container {
+	return corev1.Container{
+		Name:  proxyContainerName,
+		Image: opts.ProxyImage,
+		Args: []string{
+			fmt.Sprintf("--secure-listen-address=0.0.0.0:%d", metricsTLSPort),
+			fmt.Sprintf("--upstream=http://127.0.0.1:%d/", opts.MetricsPort),
+			fmt.Sprintf("--tls-cert-file=%s/tls.crt", metricsCertsDir),
+			fmt.Sprintf("--tls-private-key-file=%s/tls.key", metricsCertsDir),
+		},
+		Ports: []corev1.ContainerPort{
+			{
+				Name:          "https",
+				ContainerPort: metricsTLSPort,
+			},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      metricsSecretName,
+				MountPath: metricsCertsDir,
+				ReadOnly:  true,
+			},
+		},
+	}
+}
+
+func hostPathVolume(name, path string) corev1.Volume {
+	return corev1.Volume{
+		Name: name,
+		VolumeSource: corev1.VolumeSource{
+			HostPath: &corev1.HostPathVolumeSource{
+				Path: path,
+			},
+		},
+	}
+}
+
+func fieldRefEnv(name, fieldPath string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			FieldRef: &corev1.ObjectFieldSelector{
+				FieldPath: fieldPath,
+			},
+		},
+	}
+}
+
+func newTrue() *bool {
+	val := true
+	return &val
+}
@@ -0,0 +1,152 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestRenderGolden(t *testing.T) {
+	allOpts := DefaultOptions(ProfileVanilla)
+	allOpts.Namespace = "rte"
+	allOpts.Image = "quay.io/example/rte:latest"
+	allOpts.PollInterval = 30 * time.Second
+	allOpts.Verbosity = 5
+	allOpts.TopologyManagerPolicy = "single-numa-node"
+	allOpts.TopologyManagerScope = "container"
+	allOpts.NotifyFile = false
+	allOpts.ReferenceContainer = false
+	allOpts.Config = "resources:\n  reservedcpus: \"0\"\n"
+	allOpts.MetricsTLS = true
+	allOpts.NodeCondition = true
+	allOpts.CRD = false
+	allOpts.CRDPolicy = "install"
+	allOpts.HealthPort = 8081
+	allOpts.PlacementNamespaces = "*"
+	allOpts.PlacementAnnotate = true
+
+	testCases := []struct {
+		name string
+		opts Options
+	}{
+		{
+			name: "openshift-default",
+			opts: DefaultOptions(ProfileOpenShift),
+		},
+		{
+			name: "vanilla-default",
+			opts: DefaultOptions(ProfileVanilla),
+		},
+		{
+			name: "vanilla-all-options",
+			opts: allOpts,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mf, err := Render(tc.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var buf bytes.Buffer
+			if err := mf.WriteYAML(&buf); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			goldenPath := filepath.Join("..", "..", "test", "data", "render", tc.name+".yaml")
+			if *update {
+				if err := ioutil.WriteFile(goldenPath, buf.Bytes(), 0644); err != nil {
+					t.Fatalf("failed to update golden file: %v", err)
+				}
+			}
+			expected, err := ioutil.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("failed to read golden file: %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), expected) {
+				t.Errorf("rendered manifests differ from %s, rerun with -update and review the diff", goldenPath)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		mutate   func(opts *Options)
+		expected bool
+	}{
+		{
+			name:     "defaults",
+			mutate:   func(opts *Options) {},
+			expected: true,
+		},
+		{
+			name:   "unknown profile",
+			mutate: func(opts *Options) { opts.Profile = "foo" },
+		},
+		{
+			name:   "missing namespace",
+			mutate: func(opts *Options) { opts.Namespace = "" },
+		},
+		{
+			name:   "missing image",
+			mutate: func(opts *Options) { opts.Image = "" },
+		},
+		{
+			name:   "policy without scope",
+			mutate: func(opts *Options) { opts.TopologyManagerPolicy = "single-numa-node" },
+		},
+		{
+			name:   "metrics port clashing with the proxy",
+			mutate: func(opts *Options) { opts.MetricsPort = metricsTLSPort },
+		},
+		{
+			name:   "unknown CRD policy",
+			mutate: func(opts *Options) { opts.CRDPolicy = "create" },
+		},
+		{
+			name:   "placement annotation without namespaces",
+			mutate: func(opts *Options) { opts.PlacementAnnotate = true },
+		},
+		{
+			name:   "placement not exported",
+			mutate: func(opts *Options) { opts.PlacementNamespaces = "*" },
+		},
+		{
+			name:   "health port clashing with the metrics",
+			mutate: func(opts *Options) { opts.HealthPort = opts.MetricsPort },
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := DefaultOptions(ProfileVanilla)
+			tc.mutate(&opts)
+			err := opts.Validate()
+			if got := err == nil; got != tc.expected {
+				t.Errorf("valid=%v expected=%v err=%v", got, tc.expected, err)
+			}
+		})
+	}
+}
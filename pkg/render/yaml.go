@@ -0,0 +1,98 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Objects returns the rendered objects in creation order, the CRD excluded
+func (mf Manifests) Objects() []interface{} {
+	objs := []interface{}{mf.ClusterRole, mf.ClusterRoleBinding, mf.ServiceAccount}
+	if mf.ConfigMap != nil {
+		objs = append(objs, mf.ConfigMap)
+	}
+	if mf.MetricsService != nil {
+		objs = append(objs, mf.MetricsService)
+	}
+	return append(objs, mf.DaemonSet)
+}
+
+// WriteYAML writes a multi document YAML, ready for kubectl apply
+func (mf Manifests) WriteYAML(w io.Writer) error {
+	docs := [][]byte{}
+	if len(mf.CRD) > 0 {
+		docs = append(docs, mf.CRD)
+	}
+	for _, obj := range mf.Objects() {
+		data, err := marshalObject(obj)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, data)
+	}
+	for idx, doc := range docs {
+		if idx > 0 {
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(bytes.TrimPrefix(doc, []byte("---\n"))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// marshalObject drops the empty fields and the status the typed objects always serialize
+func marshalObject(obj interface{}) ([]byte, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	delete(doc, "status")
+	return yaml.Marshal(pruneEmpty(doc))
+}
+
+func pruneEmpty(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for key, item := range val {
+			item = pruneEmpty(item)
+			if item == nil {
+				delete(val, key)
+				continue
+			}
+			if obj, ok := item.(map[string]interface{}); ok && len(obj) == 0 {
+				delete(val, key)
+				continue
+			}
+			val[key] = item
+		}
+	case []interface{}:
+		for idx, item := range val {
+			val[idx] = pruneEmpty(item)
+		}
+	}
+	return v
+}
@@ -0,0 +1,94 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resourcetopologyexporter
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/fsnotify/fsnotify"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/resourcemonitor"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/config"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/events"
+)
+
+// configMapDataLink is the symlink the kubelet swaps to update the files of a ConfigMap volume
+const configMapDataLink = "..data"
+
+// configReloader re-reads the configuration file when it changes. Only the exclude list is
+// applied at runtime: the other settings are consumed at startup.
+type configReloader struct {
+	path   string
+	dir    string
+	resObs *ResourceObserver
+	rec    *events.Recorder
+}
+
+// newConfigReloader watches the directory of the configuration file, because the ConfigMap
+// volumes replace the files by swapping a symlink. Returns nil if there is nothing to watch.
+func newConfigReloader(watcher *fsnotify.Watcher, path string, resObs *ResourceObserver, rec *events.Recorder) (*configReloader, error) {
+	if path == "" {
+		return nil, nil
+	}
+	dir := filepath.Dir(path)
+	if err := watcher.Add(dir); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			klog.V(2).Infof("configuration directory %q not found, not watching it", dir)
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &configReloader{
+		path:   path,
+		dir:    dir,
+		resObs: resObs,
+		rec:    rec,
+	}, nil
+}
+
+// Matches tells if the event is about the configuration file, written in place or swapped by
+// a ConfigMap update through the ..data symlink. The other files of the directory are not claimed.
+func (cr *configReloader) Matches(event fsnotify.Event) bool {
+	if cr == nil {
+		return false
+	}
+	name := filepath.Clean(event.Name)
+	return name == filepath.Clean(cr.path) || name == filepath.Join(cr.dir, configMapDataLink)
+}
+
+// Reload applies the exclude list from the configuration file and tells if it changed
+func (cr *configReloader) Reload() bool {
+	conf, err := config.ReadConfig(cr.path)
+	if err != nil {
+		// keep the current settings, the file may be rewritten just now
+		klog.Warningf("cannot reload the configuration from %q: %v", cr.path, err)
+		return false
+	}
+	excludeList := resourcemonitor.ResourceExcludeList{ExcludeList: conf.ExcludeList}
+	if reflect.DeepEqual(excludeList, cr.resObs.ExcludeList()) {
+		return false
+	}
+	cr.resObs.SetExcludeList(excludeList)
+	klog.Infof("reloaded the exclude list from %q:\n%s", cr.path, excludeList.String())
+	cr.rec.Exporterf(corev1.EventTypeNormal, events.ReasonConfigReloaded, "reloaded the exclude list from %s", cr.path)
+	return true
+}
@@ -0,0 +1,424 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resourcetopologyexporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/notification"
+	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/podreadiness"
+	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/podrescli"
+	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/prometheus"
+	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/resourcemonitor"
+	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/topologypolicy"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/events"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/freshness"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/health"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/nrtupdater"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/podfingerprint"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/sinks"
+)
+
+type Args struct {
+	Debug                  bool
+	ReferenceContainer     *podrescli.ContainerIdent
+	TopologyManagerPolicy  string
+	TopologyManagerScope   string
+	KubeletConfigFile      string
+	KubeletStateDirs       []string
+	PodResourcesSocketPath string
+	SleepInterval          time.Duration
+	PodReadinessEnable     bool
+	NotifyFilePath         string
+	// ConfigFile is watched to reload the exclude list
+	ConfigFile string
+	// ShutdownTimeout bounds the wait for the update in flight and the shutdown action
+	ShutdownTimeout time.Duration
+}
+
+var (
+	ErrScan    = errors.New("scan failed")
+	ErrPublish = errors.New("publish failed")
+)
+
+// Observers follow the update loop. Each one is optional, nil disables it.
+type Observers struct {
+	Events    *events.Recorder
+	Freshness *freshness.Reporter
+	Health    *health.Tracker
+	// Conditions is the pod readiness channel the caller already serves, and shares with the podresources
+	// clients. If nil and the pod readiness is enabled, Execute serves its own.
+	Conditions chan v1.PodCondition
+}
+
+func (obs Observers) observeCRDNotServed(err error) {
+	if obs.Freshness != nil {
+		obs.Freshness.ObserveCRDNotServed(err)
+	}
+}
+
+type PollTrigger struct {
+	Timer     bool
+	Timestamp time.Time
+}
+
+// kubeletConfig holds the subset of the KubeletConfiguration we need. The vendored
+// kubelet types predate the topology manager policy options.
+type kubeletConfig struct {
+	TopologyManagerPolicy        string            `json:"topologyManagerPolicy,omitempty"`
+	TopologyManagerScope         string            `json:"topologyManagerScope,omitempty"`
+	TopologyManagerPolicyOptions map[string]string `json:"topologyManagerPolicyOptions,omitempty"`
+	CPUManagerPolicy             string            `json:"cpuManagerPolicy,omitempty"`
+	CPUManagerPolicyOptions      map[string]string `json:"cpuManagerPolicyOptions,omitempty"`
+}
+
+// Execute runs until the context is done, then it applies the shutdown action
+func Execute(ctx context.Context, cli podresourcesapi.PodResourcesListerClient, nrtupdaterArgs nrtupdater.Args, resourcemonitorArgs resourcemonitor.Args, rteArgs Args, sinksArgs sinks.Args, obs Observers) error {
+	topoInfo, err := GetTopologyInfo(rteArgs)
+	if err != nil {
+		return err
+	}
+	tmPolicy := topologypolicy.DetectTopologyPolicy(topoInfo.TopologyManagerPolicy, topoInfo.TopologyManagerScope)
+	if nrtupdaterArgs.APIVersion != nrtupdater.APIVersionV1alpha1 {
+		topoInfo.ZoneAttributes, err = GetZoneAttributes(resourcemonitorArgs.SysfsRoot)
+		if err != nil {
+			klog.Warningf("cannot read the NUMA topology, the zone attributes will be missing: %v", err)
+		}
+	}
+
+	resObs, err := NewResourceObserver(cli, resourcemonitorArgs)
+	if err != nil {
+		return err
+	}
+	resObs.health = obs.Health
+
+	// the update in flight at shutdown can complete within the timeout
+	updCtx, cancelUpd := DrainContext(ctx, rteArgs.ShutdownTimeout)
+	defer cancelUpd()
+
+	if err := nrtupdater.EnsureCRD(ctx, nrtupdaterArgs, obs.observeCRDNotServed); err != nil {
+		if ctx.Err() != nil {
+			klog.Infof("terminated while waiting for the NodeResourceTopology CRD")
+			return nil
+		}
+		return fmt.Errorf("failed to ensure the NodeResourceTopology CRD: %w", err)
+	}
+
+	upd, err := nrtupdater.NewNRTUpdater(updCtx, nrtupdaterArgs, string(tmPolicy), topoInfo)
+	if err != nil {
+		return fmt.Errorf("failed to initialize NRT updater: %w", err)
+	}
+	sink, sinkErrs, err := sinks.New(ctx, sinksArgs, upd, cli)
+	if err != nil {
+		return fmt.Errorf("failed to initialize the sinks: %w", err)
+	}
+	klog.Infof("sinks: %s", sink.Name())
+	sink = sinks.WithHealth(sinks.WithCondition(sinks.WithEvents(sink, obs.Events), obs.Freshness), obs.Health)
+
+	if nrtupdaterArgs.Oneshot {
+		// no shutdown action: the published data must outlive the process
+		return RunOnce(resObs, sink)
+	}
+
+	condChan := obs.Conditions
+	if condChan == nil && rteArgs.PodReadinessEnable {
+		condChan = make(chan v1.PodCondition)
+		condIn, err := podreadiness.NewConditionInjector()
+		if err != nil {
+			return err
+		}
+		condIn.Run(condChan)
+	}
+
+	upd.RunRepair(ctx.Done())
+
+	if err := run(ctx, rteArgs, resObs, sink, sinkErrs, condChan, obs); err != nil {
+		return err
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), rteArgs.ShutdownTimeout)
+	defer cancel()
+	return upd.Shutdown(shutdownCtx)
+}
+
+// run triggers the scans until the context is done, then waits for the update in flight up to the shutdown timeout.
+// A failure reported on sinkErrs ends it.
+func run(ctx context.Context, rteArgs Args, resObs *ResourceObserver, sink sinks.Sink, sinkErrs <-chan error, condChan chan v1.PodCondition, obs Observers) error {
+	eventsChan := make(chan PollTrigger)
+	infoChannel := resObs.Run(ctx, eventsChan, condChan)
+	sinkDone := sinks.Run(ctx, sink, infoChannel, condChan)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create the watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	filterFile, err := notification.AddFile(watcher, rteArgs.NotifyFilePath)
+	if err != nil {
+		return err
+	}
+
+	filterDirs, err := notification.AddDirs(watcher, rteArgs.KubeletStateDirs)
+	if err != nil {
+		return err
+	}
+
+	filterEvent := notification.MakeFilter(filterFile, filterDirs)
+
+	reloader, err := newConfigReloader(watcher, rteArgs.ConfigFile, resObs, obs.Events)
+	if err != nil {
+		return err
+	}
+
+	// the observer stops with the context, so the triggers must not block
+	trigger := func(pt PollTrigger) {
+		select {
+		case eventsChan <- pt:
+			obs.Health.ObserveTrigger()
+		case <-ctx.Done():
+		}
+	}
+
+	trigger(PollTrigger{Timestamp: time.Now()})
+	klog.V(2).Infof("initial update trigger")
+
+	ticker := time.NewTicker(rteArgs.SleepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case tickTs := <-ticker.C:
+			trigger(PollTrigger{Timer: true, Timestamp: tickTs})
+			klog.V(4).Infof("timer update trigger")
+
+		case event := <-watcher.Events:
+			klog.V(5).Infof("fsnotify event from %q: %v", event.Name, event.Op)
+			if reloader.Matches(event) {
+				if reloader.Reload() {
+					trigger(PollTrigger{Timestamp: time.Now()})
+					klog.V(4).Infof("configuration update trigger")
+				}
+				continue
+			}
+			if filterEvent(event) {
+				trigger(PollTrigger{Timestamp: time.Now()})
+				klog.V(4).Infof("fsnotify update trigger")
+			}
+
+		case err := <-watcher.Errors:
+			// and yes, keep going
+			klog.Warningf("fsnotify error: %v", err)
+
+		case err := <-sinkErrs:
+			return err
+
+		case <-ctx.Done():
+			klog.Infof("shutting down, waiting for the update in flight")
+			select {
+			case <-sinkDone:
+			case <-time.After(rteArgs.ShutdownTimeout):
+				klog.Warningf("the update in flight did not complete within %v", rteArgs.ShutdownTimeout)
+			}
+			return nil
+		}
+	}
+}
+
+// DrainContext is done only after the timeout expires past the parent being done, or on cancel
+func DrainContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-parent.Done():
+		case <-ctx.Done():
+			return
+		}
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// GetTopologyInfo prefers the given topology manager policy and scope over the kubelet configuration,
+// which is also the only source for the policy options and the cpu manager policy.
+func GetTopologyInfo(rteArgs Args) (nrtupdater.TopologyInfo, error) {
+	topoInfo := nrtupdater.TopologyInfo{
+		TopologyManagerPolicy: rteArgs.TopologyManagerPolicy,
+		TopologyManagerScope:  rteArgs.TopologyManagerScope,
+	}
+	haveTMConfig := topoInfo.TopologyManagerPolicy != "" && topoInfo.TopologyManagerScope != ""
+	if haveTMConfig {
+		klog.Infof("using given Topology Manager policy %q scope %q", topoInfo.TopologyManagerPolicy, topoInfo.TopologyManagerScope)
+	}
+	if rteArgs.KubeletConfigFile == "" {
+		if !haveTMConfig {
+			return topoInfo, fmt.Errorf("cannot find the kubelet Topology Manager policy")
+		}
+		return topoInfo, nil
+	}
+
+	klConfig, err := readKubeletConfig(rteArgs.KubeletConfigFile)
+	if err != nil {
+		if !haveTMConfig {
+			return topoInfo, fmt.Errorf("error getting topology Manager Policy: %w", err)
+		}
+		klog.V(2).Infof("cannot read the kubelet configuration, the resource managers attributes will be incomplete: %v", err)
+		return topoInfo, nil
+	}
+	if !haveTMConfig {
+		klog.Infof("detected kubelet Topology Manager policy %q scope %q", klConfig.TopologyManagerPolicy, klConfig.TopologyManagerScope)
+		topoInfo.TopologyManagerPolicy = klConfig.TopologyManagerPolicy
+		topoInfo.TopologyManagerScope = klConfig.TopologyManagerScope
+	}
+	topoInfo.TopologyManagerPolicyOptions = klConfig.TopologyManagerPolicyOptions
+	topoInfo.CPUManagerPolicy = klConfig.CPUManagerPolicy
+	topoInfo.CPUManagerPolicyOptions = klConfig.CPUManagerPolicyOptions
+	return topoInfo, nil
+}
+
+func readKubeletConfig(kubeletConfigPath string) (*kubeletConfig, error) {
+	kubeletBytes, err := ioutil.ReadFile(kubeletConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	klConfig := &kubeletConfig{}
+	if err := yaml.Unmarshal(kubeletBytes, klConfig); err != nil {
+		return nil, err
+	}
+	return klConfig, nil
+}
+
+type ResourceObserver struct {
+	resMon resourcemonitor.ResourceMonitor
+	fpCli  *podfingerprint.TrackingClient
+	health *health.Tracker
+
+	lock        sync.Mutex
+	excludeList resourcemonitor.ResourceExcludeList
+}
+
+func NewResourceObserver(cli podresourcesapi.PodResourcesListerClient, args resourcemonitor.Args) (*ResourceObserver, error) {
+	// the scan lists the pods once, so the fingerprint matches the scanned allocations
+	fpCli := podfingerprint.NewTrackingClient(cli)
+	resMon, err := resourcemonitor.NewResourceMonitor(fpCli, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize ResourceMonitor: %w", err)
+	}
+
+	return &ResourceObserver{
+		resMon:      resMon,
+		excludeList: args.ExcludeList,
+		fpCli:       fpCli,
+	}, nil
+}
+
+func (rm *ResourceObserver) ExcludeList() resourcemonitor.ResourceExcludeList {
+	rm.lock.Lock()
+	defer rm.lock.Unlock()
+	return rm.excludeList
+}
+
+// SetExcludeList is used starting from the next scan
+func (rm *ResourceObserver) SetExcludeList(excludeList resourcemonitor.ResourceExcludeList) {
+	rm.lock.Lock()
+	defer rm.lock.Unlock()
+	rm.excludeList = excludeList
+}
+
+// Scan computes the zones and the fingerprint of the pods they account for
+func (rm *ResourceObserver) Scan(timer bool) (nrtupdater.MonitorInfo, error) {
+	var err error
+	monInfo := nrtupdater.MonitorInfo{Timer: timer}
+	monInfo.Zones, err = rm.resMon.Scan(rm.ExcludeList())
+	monInfo.PodFingerprint = rm.fpCli.Last()
+	rm.health.ObserveScan(err)
+	return monInfo, err
+}
+
+// RunOnce scans and updates the sink once. The returned error wraps ErrScan or ErrPublish.
+func RunOnce(resObs *ResourceObserver, sink sinks.Sink) error {
+	monInfo, err := resObs.Scan(false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrScan, err)
+	}
+	if err := sink.Update(monInfo); err != nil {
+		return fmt.Errorf("%w: %v", ErrPublish, err)
+	}
+	klog.Infof("updated %s once", sink.Name())
+	return nil
+}
+
+// Run scans on every trigger until the context is done
+func (rm *ResourceObserver) Run(ctx context.Context, eventsChan <-chan PollTrigger, condChan chan<- v1.PodCondition) <-chan nrtupdater.MonitorInfo {
+	infoChannel := make(chan nrtupdater.MonitorInfo)
+	var condStatus v1.ConditionStatus
+	go func() {
+		lastWakeup := time.Now()
+		for {
+			select {
+			case pt := <-eventsChan:
+				var err error
+				monInfo := nrtupdater.MonitorInfo{Timer: pt.Timer}
+
+				tsWakeupDiff := pt.Timestamp.Sub(lastWakeup)
+				lastWakeup = pt.Timestamp
+				prometheus.UpdateWakeupDelayMetric(monInfo.UpdateReason(), float64(tsWakeupDiff.Milliseconds()))
+
+				tsBegin := time.Now()
+				monInfo, err = rm.Scan(pt.Timer)
+				tsEnd := time.Now()
+
+				if err != nil {
+					klog.Warningf("failed to scan pod resources: %v", err)
+					condStatus = v1.ConditionFalse
+					continue
+				}
+				condStatus = v1.ConditionTrue
+				select {
+				case infoChannel <- monInfo:
+				case <-ctx.Done():
+					klog.Infof("read stop at %v", time.Now())
+					return
+				}
+
+				tsDiff := tsEnd.Sub(tsBegin)
+				prometheus.UpdateOperationDelayMetric("podresources_scan", monInfo.UpdateReason(), float64(tsDiff.Milliseconds()))
+				podreadiness.SetCondition(condChan, podreadiness.PodresourcesFetched, condStatus)
+			case <-ctx.Done():
+				klog.Infof("read stop at %v", time.Now())
+				return
+			}
+		}
+	}()
+	return infoChannel
+}
@@ -0,0 +1,352 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resourcetopologyexporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/jaypipes/ghw/pkg/cpu"
+	"github.com/jaypipes/ghw/pkg/topology"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/k8stopologyawareschedwg/noderesourcetopology-api/pkg/apis/topology/v1alpha1"
+	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/resourcemonitor"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/events"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/nrtupdater"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/podfingerprint"
+)
+
+const kubeletConfigData = `apiVersion: kubelet.config.k8s.io/v1beta1
+kind: KubeletConfiguration
+cpuManagerPolicy: static
+cpuManagerPolicyOptions:
+  full-pcpus-only: "true"
+topologyManagerPolicy: single-numa-node
+topologyManagerScope: pod
+topologyManagerPolicyOptions:
+  prefer-closest-numa-nodes: "true"
+`
+
+func TestGetTopologyInfo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(kubeletConfigData), 0644); err != nil {
+		t.Fatalf("cannot write the kubelet config: %v", err)
+	}
+
+	got, err := GetTopologyInfo(Args{KubeletConfigFile: path, TopologyManagerScope: "container"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := nrtupdater.TopologyInfo{
+		TopologyManagerPolicy:        "single-numa-node",
+		TopologyManagerScope:         "pod",
+		TopologyManagerPolicyOptions: map[string]string{"prefer-closest-numa-nodes": "true"},
+		CPUManagerPolicy:             "static",
+		CPUManagerPolicyOptions:      map[string]string{"full-pcpus-only": "true"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %+v, want %+v", got, expected)
+	}
+
+	// the given policy wins, the missing kubelet config is not fatal
+	got, err = GetTopologyInfo(Args{KubeletConfigFile: "/does/not/exist", TopologyManagerPolicy: "restricted", TopologyManagerScope: "container"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = nrtupdater.TopologyInfo{TopologyManagerPolicy: "restricted", TopologyManagerScope: "container"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %+v, want %+v", got, expected)
+	}
+
+	if _, err := GetTopologyInfo(Args{KubeletConfigFile: "/does/not/exist"}); err == nil {
+		t.Errorf("expected error without any topology manager policy")
+	}
+}
+
+func TestZoneAttributesFromNodes(t *testing.T) {
+	nodes := []*topology.Node{
+		{
+			ID: 0,
+			Cores: []*cpu.ProcessorCore{
+				{ID: 0, LogicalProcessors: []int{0, 4}},
+				{ID: 1, LogicalProcessors: []int{1, 5}},
+			},
+		},
+		{
+			ID: 1,
+			Cores: []*cpu.ProcessorCore{
+				{ID: 2, LogicalProcessors: []int{2, 6}},
+				{ID: 3, LogicalProcessors: []int{3, 7}},
+			},
+		},
+	}
+	got := ZoneAttributesFromNodes(nodes)
+	expected := map[string]v1alpha1.AttributeList{
+		"node-0": {{Name: "cores", Value: "2"}, {Name: "cpus", Value: "0-1,4-5"}},
+		"node-1": {{Name: "cores", Value: "2"}, {Name: "cpus", Value: "2-3,6-7"}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, want %v", got, expected)
+	}
+}
+
+func TestConfigReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte("excludelist:\n  node: [memory]\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer watcher.Close()
+
+	fr := record.NewFakeRecorder(10)
+	resObs := &ResourceObserver{}
+	cr, err := newConfigReloader(watcher, path, resObs, events.NewRecorderFromEventRecorder(fr, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}}, "", ""))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for name, expected := range map[string]bool{
+		path:                           true,
+		filepath.Join(dir, "..data"):   true,
+		filepath.Join(dir, "kubelet"):  false,
+		filepath.Join(dir, "..2021_x"): false,
+		"/elsewhere/config.yaml":       false,
+	} {
+		if got := cr.Matches(fsnotify.Event{Name: name}); got != expected {
+			t.Errorf("event for %q: matches %v, want %v", name, got, expected)
+		}
+	}
+
+	if !cr.Reload() {
+		t.Fatalf("changed exclude list not reloaded")
+	}
+	expected := resourcemonitor.ResourceExcludeList{ExcludeList: map[string][]string{"node": {"memory"}}}
+	if !reflect.DeepEqual(resObs.ExcludeList(), expected) {
+		t.Errorf("got %+v, want %+v", resObs.ExcludeList(), expected)
+	}
+	if cr.Reload() {
+		t.Errorf("unchanged exclude list reloaded")
+	}
+	if len(fr.Events) != 1 {
+		t.Errorf("expected one event, got %d", len(fr.Events))
+	}
+
+	missing, err := newConfigReloader(watcher, "/does/not/exist/config.yaml", resObs, nil)
+	if err != nil || missing != nil {
+		t.Errorf("unexpected reloader for a missing directory: %v %v", missing, err)
+	}
+}
+
+type fakeResourceMonitor struct {
+	zones v1alpha1.ZoneList
+	err   error
+}
+
+func (fm fakeResourceMonitor) Scan(excludeList resourcemonitor.ResourceExcludeList) (v1alpha1.ZoneList, error) {
+	return fm.zones, fm.err
+}
+
+type fakeSink struct {
+	err   error
+	infos []nrtupdater.MonitorInfo
+}
+
+func (fs *fakeSink) Name() string {
+	return "fake"
+}
+
+func (fs *fakeSink) Update(info nrtupdater.MonitorInfo) error {
+	fs.infos = append(fs.infos, info)
+	return fs.err
+}
+
+func TestRunOnce(t *testing.T) {
+	zones := v1alpha1.ZoneList{{Name: "node-0", Type: "Node"}}
+	testCases := []struct {
+		name     string
+		scanErr  error
+		sinkErr  error
+		expected error
+		updates  int
+	}{
+		{"success", nil, nil, nil, 1},
+		{"scan failure", fmt.Errorf("fake scan error"), nil, ErrScan, 0},
+		{"publish failure", nil, fmt.Errorf("fake sink error"), ErrPublish, 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resObs := &ResourceObserver{
+				resMon: fakeResourceMonitor{zones: zones, err: tc.scanErr},
+				fpCli:  podfingerprint.NewTrackingClient(nil),
+			}
+			sink := &fakeSink{err: tc.sinkErr}
+			err := RunOnce(resObs, sink)
+			if tc.expected == nil && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tc.expected != nil && !errors.Is(err, tc.expected) {
+				t.Errorf("got %v, want %v", err, tc.expected)
+			}
+			if len(sink.infos) != tc.updates {
+				t.Fatalf("unexpected updates: %d", len(sink.infos))
+			}
+			if tc.updates > 0 && !reflect.DeepEqual(sink.infos[0].Zones, zones) {
+				t.Errorf("unexpected zones: %v", sink.infos[0].Zones)
+			}
+		})
+	}
+}
+
+// blockingSink holds the first update until released
+type blockingSink struct {
+	started  chan struct{}
+	release  chan struct{}
+	finished chan struct{}
+}
+
+func (bs *blockingSink) Name() string {
+	return "blocking"
+}
+
+func (bs *blockingSink) Update(info nrtupdater.MonitorInfo) error {
+	select {
+	case <-bs.finished:
+		return nil
+	default:
+	}
+	close(bs.started)
+	<-bs.release
+	close(bs.finished)
+	return nil
+}
+
+func TestRunShutdown(t *testing.T) {
+	testCases := []struct {
+		name     string
+		timeout  time.Duration
+		release  bool
+		finished bool
+	}{
+		{"drains the update in flight", 10 * time.Second, true, true},
+		{"gives up after the timeout", 100 * time.Millisecond, false, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resObs := &ResourceObserver{
+				resMon: fakeResourceMonitor{zones: v1alpha1.ZoneList{{Name: "node-0", Type: "Node"}}},
+				fpCli:  podfingerprint.NewTrackingClient(nil),
+			}
+			sink := &blockingSink{
+				started:  make(chan struct{}),
+				release:  make(chan struct{}),
+				finished: make(chan struct{}),
+			}
+			rteArgs := Args{SleepInterval: time.Hour, ShutdownTimeout: tc.timeout}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			ran := make(chan error)
+			go func() {
+				ran <- run(ctx, rteArgs, resObs, sink, nil, nil, Observers{})
+			}()
+
+			<-sink.started
+			cancel()
+			if tc.release {
+				time.AfterFunc(100*time.Millisecond, func() { close(sink.release) })
+			}
+
+			select {
+			case err := <-ran:
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("run did not return")
+			}
+			select {
+			case <-sink.finished:
+				if !tc.finished {
+					t.Errorf("update unexpectedly finished")
+				}
+			default:
+				if tc.finished {
+					t.Errorf("returned before the update in flight finished")
+				}
+			}
+			if !tc.release {
+				close(sink.release)
+			}
+		})
+	}
+}
+
+func TestRunSinkFailure(t *testing.T) {
+	resObs := &ResourceObserver{
+		resMon: fakeResourceMonitor{zones: v1alpha1.ZoneList{{Name: "node-0", Type: "Node"}}},
+		fpCli:  podfingerprint.NewTrackingClient(nil),
+	}
+	rteArgs := Args{SleepInterval: time.Hour, ShutdownTimeout: time.Second}
+	sinkErrs := make(chan error, 1)
+	sinkErrs <- errors.New("cannot listen")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ran := make(chan error)
+	go func() {
+		ran <- run(ctx, rteArgs, resObs, &fakeSink{}, sinkErrs, nil, Observers{})
+	}()
+
+	select {
+	case err := <-ran:
+		if err == nil || err.Error() != "cannot listen" {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("run did not return")
+	}
+}
+
+func TestDrainContext(t *testing.T) {
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel := DrainContext(parent, 100*time.Millisecond)
+	defer cancel()
+
+	cancelParent()
+	select {
+	case <-ctx.Done():
+		t.Fatalf("done together with the parent")
+	case <-time.After(20 * time.Millisecond):
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("not done after the timeout")
+	}
+}
@@ -0,0 +1,56 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resourcetopologyexporter
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/jaypipes/ghw"
+	"github.com/jaypipes/ghw/pkg/topology"
+
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+
+	"github.com/k8stopologyawareschedwg/noderesourcetopology-api/pkg/apis/topology/v1alpha1"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/nrtupdater"
+)
+
+// GetZoneAttributes reads the NUMA topology like the resource monitor does, and describes the cpus of each zone
+func GetZoneAttributes(sysfsRoot string) (map[string]v1alpha1.AttributeList, error) {
+	topo, err := ghw.Topology(ghw.WithPathOverrides(ghw.PathOverrides{
+		"/sys": sysfsRoot,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	return ZoneAttributesFromNodes(topo.Nodes), nil
+}
+
+// ZoneAttributesFromNodes returns the zone attributes by zone name, which the resource monitor derives from the node ID
+func ZoneAttributesFromNodes(nodes []*topology.Node) map[string]v1alpha1.AttributeList {
+	ret := make(map[string]v1alpha1.AttributeList)
+	for _, node := range nodes {
+		cpuIDs := []int{}
+		for _, core := range node.Cores {
+			cpuIDs = append(cpuIDs, core.LogicalProcessors...)
+		}
+		ret[fmt.Sprintf("node-%d", node.ID)] = v1alpha1.AttributeList{
+			{Name: nrtupdater.AttributeZoneCores, Value: strconv.Itoa(len(node.Cores))},
+			{Name: nrtupdater.AttributeZoneCPUs, Value: cpuset.NewCPUSet(cpuIDs...).String()},
+		}
+	}
+	return ret
+}
@@ -0,0 +1,163 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sharedpool
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+
+	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/podreadiness"
+	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/podrescli"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/podrescompat"
+)
+
+const (
+	// ReferenceContainerFound means that the configured reference container is reported by podresources.
+	ReferenceContainerFound podreadiness.RTEConditionType = "ReferenceContainerFound"
+)
+
+type filteringClient struct {
+	debug    bool
+	cli      podresourcesapi.PodResourcesListerClient
+	detector Detector
+	refCnt   *podrescli.ContainerIdent
+	condChan chan<- corev1.PodCondition
+
+	lock           sync.Mutex
+	sharedPoolCPUs cpuset.CPUSet // last detected, used by Get
+	refFound       *bool         // last reported condition
+}
+
+// NewFilteringClientFromLister removes the shared pool cpus as learned from the detector, like the upstream
+// filtering client does using the reference container. If a reference container is configured, it is used
+// to validate the detector, and its presence is reported as pod condition on condChan, which can be nil.
+func NewFilteringClientFromLister(cli podresourcesapi.PodResourcesListerClient, debug bool, detector Detector, refCnt *podrescli.ContainerIdent, condChan chan<- corev1.PodCondition) podresourcesapi.PodResourcesListerClient {
+	if refCnt != nil && refCnt.IsEmpty() {
+		refCnt = nil
+	}
+	return &filteringClient{
+		debug:    debug,
+		cli:      cli,
+		detector: detector,
+		refCnt:   refCnt,
+		condChan: condChan,
+	}
+}
+
+func (fc *filteringClient) List(ctx context.Context, in *podresourcesapi.ListPodResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.ListPodResourcesResponse, error) {
+	resp, err := fc.cli.List(ctx, in, opts...)
+	if err != nil {
+		return resp, err
+	}
+
+	sharedPoolCPUs, err := fc.detector.SharedPoolCPUs(resp)
+	if err != nil {
+		return nil, fmt.Errorf("cannot detect the shared pool: %w", err)
+	}
+	fc.lock.Lock()
+	if !fc.sharedPoolCPUs.Equals(sharedPoolCPUs) {
+		logger.V(2).InfoS("detected shared pool change", "from", fc.sharedPoolCPUs.String(), "to", sharedPoolCPUs.String())
+		fc.sharedPoolCPUs = sharedPoolCPUs
+	}
+	fc.lock.Unlock()
+
+	if fc.refCnt != nil {
+		refCPUs, found := FindContainerCPUs(fc.refCnt, resp)
+		fc.reportReferenceContainer(found)
+		if found && !refCPUs.Equals(sharedPoolCPUs) {
+			logger.InfoS("shared pool differs from the cpus of the reference container", "sharedPool", sharedPoolCPUs.String(), "container", fc.refCnt.String(), "cpus", refCPUs.String())
+		}
+	}
+
+	for _, podRes := range resp.GetPodResources() {
+		fc.filterPodResources(podRes, sharedPoolCPUs)
+	}
+	return resp, nil
+}
+
+// Get filters the pod resources with the shared pool detected by the last List, which the
+// targeted refreshes always follow.
+func (fc *filteringClient) Get(ctx context.Context, podNamespace, podName string) (*podresourcesapi.PodResources, error) {
+	podRes, err := podrescompat.GetPodResources(ctx, fc.cli, podNamespace, podName)
+	if err != nil {
+		return nil, err
+	}
+	fc.lock.Lock()
+	sharedPoolCPUs := fc.sharedPoolCPUs
+	fc.lock.Unlock()
+	fc.filterPodResources(podRes, sharedPoolCPUs)
+	return podRes, nil
+}
+
+func (fc *filteringClient) filterPodResources(podRes *podresourcesapi.PodResources, sharedPoolCPUs cpuset.CPUSet) {
+	for _, cntRes := range podRes.GetContainers() {
+		curCPUs := cpuset.NewCPUSetInt64(cntRes.CpuIds...)
+		newCPUs := curCPUs.Difference(sharedPoolCPUs)
+		if fc.debug && !curCPUs.Equals(newCPUs) {
+			logger.InfoS("performed pool change", "pod", podRes.Name, "container", cntRes.Name, "from", curCPUs.String(), "to", newCPUs.String())
+		}
+		cntRes.CpuIds = newCPUs.ToSliceInt64()
+	}
+}
+
+func (fc *filteringClient) GetAllocatableResources(ctx context.Context, in *podresourcesapi.AllocatableResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.AllocatableResourcesResponse, error) {
+	return fc.cli.GetAllocatableResources(ctx, in, opts...)
+}
+
+// reportReferenceContainer sends the condition only when it changes. The send never blocks the List:
+// if the condition cannot be delivered now, it is retried at the next List.
+func (fc *filteringClient) reportReferenceContainer(found bool) {
+	if fc.refFound != nil && *fc.refFound == found {
+		return
+	}
+	if fc.condChan == nil {
+		fc.markReported(found)
+		return
+	}
+
+	cond := corev1.PodCondition{
+		Type:               corev1.PodConditionType(ReferenceContainerFound),
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Time{Time: time.Now()},
+	}
+	if !found {
+		cond.Status = corev1.ConditionFalse
+		cond.Reason = "ReferenceContainerNotFound"
+		cond.Message = fmt.Sprintf("reference container %s not reported by podresources", fc.refCnt.String())
+	}
+	select {
+	case fc.condChan <- cond:
+		fc.markReported(found)
+	default:
+		logger.V(2).InfoS("pod condition busy, will retry", "condition", ReferenceContainerFound)
+	}
+}
+
+func (fc *filteringClient) markReported(found bool) {
+	fc.refFound = &found
+	if !found {
+		logger.InfoS("reference container not found", "container", fc.refCnt.String())
+	}
+}
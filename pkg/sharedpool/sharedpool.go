@@ -0,0 +1,181 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sharedpool
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+
+	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/podrescli"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/cgroups"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/logging"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/sysinfo"
+)
+
+var logger = logging.Component("sharedpool")
+
+const (
+	SourceReferenceContainer = "reference-container"
+	SourceCgroup             = "cgroup"
+	SourceCPUManagerState    = "cpu-manager-state"
+)
+
+type Args struct {
+	Source string
+	// CgroupRoot is used with SourceCgroup
+	CgroupRoot string
+	// CPUManagerStateFile is used with SourceCgroup and SourceCPUManagerState
+	CPUManagerStateFile string
+	// ReservedCPUs are never part of the shared pool, used with SourceCgroup and SourceCPUManagerState
+	ReservedCPUs string
+}
+
+// Detector learns the cpus of the shared pool. The podresources response is needed only by the reference container.
+type Detector interface {
+	SharedPoolCPUs(resp *podresourcesapi.ListPodResourcesResponse) (cpuset.CPUSet, error)
+}
+
+func NewDetector(args Args, refCnt *podrescli.ContainerIdent) (Detector, error) {
+	if args.Source == SourceReferenceContainer {
+		return NewReferenceContainerDetector(refCnt), nil
+	}
+	reserved, err := cpuset.Parse(args.ReservedCPUs)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse the reserved cpus %q: %w", args.ReservedCPUs, err)
+	}
+	switch args.Source {
+	case SourceCgroup:
+		reader, err := cgroups.NewReader(args.CgroupRoot)
+		if err != nil {
+			return nil, err
+		}
+		return &cgroupDetector{reader: reader, statePath: args.CPUManagerStateFile, reserved: reserved}, nil
+	case SourceCPUManagerState:
+		return &cpuManagerStateDetector{path: args.CPUManagerStateFile, online: sysinfo.GetOnlineCPUs, reserved: reserved}, nil
+	}
+	return nil, fmt.Errorf("unsupported shared pool source: %q", args.Source)
+}
+
+type referenceContainerDetector struct {
+	refCnt *podrescli.ContainerIdent
+}
+
+// NewReferenceContainerDetector reports the cpus of the reference container, which runs in the shared pool.
+// Like the upstream filtering client, a missing reference container means an empty shared pool.
+func NewReferenceContainerDetector(refCnt *podrescli.ContainerIdent) Detector {
+	return &referenceContainerDetector{refCnt: refCnt}
+}
+
+func (rd *referenceContainerDetector) SharedPoolCPUs(resp *podresourcesapi.ListPodResourcesResponse) (cpuset.CPUSet, error) {
+	if rd.refCnt == nil || rd.refCnt.IsEmpty() {
+		return cpuset.NewCPUSet(), nil
+	}
+	cpus, _ := FindContainerCPUs(rd.refCnt, resp)
+	return cpus, nil
+}
+
+// cgroupDetector computes the shared pool out of the cpus of the pods cgroup, which includes the
+// exclusive cpus, and the exclusive assignments the cpu manager checkpointed.
+type cgroupDetector struct {
+	reader    *cgroups.Reader
+	statePath string
+	reserved  cpuset.CPUSet
+}
+
+func (cd *cgroupDetector) SharedPoolCPUs(resp *podresourcesapi.ListPodResourcesResponse) (cpuset.CPUSet, error) {
+	exclusive, err := readExclusiveCPUs(cd.statePath)
+	if err != nil {
+		return cpuset.CPUSet{}, err
+	}
+	cpus, err := cd.reader.PodsCPUSet()
+	if err != nil {
+		return cpuset.CPUSet{}, err
+	}
+	return cpus.Difference(cd.reserved).Difference(exclusive), nil
+}
+
+// cpuManagerState is the checkpoint the kubelet cpu manager writes, usually /var/lib/kubelet/cpu_manager_state
+type cpuManagerState struct {
+	PolicyName string `json:"policyName"`
+	// Entries are the exclusive assignments, by pod UID and container name
+	Entries map[string]map[string]string `json:"entries,omitempty"`
+}
+
+// cpuManagerStateDetector computes the shared pool out of the online cpus and the exclusive assignments
+// the cpu manager checkpointed. The defaultCpuSet of the checkpoint is not used, because it includes
+// the reserved cpus.
+type cpuManagerStateDetector struct {
+	path     string
+	online   func() (cpuset.CPUSet, error)
+	reserved cpuset.CPUSet
+}
+
+func (sd *cpuManagerStateDetector) SharedPoolCPUs(resp *podresourcesapi.ListPodResourcesResponse) (cpuset.CPUSet, error) {
+	exclusive, err := readExclusiveCPUs(sd.path)
+	if err != nil {
+		return cpuset.CPUSet{}, err
+	}
+	cpus, err := sd.online()
+	if err != nil {
+		return cpuset.CPUSet{}, err
+	}
+	return cpus.Difference(sd.reserved).Difference(exclusive), nil
+}
+
+// readExclusiveCPUs returns the union of the exclusive assignments in the cpu manager checkpoint.
+// Unlike podresources, which may report the shared pool for the containers running there, the
+// checkpoint has entries only for the exclusive assignments.
+func readExclusiveCPUs(path string) (cpuset.CPUSet, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cpuset.CPUSet{}, err
+	}
+	st := cpuManagerState{}
+	if err := json.Unmarshal(data, &st); err != nil {
+		return cpuset.CPUSet{}, fmt.Errorf("cannot decode the cpu manager state %q: %w", path, err)
+	}
+	exclusive := cpuset.NewCPUSet()
+	for podUID, cnts := range st.Entries {
+		for cntName, value := range cnts {
+			cpus, err := cpuset.Parse(value)
+			if err != nil {
+				return cpuset.CPUSet{}, fmt.Errorf("cannot parse the cpus of %s/%s in %q: %w", podUID, cntName, path, err)
+			}
+			exclusive = exclusive.Union(cpus)
+		}
+	}
+	return exclusive, nil
+}
+
+// FindContainerCPUs returns the cpus podresources reports for the given container.
+func FindContainerCPUs(cntIdent *podrescli.ContainerIdent, resp *podresourcesapi.ListPodResourcesResponse) (cpuset.CPUSet, bool) {
+	for _, podRes := range resp.GetPodResources() {
+		if podRes.GetNamespace() != cntIdent.Namespace || podRes.GetName() != cntIdent.PodName {
+			continue
+		}
+		for _, cntRes := range podRes.GetContainers() {
+			if cntRes.GetName() != cntIdent.ContainerName {
+				continue
+			}
+			return cpuset.NewCPUSetInt64(cntRes.GetCpuIds()...), true
+		}
+	}
+	return cpuset.NewCPUSet(), false
+}
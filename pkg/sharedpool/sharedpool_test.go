@@ -0,0 +1,224 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sharedpool
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	corev1 "k8s.io/api/core/v1"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+
+	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/podrescli"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/podrescompat"
+)
+
+type fakeLister struct {
+	resp *podresourcesapi.ListPodResourcesResponse
+}
+
+func (fl *fakeLister) List(ctx context.Context, in *podresourcesapi.ListPodResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.ListPodResourcesResponse, error) {
+	return fl.resp, nil
+}
+
+func (fl *fakeLister) GetAllocatableResources(ctx context.Context, in *podresourcesapi.AllocatableResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.AllocatableResourcesResponse, error) {
+	return &podresourcesapi.AllocatableResourcesResponse{}, nil
+}
+
+type fakeDetector struct {
+	cpus cpuset.CPUSet
+}
+
+func (fd *fakeDetector) SharedPoolCPUs(resp *podresourcesapi.ListPodResourcesResponse) (cpuset.CPUSet, error) {
+	return fd.cpus, nil
+}
+
+func makeListResponse(withReference bool) *podresourcesapi.ListPodResourcesResponse {
+	resp := &podresourcesapi.ListPodResourcesResponse{
+		PodResources: []*podresourcesapi.PodResources{
+			{
+				Namespace: "ns", Name: "guaranteed",
+				Containers: []*podresourcesapi.ContainerResources{{Name: "cnt", CpuIds: []int64{2, 3}}},
+			},
+			{
+				Namespace: "ns", Name: "burstable",
+				Containers: []*podresourcesapi.ContainerResources{{Name: "cnt", CpuIds: []int64{0, 1, 4, 5}}},
+			},
+		},
+	}
+	if withReference {
+		resp.PodResources = append(resp.PodResources, &podresourcesapi.PodResources{
+			Namespace: "rte", Name: "rte-pod",
+			Containers: []*podresourcesapi.ContainerResources{{Name: "rte", CpuIds: []int64{0, 1, 4, 5}}},
+		})
+	}
+	return resp
+}
+
+func TestCPUManagerStateDetector(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cpu_manager_state")
+	// the default cpuset includes the reserved cpu 0
+	state := `{"policyName":"static","defaultCpuSet":"0-1,4-7","entries":{"uid":{"cnt":"2-3"}},"checksum":1234}`
+	if err := ioutil.WriteFile(path, []byte(state), 0644); err != nil {
+		t.Fatalf("cannot write the state file: %v", err)
+	}
+
+	det := &cpuManagerStateDetector{
+		path:     path,
+		online:   func() (cpuset.CPUSet, error) { return cpuset.Parse("0-7") },
+		reserved: cpuset.NewCPUSet(0),
+	}
+	got, err := det.SharedPoolCPUs(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := cpuset.NewCPUSet(1, 4, 5, 6, 7); !got.Equals(expected) {
+		t.Errorf("got %q, want %q", got.String(), expected.String())
+	}
+}
+
+func TestCgroupDetector(t *testing.T) {
+	root := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(root, "cgroup.controllers"), []byte("cpuset cpu memory"), 0644); err != nil {
+		t.Fatalf("cannot write the cgroup controllers: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "kubepods.slice"), 0755); err != nil {
+		t.Fatalf("cannot create the pods cgroup: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "kubepods.slice", "cpuset.cpus.effective"), []byte("0-7\n"), 0644); err != nil {
+		t.Fatalf("cannot write the pods cpuset: %v", err)
+	}
+	statePath := filepath.Join(t.TempDir(), "cpu_manager_state")
+	state := `{"policyName":"static","defaultCpuSet":"0-1,4-7","entries":{"uid":{"cnt":"2-3"}},"checksum":1234}`
+	if err := ioutil.WriteFile(statePath, []byte(state), 0644); err != nil {
+		t.Fatalf("cannot write the state file: %v", err)
+	}
+
+	testCases := []struct {
+		name string
+		resp *podresourcesapi.ListPodResourcesResponse
+	}{
+		{
+			name: "shared pool reported",
+			resp: makeListResponse(true),
+		},
+		{
+			// a single container in the shared pool is reported like an exclusive assignment
+			name: "single shared container",
+			resp: &podresourcesapi.ListPodResourcesResponse{
+				PodResources: []*podresourcesapi.PodResources{
+					{
+						Namespace: "ns", Name: "guaranteed",
+						Containers: []*podresourcesapi.ContainerResources{{Name: "cnt", CpuIds: []int64{2, 3}}},
+					},
+					{
+						Namespace: "ns", Name: "burstable",
+						Containers: []*podresourcesapi.ContainerResources{{Name: "cnt", CpuIds: []int64{0, 1, 4, 5}}},
+					},
+				},
+			},
+		},
+		{
+			name: "empty",
+			resp: &podresourcesapi.ListPodResourcesResponse{},
+		},
+	}
+
+	det, err := NewDetector(Args{Source: SourceCgroup, CgroupRoot: root, CPUManagerStateFile: statePath, ReservedCPUs: "6-7"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := det.SharedPoolCPUs(tc.resp)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if expected := cpuset.NewCPUSet(0, 1, 4, 5); !got.Equals(expected) {
+				t.Errorf("got %q, want %q", got.String(), expected.String())
+			}
+		})
+	}
+}
+
+func TestNewDetectorUnsupported(t *testing.T) {
+	if _, err := NewDetector(Args{Source: "foobar"}, nil); err == nil {
+		t.Errorf("expected error on unsupported source")
+	}
+}
+
+func TestFilteringClient(t *testing.T) {
+	refCnt := &podrescli.ContainerIdent{Namespace: "rte", PodName: "rte-pod", ContainerName: "rte"}
+	lister := &fakeLister{resp: makeListResponse(true)}
+	condChan := make(chan corev1.PodCondition, 2)
+	cli := NewFilteringClientFromLister(lister, false, &fakeDetector{cpus: cpuset.NewCPUSet(0, 1, 4, 5)}, refCnt, condChan)
+
+	resp, err := cli.List(context.TODO(), &podresourcesapi.ListPodResourcesRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := [][]int64{}
+	for _, podRes := range resp.PodResources {
+		got = append(got, podRes.Containers[0].CpuIds)
+	}
+	expected := [][]int64{{2, 3}, nil, nil}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, want %v", got, expected)
+	}
+
+	cond := <-condChan
+	if cond.Type != corev1.PodConditionType(ReferenceContainerFound) || cond.Status != corev1.ConditionTrue {
+		t.Errorf("unexpected condition: %v", cond)
+	}
+
+	// the reference container is gone, but the detector does not need it
+	lister.resp = makeListResponse(false)
+	for i := 0; i < 2; i++ {
+		resp, err = cli.List(context.TODO(), &podresourcesapi.ListPodResourcesRequest{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(resp.PodResources[1].Containers[0].CpuIds) != 0 {
+			t.Errorf("shared pool not filtered: %v", resp.PodResources[1])
+		}
+	}
+
+	// the condition is sent only on changes
+	if len(condChan) != 1 {
+		t.Fatalf("expected 1 condition, got %d", len(condChan))
+	}
+	cond = <-condChan
+	if cond.Status != corev1.ConditionFalse || cond.Reason != "ReferenceContainerNotFound" {
+		t.Errorf("unexpected condition: %v", cond)
+	}
+
+	// the targeted reads are filtered with the shared pool of the last List
+	lister.resp = makeListResponse(false)
+	podRes, err := podrescompat.GetPodResources(context.TODO(), cli, "ns", "burstable")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(podRes.Containers[0].CpuIds) != 0 {
+		t.Errorf("shared pool not filtered: %v", podRes)
+	}
+}
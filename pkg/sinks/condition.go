@@ -0,0 +1,47 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sinks
+
+import (
+	"github.com/openshift-kni/resource-topology-exporter/pkg/freshness"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/nrtupdater"
+)
+
+// conditionSink reports the update results of the wrapped sink in the node condition
+type conditionSink struct {
+	sink Sink
+	rep  *freshness.Reporter
+}
+
+// WithCondition wraps the sink to maintain the node condition. A nil reporter returns the sink unchanged.
+func WithCondition(sink Sink, rep *freshness.Reporter) Sink {
+	if rep == nil {
+		return sink
+	}
+	return conditionSink{
+		sink: sink,
+		rep:  rep,
+	}
+}
+
+func (cs conditionSink) Name() string {
+	return cs.sink.Name()
+}
+
+func (cs conditionSink) Update(info nrtupdater.MonitorInfo) error {
+	err := cs.sink.Update(info)
+	cs.rep.Observe(err)
+	return err
+}
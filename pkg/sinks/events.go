@@ -0,0 +1,64 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sinks
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/events"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/nrtupdater"
+)
+
+// eventsSink records the zone transitions and the update failures of the wrapped sink
+type eventsSink struct {
+	sink    Sink
+	rec     *events.Recorder
+	zones   *events.ZoneTracker
+	failing bool
+}
+
+// WithEvents wraps the sink to record the events. A nil recorder returns the sink unchanged.
+func WithEvents(sink Sink, rec *events.Recorder) Sink {
+	if rec == nil {
+		return sink
+	}
+	return &eventsSink{
+		sink:  sink,
+		rec:   rec,
+		zones: events.NewZoneTracker(rec),
+	}
+}
+
+func (es *eventsSink) Name() string {
+	return es.sink.Name()
+}
+
+func (es *eventsSink) Update(info nrtupdater.MonitorInfo) error {
+	es.zones.Observe(info.Zones)
+	err := es.sink.Update(info)
+	if err != nil {
+		if !es.failing {
+			es.rec.Exporterf(corev1.EventTypeWarning, events.ReasonPublishFailed, "failed to publish the topology: %v", err)
+		}
+		es.failing = true
+		return err
+	}
+	if es.failing {
+		klog.Infof("publishing the topology again")
+	}
+	es.failing = false
+	return nil
+}
@@ -0,0 +1,119 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sinks
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/nrtupdater"
+)
+
+type fileSink struct {
+	renderer Renderer
+	path     string
+	format   string
+}
+
+// NewFileSink keeps the file at path updated with the latest object. Readers never see a partial file.
+func NewFileSink(renderer Renderer, path, format string) Sink {
+	return &fileSink{
+		renderer: renderer,
+		path:     path,
+		format:   format,
+	}
+}
+
+func (fs *fileSink) Name() string {
+	return SinkFile
+}
+
+func (fs *fileSink) Update(info nrtupdater.MonitorInfo) error {
+	obj, err := fs.renderer.Render(info)
+	if err != nil {
+		return err
+	}
+	data, err := Marshal(obj, fs.format)
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(fs.path, data)
+}
+
+// WriteFileAtomic writes the data in a temporary file in the same directory, then renames it over path
+func WriteFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	// no-op after the rename
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// TempFile creates with 0600, the consumers may run as other users
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+type stdoutSink struct {
+	renderer Renderer
+	format   string
+	out      io.Writer
+}
+
+// NewStdoutSink prints every update: one JSON object per line, or a stream of YAML documents
+func NewStdoutSink(renderer Renderer, format string) Sink {
+	return &stdoutSink{
+		renderer: renderer,
+		format:   format,
+		out:      os.Stdout,
+	}
+}
+
+func (ss *stdoutSink) Name() string {
+	return SinkStdout
+}
+
+func (ss *stdoutSink) Update(info nrtupdater.MonitorInfo) error {
+	obj, err := ss.renderer.Render(info)
+	if err != nil {
+		return err
+	}
+	data, err := Marshal(obj, ss.format)
+	if err != nil {
+		return err
+	}
+	if ss.format == FormatYAML {
+		data = append([]byte("---\n"), data...)
+	} else {
+		data = append(data, '\n')
+	}
+	_, err = ss.out.Write(data)
+	return err
+}
@@ -0,0 +1,47 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sinks
+
+import (
+	"github.com/openshift-kni/resource-topology-exporter/pkg/health"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/nrtupdater"
+)
+
+// healthSink reports the updates of the wrapped sink to the readiness check
+type healthSink struct {
+	sink    Sink
+	tracker *health.Tracker
+}
+
+// WithHealth wraps the sink to track the readiness. A nil tracker returns the sink unchanged.
+func WithHealth(sink Sink, tracker *health.Tracker) Sink {
+	if tracker == nil {
+		return sink
+	}
+	return healthSink{
+		sink:    sink,
+		tracker: tracker,
+	}
+}
+
+func (hs healthSink) Name() string {
+	return hs.sink.Name()
+}
+
+func (hs healthSink) Update(info nrtupdater.MonitorInfo) error {
+	err := hs.sink.Update(info)
+	hs.tracker.ObserveUpdate(info.Zones, err)
+	return err
+}
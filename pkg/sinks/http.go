@@ -0,0 +1,80 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sinks
+
+import (
+	"net/http"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/nrtupdater"
+)
+
+// HTTPSink serves the latest object, as JSON or as YAML with ?format=yaml
+type HTTPSink struct {
+	renderer Renderer
+
+	lock   sync.RWMutex
+	latest *unstructured.Unstructured
+}
+
+func NewHTTPSink(renderer Renderer) *HTTPSink {
+	return &HTTPSink{
+		renderer: renderer,
+	}
+}
+
+func (hs *HTTPSink) Name() string {
+	return SinkHTTP
+}
+
+func (hs *HTTPSink) Update(info nrtupdater.MonitorInfo) error {
+	obj, err := hs.renderer.Render(info)
+	if err != nil {
+		return err
+	}
+	hs.lock.Lock()
+	defer hs.lock.Unlock()
+	hs.latest = obj
+	return nil
+}
+
+func (hs *HTTPSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	hs.lock.RLock()
+	obj := hs.latest
+	hs.lock.RUnlock()
+
+	if obj == nil {
+		http.Error(w, "no data yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = FormatJSON
+	}
+	data, err := Marshal(obj, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if format == FormatYAML {
+		w.Header().Set("Content-Type", "application/yaml")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Write(data)
+}
@@ -0,0 +1,112 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sinks
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/nrtupdater"
+)
+
+const (
+	// DefaultNFDFeatureFile is in the directory scanned by the node-feature-discovery local source
+	DefaultNFDFeatureFile = "/etc/kubernetes/node-feature-discovery/features.d/resource-topology-exporter"
+
+	// the local source turns each feature into the feature.node.kubernetes.io/<name> label
+	NFDFeatureNUMANodes      = "rte.numa-nodes"
+	NFDFeatureTopologyPolicy = "rte.topology-policy"
+)
+
+// nfdSink only exposes what is fit for node labels: values which change at every pod would churn the labels
+type nfdSink struct {
+	renderer Renderer
+	path     string
+	last     []byte
+}
+
+func NewNFDSink(renderer Renderer, path string) Sink {
+	if path == "" {
+		path = DefaultNFDFeatureFile
+	}
+	return &nfdSink{
+		renderer: renderer,
+		path:     path,
+	}
+}
+
+func (ns *nfdSink) Name() string {
+	return SinkNFD
+}
+
+func (ns *nfdSink) Update(info nrtupdater.MonitorInfo) error {
+	obj, err := ns.renderer.Render(info)
+	if err != nil {
+		return err
+	}
+	data, err := NFDFeatures(obj)
+	if err != nil {
+		return err
+	}
+	if ns.last != nil && bytes.Equal(data, ns.last) {
+		return nil
+	}
+	if err := WriteFileAtomic(ns.path, data); err != nil {
+		return err
+	}
+	ns.last = data
+	return nil
+}
+
+// NFDFeatures renders the object in the node-feature-discovery feature file format, one name=value per line
+func NFDFeatures(obj *unstructured.Unstructured) ([]byte, error) {
+	features := make(map[string]string)
+
+	zones, _, err := unstructured.NestedSlice(obj.Object, "zones")
+	if err != nil {
+		return nil, err
+	}
+	numaNodes := 0
+	for _, zone := range zones {
+		zoneMap, ok := zone.(map[string]interface{})
+		if ok && zoneMap["type"] == "Node" {
+			numaNodes++
+		}
+	}
+	features[NFDFeatureNUMANodes] = strconv.Itoa(numaNodes)
+
+	policies, _, err := unstructured.NestedStringSlice(obj.Object, "topologyPolicies")
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) > 0 && policies[0] != "" {
+		features[NFDFeatureTopologyPolicy] = policies[0]
+	}
+
+	names := make([]string, 0, len(features))
+	for name := range features {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s=%s\n", name, features[name])
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,229 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sinks delivers the zone data computed by the exporter. The NodeResourceTopology API is one
+// of the sinks; the others let consumers on the node read the topology without apiserver access.
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/klog/v2"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/podreadiness"
+	"github.com/k8stopologyawareschedwg/resource-topology-exporter/pkg/prometheus"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/nrtupdater"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/topologyapi"
+)
+
+const (
+	SinkAPI    = "api"
+	SinkFile   = "file"
+	SinkStdout = "stdout"
+	SinkHTTP   = "http"
+	SinkNFD    = "nfd"
+	SinkGRPC   = "grpc"
+)
+
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+const (
+	// HTTPPath is where the http sink is served, on the metrics endpoint
+	HTTPPath = "/topology"
+)
+
+// Command line arguments
+type Args struct {
+	// Sinks are the enabled sinks, see the Sink* constants
+	Sinks []string
+	// Format is the serialization of the file and stdout sinks
+	Format         string
+	FilePath       string
+	NFDFeatureFile string
+	// GRPCSocket is the unix socket the grpc sink serves on
+	GRPCSocket string
+}
+
+// Sink receives every scan result
+type Sink interface {
+	Name() string
+	Update(info nrtupdater.MonitorInfo) error
+}
+
+// Renderer builds the NodeResourceTopology object out of a scan result
+type Renderer interface {
+	Render(info nrtupdater.MonitorInfo) (*unstructured.Unstructured, error)
+}
+
+// Parse splits a comma separated list of sinks and validates it
+func Parse(value string) ([]string, error) {
+	ret := []string{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		switch name {
+		case SinkAPI, SinkFile, SinkStdout, SinkHTTP, SinkNFD, SinkGRPC:
+		default:
+			return nil, fmt.Errorf("unsupported sink: %q", name)
+		}
+		ret = append(ret, name)
+	}
+	return ret, nil
+}
+
+// Has tells if the named sink is enabled
+func (args Args) Has(name string) bool {
+	for _, sink := range args.Sinks {
+		if sink == name {
+			return true
+		}
+	}
+	return false
+}
+
+// New creates the enabled sinks. The API sink is the updater itself. The http sink handler is
+// registered on http.DefaultServeMux. The grpc sink serves also the podresources data from cli, until
+// the context is done. The returned channel reports the failure of the servers the sinks run.
+func New(ctx context.Context, args Args, upd *nrtupdater.NRTUpdater, cli podresourcesapi.PodResourcesListerClient) (Sink, <-chan error, error) {
+	ret := multiSink{}
+	// one slot per server, so a failing server never blocks
+	errs := make(chan error, 1)
+	for _, name := range args.Sinks {
+		switch name {
+		case SinkAPI:
+			ret = append(ret, apiSink{upd: upd})
+		case SinkFile:
+			if args.FilePath == "" {
+				return nil, nil, fmt.Errorf("the file sink needs a file path")
+			}
+			ret = append(ret, NewFileSink(upd, args.FilePath, args.Format))
+		case SinkStdout:
+			ret = append(ret, NewStdoutSink(upd, args.Format))
+		case SinkHTTP:
+			hs := NewHTTPSink(upd)
+			http.Handle(HTTPPath, hs)
+			ret = append(ret, hs)
+		case SinkNFD:
+			ret = append(ret, NewNFDSink(upd, args.NFDFeatureFile))
+		case SinkGRPC:
+			srv := topologyapi.NewServer(upd.NodeName(), upd.TopologyPolicy(), cli)
+			go func() {
+				if err := srv.Serve(ctx, args.GRPCSocket); err != nil {
+					errs <- fmt.Errorf("failed to serve the topology API: %w", err)
+				}
+			}()
+			ret = append(ret, srv)
+		default:
+			return nil, nil, fmt.Errorf("unsupported sink: %q", name)
+		}
+	}
+	return ret, errs, nil
+}
+
+type apiSink struct {
+	upd *nrtupdater.NRTUpdater
+}
+
+func (as apiSink) Name() string {
+	return SinkAPI
+}
+
+func (as apiSink) Update(info nrtupdater.MonitorInfo) error {
+	return as.upd.Update(info)
+}
+
+// multiSink updates all the sinks, even if some of them fail
+type multiSink []Sink
+
+func (ms multiSink) Name() string {
+	names := []string{}
+	for _, sink := range ms {
+		names = append(names, sink.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+func (ms multiSink) Update(info nrtupdater.MonitorInfo) error {
+	failed := []string{}
+	for _, sink := range ms {
+		if err := sink.Update(info); err != nil {
+			klog.Warningf("sink %s failed to update: %v", sink.Name(), err)
+			failed = append(failed, sink.Name())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed sinks: %s", strings.Join(failed, ","))
+	}
+	return nil
+}
+
+// Run feeds the sink with the scan results until the context is done. The update in flight is
+// completed; the returned channel is closed after it.
+func Run(ctx context.Context, sink Sink, infoChannel <-chan nrtupdater.MonitorInfo, condChan chan v1.PodCondition) <-chan struct{} {
+	done := make(chan struct{})
+	var condStatus v1.ConditionStatus
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case info := <-infoChannel:
+				tsBegin := time.Now()
+				condStatus = v1.ConditionTrue
+				if err := sink.Update(info); err != nil {
+					klog.Warningf("failed to update: %v", err)
+					condStatus = v1.ConditionFalse
+				}
+				tsEnd := time.Now()
+
+				tsDiff := tsEnd.Sub(tsBegin)
+				prometheus.UpdateOperationDelayMetric("node_resource_object_update", nrtupdater.RTEUpdateReactive, float64(tsDiff.Milliseconds()))
+				podreadiness.SetCondition(condChan, podreadiness.NodeTopologyUpdated, condStatus)
+			case <-ctx.Done():
+				klog.Infof("update stop at %v", time.Now())
+				return
+			}
+		}
+	}()
+	return done
+}
+
+// Marshal serializes the object in the given format
+func Marshal(obj *unstructured.Unstructured, format string) ([]byte, error) {
+	data, err := json.Marshal(obj.Object)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case FormatJSON:
+		return data, nil
+	case FormatYAML:
+		return yaml.JSONToYAML(data)
+	}
+	return nil, fmt.Errorf("unsupported format: %q", format)
+}
@@ -0,0 +1,217 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sinks
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/yaml"
+
+	"github.com/k8stopologyawareschedwg/noderesourcetopology-api/pkg/apis/topology/v1alpha1"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/events"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/nrtupdater"
+)
+
+type fakeRenderer struct{}
+
+func (fr fakeRenderer) Render(info nrtupdater.MonitorInfo) (*unstructured.Unstructured, error) {
+	return nrtupdater.NewObject(nrtupdater.APIVersionV1alpha1, "node", nil, string(v1alpha1.SingleNUMANodeContainerLevel), nrtupdater.TopologyInfo{}, info.Zones)
+}
+
+func makeZones() v1alpha1.ZoneList {
+	zones := v1alpha1.ZoneList{}
+	for idx := 0; idx < 2; idx++ {
+		zones = append(zones, v1alpha1.Zone{
+			Name: fmt.Sprintf("node-%d", idx),
+			Type: "Node",
+			Resources: v1alpha1.ResourceInfoList{
+				{Name: "cpu", Capacity: resource.MustParse("8"), Allocatable: resource.MustParse("8"), Available: resource.MustParse("4")},
+			},
+		})
+	}
+	return zones
+}
+
+type fakeSink struct {
+	name    string
+	err     error
+	updates int
+}
+
+func (fs *fakeSink) Name() string {
+	return fs.name
+}
+
+func (fs *fakeSink) Update(info nrtupdater.MonitorInfo) error {
+	fs.updates++
+	return fs.err
+}
+
+func TestParse(t *testing.T) {
+	got, err := Parse("api, file,,nfd")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, []string{SinkAPI, SinkFile, SinkNFD}) {
+		t.Errorf("unexpected sinks: %v", got)
+	}
+	if _, err := Parse("api,kafka"); err == nil {
+		t.Errorf("unsupported sink accepted")
+	}
+}
+
+func TestMultiSink(t *testing.T) {
+	failing := &fakeSink{name: "failing", err: fmt.Errorf("fake error")}
+	working := &fakeSink{name: "working"}
+	ms := multiSink{failing, working}
+
+	err := ms.Update(nrtupdater.MonitorInfo{})
+	if err == nil || !strings.Contains(err.Error(), "failing") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if failing.updates != 1 || working.updates != 1 {
+		t.Errorf("not all the sinks updated: %d %d", failing.updates, working.updates)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rte-sinks")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "topology.yaml")
+	fs := NewFileSink(fakeRenderer{}, path, FormatYAML)
+	if err := fs.Update(nrtupdater.MonitorInfo{Zones: makeZones()}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	nrt := v1alpha1.NodeResourceTopology{}
+	if err := yaml.Unmarshal(data, &nrt); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if nrt.Name != "node" || len(nrt.Zones) != 2 {
+		t.Errorf("unexpected content: %s", data)
+	}
+
+	// no leftover temporary files
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("unexpected files: %v", entries)
+	}
+}
+
+func TestStdoutSink(t *testing.T) {
+	var buf bytes.Buffer
+	ss := &stdoutSink{renderer: fakeRenderer{}, format: FormatJSON, out: &buf}
+	for idx := 0; idx < 2; idx++ {
+		if err := ss.Update(nrtupdater.MonitorInfo{Zones: makeZones()}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "{") {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	hs := NewHTTPSink(fakeRenderer{})
+
+	rec := httptest.NewRecorder()
+	hs.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, HTTPPath, nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("unexpected status before the first update: %d", rec.Code)
+	}
+
+	if err := hs.Update(nrtupdater.MonitorInfo{Zones: makeZones()}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rec = httptest.NewRecorder()
+	hs.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, HTTPPath+"?format=yaml", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/yaml" {
+		t.Fatalf("unexpected response: %d %v", rec.Code, rec.Header())
+	}
+	nrt := v1alpha1.NodeResourceTopology{}
+	if err := yaml.Unmarshal(rec.Body.Bytes(), &nrt); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(nrt.Zones) != 2 {
+		t.Errorf("unexpected content: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	hs.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, HTTPPath+"?format=xml", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status for unsupported format: %d", rec.Code)
+	}
+}
+
+func TestWithEvents(t *testing.T) {
+	fr := record.NewFakeRecorder(10)
+	sink := &fakeSink{name: "failing", err: fmt.Errorf("fake error")}
+	es := WithEvents(sink, events.NewRecorderFromEventRecorder(fr, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}}, "", ""))
+	if es.Name() != "failing" {
+		t.Errorf("unexpected name: %q", es.Name())
+	}
+
+	info := nrtupdater.MonitorInfo{Zones: makeZones()}
+	for i := 0; i < 3; i++ {
+		if err := es.Update(info); err == nil {
+			t.Errorf("error not propagated")
+		}
+	}
+	sink.err = nil
+	if err := es.Update(info); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	sink.err = fmt.Errorf("fake error")
+	if err := es.Update(info); err == nil {
+		t.Errorf("error not propagated")
+	}
+
+	got := []string{}
+	close(fr.Events)
+	for ev := range fr.Events {
+		got = append(got, ev)
+	}
+	// one event per failure streak
+	if len(got) != 2 || !strings.HasPrefix(got[0], "Warning PublishFailed") {
+		t.Errorf("unexpected events: %v", got)
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stalepods
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	SourceNone      = "none"
+	SourceAPIServer = "apiserver"
+	SourceKubelet   = "kubelet"
+)
+
+const (
+	defaultKubeletTimeout = 10 * time.Second
+)
+
+type apiServerPodSource struct {
+	lister    corelisters.PodLister
+	hasSynced cache.InformerSynced
+}
+
+// NewAPIServerPodSource watches the pods bound to the given node. The informer runs until stopCh is closed.
+func NewAPIServerPodSource(cs kubernetes.Interface, nodeName string, stopCh <-chan struct{}) PodSource {
+	factory := informers.NewSharedInformerFactoryWithOptions(cs, 0, informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+		opts.FieldSelector = "spec.nodeName=" + nodeName
+	}))
+	podInformer := factory.Core().V1().Pods()
+	src := &apiServerPodSource{
+		lister:    podInformer.Lister(),
+		hasSynced: podInformer.Informer().HasSynced,
+	}
+	factory.Start(stopCh)
+	return src
+}
+
+func (as *apiServerPodSource) ListPods() ([]*corev1.Pod, error) {
+	if !as.hasSynced() {
+		return nil, fmt.Errorf("pod informer not synced yet")
+	}
+	return as.lister.List(labels.Everything())
+}
+
+type kubeletPodSource struct {
+	url string
+	cli *http.Client
+}
+
+// NewKubeletPodSource queries the kubelet read-only endpoint, e.g. http://127.0.0.1:10255
+func NewKubeletPodSource(url string) PodSource {
+	return &kubeletPodSource{
+		url: strings.TrimSuffix(url, "/") + "/pods",
+		cli: &http.Client{
+			Timeout: defaultKubeletTimeout,
+		},
+	}
+}
+
+func (ks *kubeletPodSource) ListPods() ([]*corev1.Pod, error) {
+	resp, err := ks.cli.Get(ks.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status from %q: %s", ks.url, resp.Status)
+	}
+
+	podList := corev1.PodList{}
+	if err := json.NewDecoder(resp.Body).Decode(&podList); err != nil {
+		return nil, fmt.Errorf("cannot decode pods from %q: %w", ks.url, err)
+	}
+	pods := make([]*corev1.Pod, 0, len(podList.Items))
+	for idx := range podList.Items {
+		pods = append(pods, &podList.Items[idx])
+	}
+	return pods, nil
+}
@@ -0,0 +1,255 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stalepods
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	corev1 "k8s.io/api/core/v1"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/events"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/logging"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/metrics"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/podrescompat"
+)
+
+var logger = logging.Component("stalepods")
+
+const (
+	ReasonPodNotFound   = "PodNotFound"
+	ReasonPodTerminated = "PodTerminated"
+)
+
+const (
+	EventReasonStaleAllocation = "StaleAllocation"
+)
+
+const (
+	// the podresources data and the pod data come from different sources, which
+	// can disagree for a short while, e.g. about pods just admitted by the kubelet.
+	defaultThreshold = 2
+)
+
+type Args struct {
+	// Ignore drops the stale allocations from the List responses, so their resources are reported as available
+	Ignore bool
+	// Threshold is the number of consecutive scans an allocation must be stale before being reported
+	Threshold int
+}
+
+// Allocation describes exclusive resources held by a pod which is not running anymore.
+type Allocation struct {
+	Namespace string
+	Name      string
+	Reason    string
+	CPUs      int
+	Devices   int
+}
+
+func (al Allocation) String() string {
+	return fmt.Sprintf("%s/%s (%s): cpus=%d devices=%d", al.Namespace, al.Name, al.Reason, al.CPUs, al.Devices)
+}
+
+// PodSource provides the pods bound to this node.
+type PodSource interface {
+	ListPods() ([]*corev1.Pod, error)
+}
+
+type checkingClient struct {
+	cli  podresourcesapi.PodResourcesListerClient
+	src  PodSource
+	args Args
+	rec  *events.Recorder
+
+	lock     sync.Mutex
+	suspects map[string]int
+}
+
+// NewCheckingClientFromLister cross-references the List responses with the pods known to the node.
+func NewCheckingClientFromLister(cli podresourcesapi.PodResourcesListerClient, src PodSource, args Args, rec *events.Recorder) podresourcesapi.PodResourcesListerClient {
+	if args.Threshold <= 0 {
+		args.Threshold = defaultThreshold
+	}
+	return &checkingClient{
+		cli:      cli,
+		src:      src,
+		args:     args,
+		rec:      rec,
+		suspects: make(map[string]int),
+	}
+}
+
+func (cc *checkingClient) List(ctx context.Context, in *podresourcesapi.ListPodResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.ListPodResourcesResponse, error) {
+	resp, err := cc.cli.List(ctx, in, opts...)
+	if err != nil {
+		return resp, err
+	}
+
+	pods, err := cc.src.ListPods()
+	if err != nil {
+		logger.ErrorS(err, "cannot check for stale allocations")
+		return resp, nil
+	}
+
+	candidates := cc.refreshAllocations(ctx, FindStaleAllocations(resp, pods))
+	stale := cc.updateStaleAllocations(candidates)
+	if !cc.args.Ignore || len(stale) == 0 {
+		return resp, nil
+	}
+	return FilterAllocations(resp, stale), nil
+}
+
+func (cc *checkingClient) GetAllocatableResources(ctx context.Context, in *podresourcesapi.AllocatableResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.AllocatableResourcesResponse, error) {
+	return cc.cli.GetAllocatableResources(ctx, in, opts...)
+}
+
+// refreshAllocations re-reads the allocations about to be reported for the first time, because the
+// kubelet may have released them between the List and the pod listing. The targeted Get goes through
+// the wrapped clients, so the shared pool is filtered like in List. Only the allocations crossing the
+// threshold are refreshed, so this does not load the kubelet.
+func (cc *checkingClient) refreshAllocations(ctx context.Context, candidates []Allocation) []Allocation {
+	ret := []Allocation{}
+	for _, alloc := range candidates {
+		key := alloc.Namespace + "/" + alloc.Name
+		cc.lock.Lock()
+		crossing := cc.suspects[key]+1 == cc.args.Threshold
+		cc.lock.Unlock()
+		if !crossing {
+			ret = append(ret, alloc)
+			continue
+		}
+
+		podRes, err := podrescompat.GetPodResources(ctx, cc.cli, alloc.Namespace, alloc.Name)
+		if status.Code(err) == codes.NotFound {
+			// the kubelet does not know the pod anymore, which confirms the allocation is stale
+			ret = append(ret, alloc)
+			continue
+		}
+		if err != nil {
+			logger.ErrorS(err, "cannot refresh the allocation", "pod", key)
+			ret = append(ret, alloc)
+			continue
+		}
+		alloc.CPUs, alloc.Devices = countExclusiveResources(podRes)
+		if alloc.CPUs == 0 && alloc.Devices == 0 {
+			logger.V(2).InfoS("allocation released meanwhile", "pod", key)
+			continue
+		}
+		ret = append(ret, alloc)
+	}
+	return ret
+}
+
+func (cc *checkingClient) updateStaleAllocations(candidates []Allocation) []Allocation {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	seen := make(map[string]bool)
+	stale := []Allocation{}
+	totCPUs := 0
+	for _, alloc := range candidates {
+		key := alloc.Namespace + "/" + alloc.Name
+		seen[key] = true
+		cc.suspects[key]++
+		if cc.suspects[key] < cc.args.Threshold {
+			continue
+		}
+		if cc.suspects[key] == cc.args.Threshold {
+			logger.InfoS("detected stale allocation", "pod", key, "reason", alloc.Reason, "cpus", alloc.CPUs, "devices", alloc.Devices)
+			cc.rec.Nodef(corev1.EventTypeWarning, EventReasonStaleAllocation, "podresources reports exclusive resources held by %s", alloc.String())
+		}
+		stale = append(stale, alloc)
+		totCPUs += alloc.CPUs
+	}
+	for key := range cc.suspects {
+		if !seen[key] {
+			if cc.suspects[key] >= cc.args.Threshold {
+				logger.InfoS("stale allocation gone", "pod", key)
+			}
+			delete(cc.suspects, key)
+		}
+	}
+
+	metrics.UpdateStalePodResourcesMetrics(len(stale), totCPUs)
+	return stale
+}
+
+// FindStaleAllocations returns the pods holding exclusive resources according to podresources,
+// which either do not exist anymore or are terminated.
+func FindStaleAllocations(resp *podresourcesapi.ListPodResourcesResponse, pods []*corev1.Pod) []Allocation {
+	podsByName := make(map[string]*corev1.Pod)
+	for _, pod := range pods {
+		podsByName[pod.Namespace+"/"+pod.Name] = pod
+	}
+
+	ret := []Allocation{}
+	for _, podRes := range resp.GetPodResources() {
+		alloc := Allocation{
+			Namespace: podRes.GetNamespace(),
+			Name:      podRes.GetName(),
+		}
+		alloc.CPUs, alloc.Devices = countExclusiveResources(podRes)
+		if alloc.CPUs == 0 && alloc.Devices == 0 {
+			continue
+		}
+
+		pod, ok := podsByName[alloc.Namespace+"/"+alloc.Name]
+		if !ok {
+			alloc.Reason = ReasonPodNotFound
+		} else if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			alloc.Reason = ReasonPodTerminated
+		} else {
+			continue
+		}
+		ret = append(ret, alloc)
+	}
+	return ret
+}
+
+func countExclusiveResources(podRes *podresourcesapi.PodResources) (int, int) {
+	cpus, devices := 0, 0
+	for _, cntRes := range podRes.GetContainers() {
+		cpus += len(cntRes.GetCpuIds())
+		for _, dev := range cntRes.GetDevices() {
+			devices += len(dev.GetDeviceIds())
+		}
+	}
+	return cpus, devices
+}
+
+// FilterAllocations removes from the response the pods holding the given allocations.
+func FilterAllocations(resp *podresourcesapi.ListPodResourcesResponse, allocs []Allocation) *podresourcesapi.ListPodResourcesResponse {
+	skip := make(map[string]bool)
+	for _, alloc := range allocs {
+		skip[alloc.Namespace+"/"+alloc.Name] = true
+	}
+	podResources := make([]*podresourcesapi.PodResources, 0, len(resp.GetPodResources()))
+	for _, podRes := range resp.GetPodResources() {
+		if skip[podRes.GetNamespace()+"/"+podRes.GetName()] {
+			logger.V(2).InfoS("ignoring stale allocation", "pod", podRes.GetNamespace()+"/"+podRes.GetName())
+			continue
+		}
+		podResources = append(podResources, podRes)
+	}
+	resp.PodResources = podResources
+	return resp
+}
@@ -0,0 +1,246 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stalepods
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/events"
+)
+
+type fakeLister struct {
+	resp *podresourcesapi.ListPodResourcesResponse
+}
+
+func (fl *fakeLister) List(ctx context.Context, in *podresourcesapi.ListPodResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.ListPodResourcesResponse, error) {
+	// the checking client may filter the response in place
+	ret := *fl.resp
+	return &ret, nil
+}
+
+func (fl *fakeLister) GetAllocatableResources(ctx context.Context, in *podresourcesapi.AllocatableResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.AllocatableResourcesResponse, error) {
+	return &podresourcesapi.AllocatableResourcesResponse{}, nil
+}
+
+// fakeGetLister also serves Get, from its own data
+type fakeGetLister struct {
+	fakeLister
+	pods map[string]*podresourcesapi.PodResources
+	gets int
+}
+
+func (fg *fakeGetLister) Get(ctx context.Context, podNamespace, podName string) (*podresourcesapi.PodResources, error) {
+	fg.gets++
+	podRes, ok := fg.pods[podNamespace+"/"+podName]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "pod %s/%s not found", podNamespace, podName)
+	}
+	return podRes, nil
+}
+
+type fakeSource struct {
+	pods []*corev1.Pod
+}
+
+func (fs *fakeSource) ListPods() ([]*corev1.Pod, error) {
+	return fs.pods, nil
+}
+
+func makePod(namespace, name string, phase corev1.PodPhase) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Status:     corev1.PodStatus{Phase: phase},
+	}
+}
+
+func makeListResponse() *podresourcesapi.ListPodResourcesResponse {
+	return &podresourcesapi.ListPodResourcesResponse{
+		PodResources: []*podresourcesapi.PodResources{
+			{
+				Namespace: "ns", Name: "running",
+				Containers: []*podresourcesapi.ContainerResources{{Name: "cnt", CpuIds: []int64{2, 3}}},
+			},
+			{
+				Namespace: "ns", Name: "completed",
+				Containers: []*podresourcesapi.ContainerResources{{Name: "cnt", CpuIds: []int64{4, 5}}},
+			},
+			{
+				Namespace: "ns", Name: "deleted",
+				Containers: []*podresourcesapi.ContainerResources{
+					{
+						Name:    "cnt",
+						CpuIds:  []int64{6},
+						Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "intel_nics", DeviceIds: []string{"0000:00:02.0"}}},
+					},
+				},
+			},
+			{
+				// shared pool only, nothing exclusive to account
+				Namespace: "ns", Name: "burstable-deleted",
+				Containers: []*podresourcesapi.ContainerResources{{Name: "cnt"}},
+			},
+		},
+	}
+}
+
+func TestFindStaleAllocations(t *testing.T) {
+	pods := []*corev1.Pod{
+		makePod("ns", "running", corev1.PodRunning),
+		makePod("ns", "completed", corev1.PodSucceeded),
+	}
+	got := FindStaleAllocations(makeListResponse(), pods)
+	expected := []Allocation{
+		{Namespace: "ns", Name: "completed", Reason: ReasonPodTerminated, CPUs: 2},
+		{Namespace: "ns", Name: "deleted", Reason: ReasonPodNotFound, CPUs: 1, Devices: 1},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, want %v", got, expected)
+	}
+}
+
+func TestCheckingClientIgnoresAfterThreshold(t *testing.T) {
+	src := &fakeSource{
+		pods: []*corev1.Pod{
+			makePod("ns", "running", corev1.PodRunning),
+			makePod("ns", "completed", corev1.PodSucceeded),
+		},
+	}
+	recorder := record.NewFakeRecorder(10)
+	cli := NewCheckingClientFromLister(&fakeLister{resp: makeListResponse()}, src, Args{Ignore: true}, events.NewRecorderFromEventRecorder(recorder, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}}, "", ""))
+
+	resp, err := cli.List(context.TODO(), &podresourcesapi.ListPodResourcesRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.PodResources) != 4 {
+		t.Errorf("stale allocations ignored before the threshold: %v", resp.PodResources)
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, err = cli.List(context.TODO(), &podresourcesapi.ListPodResourcesRequest{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		names := []string{}
+		for _, podRes := range resp.PodResources {
+			names = append(names, podRes.Name)
+		}
+		expected := []string{"running", "burstable-deleted"}
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("got %v, want %v", names, expected)
+		}
+	}
+
+	// events are emitted once per stale allocation
+	if len(recorder.Events) != 2 {
+		t.Errorf("expected 2 events, got %d", len(recorder.Events))
+	}
+}
+
+func TestCheckingClientRefreshesBeforeReporting(t *testing.T) {
+	src := &fakeSource{
+		pods: []*corev1.Pod{
+			makePod("ns", "running", corev1.PodRunning),
+			makePod("ns", "completed", corev1.PodSucceeded),
+			makePod("ns", "evicted", corev1.PodFailed),
+		},
+	}
+	resp := makeListResponse()
+	resp.PodResources = append(resp.PodResources, &podresourcesapi.PodResources{
+		Namespace: "ns", Name: "evicted",
+		Containers: []*podresourcesapi.ContainerResources{{Name: "cnt", CpuIds: []int64{7}}},
+	})
+	lister := &fakeGetLister{
+		fakeLister: fakeLister{resp: resp},
+		pods: map[string]*podresourcesapi.PodResources{
+			// the wrapped clients filtered the shared pool cpu 5 out
+			"ns/completed": {
+				Namespace: "ns", Name: "completed",
+				Containers: []*podresourcesapi.ContainerResources{{Name: "cnt", CpuIds: []int64{4}}},
+			},
+			// the kubelet released the cpus after the List
+			"ns/evicted": {
+				Namespace: "ns", Name: "evicted",
+				Containers: []*podresourcesapi.ContainerResources{{Name: "cnt"}},
+			},
+			// "deleted" is unknown to the kubelet, which confirms the allocation is stale
+		},
+	}
+	recorder := record.NewFakeRecorder(10)
+	cli := NewCheckingClientFromLister(lister, src, Args{Ignore: true, Threshold: 1}, events.NewRecorderFromEventRecorder(recorder, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}}, "", ""))
+
+	got, err := cli.List(context.TODO(), &podresourcesapi.ListPodResourcesRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	names := []string{}
+	for _, podRes := range got.PodResources {
+		names = append(names, podRes.Name)
+	}
+	expected := []string{"running", "burstable-deleted", "evicted"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("got %v, want %v", names, expected)
+	}
+	if lister.gets != 3 {
+		t.Errorf("expected 3 refreshes, got %d", lister.gets)
+	}
+
+	reported := []string{}
+	for len(recorder.Events) > 0 {
+		reported = append(reported, <-recorder.Events)
+	}
+	if len(reported) != 2 || !strings.Contains(reported[0], "ns/completed (PodTerminated): cpus=1 devices=0") || !strings.Contains(reported[1], "ns/deleted (PodNotFound): cpus=1 devices=1") {
+		t.Errorf("unexpected events: %v", reported)
+	}
+}
+
+func TestKubeletPodSource(t *testing.T) {
+	podList := corev1.PodList{
+		Items: []corev1.Pod{
+			*makePod("ns", "running", corev1.PodRunning),
+		},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/pods" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(podList)
+	}))
+	defer srv.Close()
+
+	pods, err := NewKubeletPodSource(srv.URL + "/").ListPods()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pods) != 1 || pods[0].Name != "running" || pods[0].Status.Phase != corev1.PodRunning {
+		t.Errorf("unexpected pods: %v", pods)
+	}
+}
@@ -15,28 +15,34 @@ limitations under the License.
 package sysinfo
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"strings"
 
 	"github.com/jaypipes/ghw/pkg/pci"
 
 	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/logging"
 )
 
 const (
 	SysDevicesOnlineCPUs = "/sys/devices/system/cpu/online"
 )
 
+var logger = logging.Component("sysinfo")
+
 type Config struct {
 	ReservedCPUs string
 	// vendor:device -> resourcename
 	ResourceMapping map[string]string
+	// account the devices allocated through DRA claims
+	DynamicResources bool
 }
 
 func (cfg Config) IsEmpty() bool {
-	return cfg.ReservedCPUs == "" && len(cfg.ResourceMapping) == 0
+	return cfg.ReservedCPUs == "" && len(cfg.ResourceMapping) == 0 && !cfg.DynamicResources
 }
 
 // NUMA Cell -> deviceIDs
@@ -48,6 +54,17 @@ type SysInfo struct {
 	Resources map[string]PerNUMADevices
 }
 
+// MarshalJSON renders the cpus as a cpuset list, which cpuset.CPUSet does not marshal
+func (si SysInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		CPUs      string                    `json:"cpus"`
+		Resources map[string]PerNUMADevices `json:"resources,omitempty"`
+	}{
+		CPUs:      si.CPUs.String(),
+		Resources: si.Resources,
+	})
+}
+
 func (si SysInfo) String() string {
 	b := strings.Builder{}
 	fmt.Fprintf(&b, "cpus: allocatable %q\n", si.CPUs.String())
@@ -81,13 +98,13 @@ func GetCPUResources(resCPUs string, getCPUs func() (cpuset.CPUSet, error)) (cpu
 	if err != nil {
 		return cpuset.CPUSet{}, err
 	}
-	log.Printf("cpus: reserved %q", reservedCPUs.String())
+	logger.V(2).InfoS("reserved cpus", "cpus", reservedCPUs.String())
 
 	cpus, err := getCPUs()
 	if err != nil {
 		return cpuset.CPUSet{}, err
 	}
-	log.Printf("cpus: online %q", cpus.String())
+	logger.V(2).InfoS("online cpus", "cpus", cpus.String())
 
 	return cpus.Difference(reservedCPUs), nil
 }
@@ -114,6 +131,7 @@ func GetPCIResources(resourceMap map[string]string, getPCIs func() ([]*pci.Devic
 		if dev.Node != nil {
 			nodeID = dev.Node.ID
 		}
+		logger.V(4).InfoS("mapped device", "pciAddress", dev.Address, "resource", resourceName, "numa", nodeID)
 		numaDevs[nodeID] = append(numaDevs[nodeID], dev.Address)
 		numaResources[resourceName] = numaDevs
 	}
@@ -124,11 +142,9 @@ func GetPCIResources(resourceMap map[string]string, getPCIs func() ([]*pci.Devic
 func ResourceNameForDevice(dev *pci.Device, resourceMap map[string]string) (string, bool) {
 	devID := fmt.Sprintf("%s:%s", dev.Vendor.ID, dev.Product.ID)
 	if resourceName, ok := resourceMap[devID]; ok {
-		log.Printf("devs: resource for %s is %q", devID, resourceName)
 		return resourceName, true
 	}
 	if resourceName, ok := resourceMap[dev.Vendor.ID]; ok {
-		log.Printf("devs: resource for %s is %q", dev.Vendor.ID, resourceName)
 		return resourceName, true
 	}
 	return "", false
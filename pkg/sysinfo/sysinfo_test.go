@@ -15,6 +15,7 @@ limitations under the License.
 package sysinfo
 
 import (
+	"encoding/json"
 	"reflect"
 	"testing"
 
@@ -144,6 +145,23 @@ func TestResourceNameForDevice(t *testing.T) {
 	}
 }
 
+func TestSysInfoMarshalJSON(t *testing.T) {
+	si := SysInfo{
+		CPUs: cpuset.MustParse("1-7,9-15"),
+		Resources: map[string]PerNUMADevices{
+			"example.com/nic": {0: []string{"0000:3b:00.0"}},
+		},
+	}
+	data, err := json.Marshal(si)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `{"cpus":"1-7,9-15","resources":{"example.com/nic":{"0":["0000:3b:00.0"]}}}`
+	if string(data) != expected {
+		t.Errorf("got %s, want %s", data, expected)
+	}
+}
+
 func namedPCIDevice(vendorID, productID string) *pci.Device {
 	return &pci.Device{
 		Vendor: &pcidb.Vendor{
@@ -0,0 +1,124 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package topologyapi serves the zone data to the agents on the node over gRPC on a unix socket.
+package topologyapi
+
+import (
+	"fmt"
+
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+// Like in podrescompat, the messages are written by hand: the protobuf runtime derives
+// the wire format from the struct tags. The equivalent proto definition is:
+//
+// service NodeTopology {
+//   rpc Get(GetRequest) returns (Snapshot) {}
+//   rpc Watch(WatchRequest) returns (stream Snapshot) {}
+//   rpc ListPodResources(ListPodResourcesRequest) returns (PodResourcesView) {}
+// }
+
+const (
+	ServiceName = "rte.v1.NodeTopology"
+
+	methodGet              = "/" + ServiceName + "/Get"
+	methodWatch            = "/" + ServiceName + "/Watch"
+	methodListPodResources = "/" + ServiceName + "/ListPodResources"
+)
+
+type GetRequest struct{}
+
+func (m *GetRequest) Reset()         { *m = GetRequest{} }
+func (m *GetRequest) String() string { return "GetRequest{}" }
+func (*GetRequest) ProtoMessage()    {}
+
+// WatchRequest starts the stream after the given version. 0, or a version from a previous run
+// of the exporter, sends the current snapshot first.
+type WatchRequest struct {
+	ResourceVersion uint64 `protobuf:"varint,1,opt,name=resource_version,json=resourceVersion,proto3" json:"resource_version,omitempty"`
+}
+
+func (m *WatchRequest) Reset()         { *m = WatchRequest{} }
+func (m *WatchRequest) String() string { return fmt.Sprintf("WatchRequest{%d}", m.ResourceVersion) }
+func (*WatchRequest) ProtoMessage()    {}
+
+type ListPodResourcesRequest struct{}
+
+func (m *ListPodResourcesRequest) Reset()         { *m = ListPodResourcesRequest{} }
+func (m *ListPodResourcesRequest) String() string { return "ListPodResourcesRequest{}" }
+func (*ListPodResourcesRequest) ProtoMessage()    {}
+
+type ResourceInfo struct {
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// quantities, in the canonical string form
+	Capacity    string `protobuf:"bytes,2,opt,name=capacity,proto3" json:"capacity,omitempty"`
+	Allocatable string `protobuf:"bytes,3,opt,name=allocatable,proto3" json:"allocatable,omitempty"`
+	Available   string `protobuf:"bytes,4,opt,name=available,proto3" json:"available,omitempty"`
+}
+
+func (m *ResourceInfo) Reset() { *m = ResourceInfo{} }
+func (m *ResourceInfo) String() string {
+	return fmt.Sprintf("ResourceInfo{%s %s/%s/%s}", m.Name, m.Available, m.Allocatable, m.Capacity)
+}
+func (*ResourceInfo) ProtoMessage() {}
+
+type CostInfo struct {
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value int64  `protobuf:"varint,2,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+func (m *CostInfo) Reset()         { *m = CostInfo{} }
+func (m *CostInfo) String() string { return fmt.Sprintf("CostInfo{%s=%d}", m.Name, m.Value) }
+func (*CostInfo) ProtoMessage()    {}
+
+type Zone struct {
+	Name      string          `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Type      string          `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Parent    string          `protobuf:"bytes,3,opt,name=parent,proto3" json:"parent,omitempty"`
+	Resources []*ResourceInfo `protobuf:"bytes,4,rep,name=resources,proto3" json:"resources,omitempty"`
+	Costs     []*CostInfo     `protobuf:"bytes,5,rep,name=costs,proto3" json:"costs,omitempty"`
+}
+
+func (m *Zone) Reset()         { *m = Zone{} }
+func (m *Zone) String() string { return fmt.Sprintf("Zone{%s %s}", m.Name, m.Type) }
+func (*Zone) ProtoMessage()    {}
+
+// Snapshot is the zone data of a scan. The resource version grows at every change.
+type Snapshot struct {
+	ResourceVersion uint64  `protobuf:"varint,1,opt,name=resource_version,json=resourceVersion,proto3" json:"resource_version,omitempty"`
+	NodeName        string  `protobuf:"bytes,2,opt,name=node_name,json=nodeName,proto3" json:"node_name,omitempty"`
+	TopologyPolicy  string  `protobuf:"bytes,3,opt,name=topology_policy,json=topologyPolicy,proto3" json:"topology_policy,omitempty"`
+	Zones           []*Zone `protobuf:"bytes,4,rep,name=zones,proto3" json:"zones,omitempty"`
+	PodFingerprint  string  `protobuf:"bytes,5,opt,name=pod_fingerprint,json=podFingerprint,proto3" json:"pod_fingerprint,omitempty"`
+}
+
+func (m *Snapshot) Reset() { *m = Snapshot{} }
+func (m *Snapshot) String() string {
+	return fmt.Sprintf("Snapshot{%s v%d %d zones}", m.NodeName, m.ResourceVersion, len(m.Zones))
+}
+func (*Snapshot) ProtoMessage() {}
+
+// PodResourcesView is the podresources data the exporter works with: the allocatable
+// devices include the ones learned through the sysinfo device mapping.
+type PodResourcesView struct {
+	PodResources []*podresourcesapi.PodResources               `protobuf:"bytes,1,rep,name=pod_resources,json=podResources,proto3" json:"pod_resources,omitempty"`
+	Allocatable  *podresourcesapi.AllocatableResourcesResponse `protobuf:"bytes,2,opt,name=allocatable,proto3" json:"allocatable,omitempty"`
+}
+
+func (m *PodResourcesView) Reset() { *m = PodResourcesView{} }
+func (m *PodResourcesView) String() string {
+	return fmt.Sprintf("PodResourcesView{%d pods}", len(m.PodResources))
+}
+func (*PodResourcesView) ProtoMessage() {}
@@ -0,0 +1,86 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topologyapi
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// Client is meant for the node agents consuming the API
+type Client struct {
+	conn grpc.ClientConnInterface
+}
+
+// Dial connects to the exporter socket at path
+func Dial(path string) (*Client, *grpc.ClientConn, error) {
+	conn, err := grpc.Dial("unix://"+path, grpc.WithInsecure())
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewClient(conn), conn, nil
+}
+
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{
+		conn: conn,
+	}
+}
+
+func (cli *Client) Get(ctx context.Context, opts ...grpc.CallOption) (*Snapshot, error) {
+	resp := &Snapshot{}
+	if err := cli.conn.Invoke(ctx, methodGet, &GetRequest{}, resp, opts...); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (cli *Client) ListPodResources(ctx context.Context, opts ...grpc.CallOption) (*PodResourcesView, error) {
+	resp := &PodResourcesView{}
+	if err := cli.conn.Invoke(ctx, methodListPodResources, &ListPodResourcesRequest{}, resp, opts...); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// SnapshotStream receives the snapshots until the context of the Watch call is done
+type SnapshotStream struct {
+	stream grpc.ClientStream
+}
+
+func (ss *SnapshotStream) Recv() (*Snapshot, error) {
+	snap := &Snapshot{}
+	if err := ss.stream.RecvMsg(snap); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// Watch streams the snapshots newer than resourceVersion
+func (cli *Client) Watch(ctx context.Context, resourceVersion uint64, opts ...grpc.CallOption) (*SnapshotStream, error) {
+	desc := &grpc.StreamDesc{StreamName: "Watch", ServerStreams: true}
+	stream, err := cli.conn.NewStream(ctx, desc, methodWatch, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(&WatchRequest{ResourceVersion: resourceVersion}); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return &SnapshotStream{stream: stream}, nil
+}
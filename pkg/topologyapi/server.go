@@ -0,0 +1,233 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topologyapi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"reflect"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+
+	"github.com/k8stopologyawareschedwg/noderesourcetopology-api/pkg/apis/topology/v1alpha1"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/logging"
+	"github.com/openshift-kni/resource-topology-exporter/pkg/nrtupdater"
+)
+
+var logger = logging.Component("topologyapi")
+
+// Server is fed by the exporter pipeline as a sink, and serves the latest snapshot
+type Server struct {
+	nodeName string
+	tmPolicy string
+	cli      podresourcesapi.PodResourcesListerClient
+
+	lock    sync.Mutex
+	current *Snapshot
+	// closed and replaced at every change, to wake up the watchers
+	changed chan struct{}
+}
+
+func NewServer(nodeName, tmPolicy string, cli podresourcesapi.PodResourcesListerClient) *Server {
+	return &Server{
+		nodeName: nodeName,
+		tmPolicy: tmPolicy,
+		cli:      cli,
+		changed:  make(chan struct{}),
+	}
+}
+
+func (srv *Server) Name() string {
+	return "grpc"
+}
+
+// Update publishes a new snapshot if the zones or the pods changed
+func (srv *Server) Update(info nrtupdater.MonitorInfo) error {
+	snap := &Snapshot{
+		NodeName:       srv.nodeName,
+		TopologyPolicy: srv.tmPolicy,
+		Zones:          SnapshotZones(info.Zones),
+		PodFingerprint: info.PodFingerprint,
+	}
+
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	if srv.current != nil {
+		snap.ResourceVersion = srv.current.ResourceVersion
+		if reflect.DeepEqual(snap, srv.current) {
+			return nil
+		}
+	}
+	snap.ResourceVersion++
+	srv.current = snap
+	close(srv.changed)
+	srv.changed = make(chan struct{})
+	return nil
+}
+
+// SnapshotZones converts the zones, sorted by name
+func SnapshotZones(zones v1alpha1.ZoneList) []*Zone {
+	ret := []*Zone{}
+	for _, zone := range nrtupdater.NormalizeZones(zones) {
+		sz := &Zone{
+			Name:   zone.Name,
+			Type:   zone.Type,
+			Parent: zone.Parent,
+		}
+		for _, res := range zone.Resources {
+			sz.Resources = append(sz.Resources, &ResourceInfo{
+				Name:        res.Name,
+				Capacity:    res.Capacity.String(),
+				Allocatable: res.Allocatable.String(),
+				Available:   res.Available.String(),
+			})
+		}
+		for _, cost := range zone.Costs {
+			sz.Costs = append(sz.Costs, &CostInfo{
+				Name:  cost.Name,
+				Value: cost.Value,
+			})
+		}
+		ret = append(ret, sz)
+	}
+	return ret
+}
+
+// next returns the current snapshot if its version differs, and the channel closed on the next change.
+// A version ahead of the current one comes from a previous run of the exporter, which restarted
+// the versions from 1, so the current snapshot is newer anyway.
+func (srv *Server) next(version uint64) (*Snapshot, <-chan struct{}) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	if srv.current != nil && srv.current.ResourceVersion != version {
+		return srv.current, srv.changed
+	}
+	return nil, srv.changed
+}
+
+func (srv *Server) Get(ctx context.Context, req *GetRequest) (*Snapshot, error) {
+	snap, _ := srv.next(0)
+	if snap == nil {
+		return nil, status.Error(codes.Unavailable, "no data yet")
+	}
+	return snap, nil
+}
+
+// Watch sends the snapshots newer than the requested version, starting with the current one if the
+// exporter restarted since. A slow watcher misses the intermediate snapshots, but always gets the latest one.
+func (srv *Server) Watch(req *WatchRequest, stream grpc.ServerStream) error {
+	version := req.ResourceVersion
+	for {
+		snap, changed := srv.next(version)
+		if snap != nil {
+			if err := stream.SendMsg(snap); err != nil {
+				return err
+			}
+			version = snap.ResourceVersion
+			continue
+		}
+		select {
+		case <-changed:
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+func (srv *Server) ListPodResources(ctx context.Context, req *ListPodResourcesRequest) (*PodResourcesView, error) {
+	listResp, err := srv.cli.List(ctx, &podresourcesapi.ListPodResourcesRequest{})
+	if err != nil {
+		return nil, err
+	}
+	allocResp, err := srv.cli.GetAllocatableResources(ctx, &podresourcesapi.AllocatableResourcesRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return &PodResourcesView{
+		PodResources: listResp.GetPodResources(),
+		Allocatable:  allocResp,
+	}, nil
+}
+
+// Serve listens on the unix socket at path, replacing a leftover socket, until the context is done
+// or the listener fails. The socket is removed on return.
+func (srv *Server) Serve(ctx context.Context, path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	gsrv := grpc.NewServer()
+	gsrv.RegisterService(&serviceDesc, srv)
+	go func() {
+		<-ctx.Done()
+		// not graceful: the watchers would keep the server running
+		gsrv.Stop()
+	}()
+	logger.InfoS("serving", "service", ServiceName, "path", path)
+	err = gsrv.Serve(lis)
+	os.Remove(path)
+	return err
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := &GetRequest{}
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				return srv.(*Server).Get(ctx, req)
+			},
+		},
+		{
+			MethodName: "ListPodResources",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := &ListPodResourcesRequest{}
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				return srv.(*Server).ListPodResources(ctx, req)
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "Watch",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				req := &WatchRequest{}
+				if err := stream.RecvMsg(req); err != nil {
+					return err
+				}
+				return srv.(*Server).Watch(req, stream)
+			},
+			ServerStreams: true,
+		},
+	},
+}
@@ -0,0 +1,174 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topologyapi
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+
+	"github.com/k8stopologyawareschedwg/noderesourcetopology-api/pkg/apis/topology/v1alpha1"
+
+	"github.com/openshift-kni/resource-topology-exporter/pkg/nrtupdater"
+)
+
+type fakePodResourcesClient struct{}
+
+func (fc fakePodResourcesClient) List(ctx context.Context, in *podresourcesapi.ListPodResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.ListPodResourcesResponse, error) {
+	return &podresourcesapi.ListPodResourcesResponse{
+		PodResources: []*podresourcesapi.PodResources{
+			{
+				Namespace: "ns",
+				Name:      "pod",
+				Containers: []*podresourcesapi.ContainerResources{
+					{Name: "cnt", CpuIds: []int64{2, 3}},
+				},
+			},
+		},
+	}, nil
+}
+
+func (fc fakePodResourcesClient) GetAllocatableResources(ctx context.Context, in *podresourcesapi.AllocatableResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.AllocatableResourcesResponse, error) {
+	return &podresourcesapi.AllocatableResourcesResponse{
+		CpuIds: []int64{0, 1, 2, 3},
+		Devices: []*podresourcesapi.ContainerDevices{
+			{
+				ResourceName: "vendor.com/nic",
+				DeviceIds:    []string{"0000:3b:00.0"},
+				Topology:     &podresourcesapi.TopologyInfo{Nodes: []*podresourcesapi.NUMANode{{ID: 0}}},
+			},
+		},
+	}, nil
+}
+
+func makeInfo(available string) nrtupdater.MonitorInfo {
+	zones := v1alpha1.ZoneList{}
+	for idx := 0; idx < 2; idx++ {
+		zones = append(zones, v1alpha1.Zone{
+			Name: fmt.Sprintf("node-%d", idx),
+			Type: "Node",
+			Resources: v1alpha1.ResourceInfoList{
+				{Name: "cpu", Capacity: resource.MustParse("4"), Allocatable: resource.MustParse("4"), Available: resource.MustParse(available)},
+			},
+			Costs: v1alpha1.CostList{{Name: "node-0", Value: 10}, {Name: "node-1", Value: 20}},
+		})
+	}
+	return nrtupdater.MonitorInfo{Zones: zones, PodFingerprint: "pfp0v001aaaa"}
+}
+
+func TestServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rte-topologyapi")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "rte.sock")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	srv := NewServer("node", "SingleNUMANodeContainerLevel", fakePodResourcesClient{})
+	serveCtx, stopServing := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() {
+		served <- srv.Serve(serveCtx, socketPath)
+	}()
+
+	cli, conn, err := Dial(socketPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	// the server may not be listening yet
+	_, err = cli.Get(ctx, grpc.WaitForReady(true))
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("unexpected error before the first update: %v", err)
+	}
+
+	if err := srv.Update(makeInfo("4")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	snap, err := cli.Get(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if snap.ResourceVersion != 1 || snap.NodeName != "node" || len(snap.Zones) != 2 || snap.PodFingerprint != "pfp0v001aaaa" {
+		t.Fatalf("unexpected snapshot: %v", snap)
+	}
+	if res := snap.Zones[1].Resources[0]; res.Name != "cpu" || res.Available != "4" || snap.Zones[1].Costs[1].Value != 20 {
+		t.Errorf("unexpected zone: %v %v", res, snap.Zones[1].Costs)
+	}
+
+	stream, err := cli.Watch(ctx, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	snap, err = stream.Recv()
+	if err != nil || snap.ResourceVersion != 1 {
+		t.Fatalf("unexpected first snapshot: %v %v", snap, err)
+	}
+
+	// unchanged data does not bump the version
+	if err := srv.Update(makeInfo("4")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := srv.Update(makeInfo("2")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	snap, err = stream.Recv()
+	if err != nil || snap.ResourceVersion != 2 || snap.Zones[0].Resources[0].Available != "2" {
+		t.Fatalf("unexpected second snapshot: %v %v", snap, err)
+	}
+
+	// a watcher of a previous run of the exporter resumes from a version ahead of the current one
+	resumed, err := cli.Watch(ctx, 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	snap, err = resumed.Recv()
+	if err != nil || snap.ResourceVersion != 2 {
+		t.Fatalf("unexpected resumed snapshot: %v %v", snap, err)
+	}
+
+	view, err := cli.ListPodResources(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(view.PodResources) != 1 || len(view.PodResources[0].Containers[0].CpuIds) != 2 {
+		t.Errorf("unexpected pod resources: %v", view.PodResources)
+	}
+	if devs := view.Allocatable.GetDevices(); len(devs) != 1 || devs[0].DeviceIds[0] != "0000:3b:00.0" {
+		t.Errorf("unexpected allocatable: %v", view.Allocatable)
+	}
+	stopServing()
+	if err := <-served; err != nil {
+		t.Errorf("unexpected serve error: %v", err)
+	}
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Errorf("socket not removed: %v", err)
+	}
+}